@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"cata/internal/clock"
 	"cata/internal/config"
@@ -185,6 +186,12 @@ func getConfigValue(cfg *config.AppConfig, key string) interface{} {
 		return cfg.WorkspaceFiles.MaxReadBytes
 	case "workspace_files.max_write_bytes":
 		return cfg.WorkspaceFiles.MaxWriteBytes
+	case "workspace_files.require_confirm":
+		return cfg.WorkspaceFiles.RequireConfirm
+	case "workspace_files.confirm_paths":
+		return cfg.WorkspaceFiles.ConfirmPaths
+	case "workspace.default_dir":
+		return cfg.Workspace.DefaultDir
 	default:
 		return nil
 	}
@@ -279,6 +286,18 @@ func setConfigValue(cfg *config.AppConfig, key, value string) error {
 			return fmt.Errorf("invalid integer value: %s", value)
 		}
 		cfg.WorkspaceFiles.MaxWriteBytes = v
+	case "workspace_files.require_confirm":
+		cfg.WorkspaceFiles.RequireConfirm = value == "true" || value == "1"
+	case "workspace_files.confirm_paths":
+		// 逗号分隔，如 "migrations/**,*.tf"；空串清空
+		cfg.WorkspaceFiles.ConfirmPaths = nil
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.WorkspaceFiles.ConfirmPaths = append(cfg.WorkspaceFiles.ConfirmPaths, p)
+			}
+		}
+	case "workspace.default_dir":
+		cfg.Workspace.DefaultDir = value
 	default:
 		return fmt.Errorf("unknown config key: %s", key)
 	}
@@ -17,7 +17,7 @@ func main() {
 	}
 
 	if len(os.Args) < 2 {
-		client.RunChat()
+		client.RunChat(nil)
 		return
 	}
 
@@ -26,13 +26,31 @@ func main() {
 	case "help", "--help", "-h":
 		printUsage()
 	case "chat":
-		client.RunChat()
+		client.RunChat(os.Args[2:])
+	case "ask":
+		client.RunAsk(os.Args[2:])
 	case "init":
 		runInit()
 	case "config":
 		handleConfigCommand(os.Args[2:])
 	case "run":
 		runServer(os.Args[2:])
+	case "status":
+		client.RunStatus(os.Args[2:])
+	case "stop":
+		client.RunStop(os.Args[2:])
+	case "restart":
+		client.RunRestart(os.Args[2:])
+	case "reload":
+		client.RunReload(os.Args[2:])
+	case "usage":
+		client.RunUsage(os.Args[2:])
+	case "audit":
+		client.RunAudit(os.Args[2:])
+	case "schedule":
+		client.RunSchedule(os.Args[2:])
+	case "task":
+		client.RunTask(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Error: Unknown command: %s\n\n", command)
 		printUsage()
@@ -46,13 +64,32 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  cata              Start chat (default)")
 	fmt.Println("  cata chat         Same as default")
+	fmt.Println("  cata chat --dir <dir> [--dir <dir>]  Output dirs (first = primary; default workspace.default_dir or cwd)")
+	fmt.Println("  cata chat --continue | --resume [id]   Reload the latest / a saved session (no id: pick)")
+	fmt.Println("  cata ask [flags] \"prompt\"   One non-interactive turn (prompt may come from stdin)")
+	fmt.Println("                    --approve | --deny   answer run_command / file edit confirmations (default deny)")
+	fmt.Println("                    --choice <id|n|first>   default answer for ask_user (default cancel)")
+	fmt.Println("                    --extend   keep going when a turn limit is reached (default summarize and stop)")
+	fmt.Println("  cata ask|chat --json   NDJSON events on stdout; confirmations/choices as JSON lines on stdin")
 	fmt.Println("  cata run          Start server (one per machine; foreground)")
+	fmt.Println("  cata status [--json]   Server pid, attached chats/workspaces, MCP servers, evolution schedule")
+	fmt.Println("  cata stop         Stop the server gracefully (in-flight turns are cancelled and saved)")
+	fmt.Println("  cata restart      Restart the server; open chats reconnect on the next message")
+	fmt.Println("  cata reload       Re-read config.json in the running server (also on SIGHUP); applies between turns")
+	fmt.Println("  cata usage [--since 7d] [--all] [--json]   Token usage and cost per role/model (llm.prices for cost)")
+	fmt.Println("  cata audit [--since 7d] [--tool T] [--path P] [--limit N] [--all] [--json]   Tool execution audit log")
+	fmt.Println("  cata schedule add \"<cron>\" [--dir D] [--approve] \"prompt\"   Run a prompt unattended on a cron schedule (in the running server)")
+	fmt.Println("  cata schedule list | logs [id] | rm <id>   Scheduled jobs, their runs and transcripts")
+	fmt.Println("  cata task submit [ask flags] \"prompt\"   Queue a prompt to run in the server without a client")
+	fmt.Println("  cata task list | status <id> | attach <id> | cancel <id> | logs <id>   Background tasks; attach follows live and answers confirmations")
 	fmt.Println("  cata init         Initialize ~/.cata brain layout")
 	fmt.Println("  cata config       Manage configuration")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  cata              # auto-starts server; /exit stops server when last chat ends")
 	fmt.Println("  cd ../other && cata   # another project (same server until all chats exit)")
+	fmt.Println("  cata chat --dir ~/mono --dir ~/docs   # edit a sibling docs repo too")
+	fmt.Println("  git diff --cached | cata ask   # answer on stdout; progress on stderr; exit 1 on failure")
 	fmt.Println()
 	fmt.Println("Same output directory: second `cata` exits with an error.")
 	fmt.Println("See README.md and agents.md")
@@ -116,12 +153,10 @@ func runServer(args []string) {
 		}
 	}
 
-	if config.Config == nil {
-		cfg, err := config.LoadConfig()
-		if err != nil {
+	cfg := config.Current()
+	if cfg == nil {
+		if _, err := config.LoadConfig(); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to load config: %v\n", err)
-		} else {
-			config.Config = cfg
 		}
 	}
 
@@ -142,4 +177,10 @@ func runServer(args []string) {
 	}
 
 	srv.Wait()
+	if srv.RestartRequested() {
+		if err := server.Reexec(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restart server: %v\n", err)
+			os.Exit(1)
+		}
+	}
 }
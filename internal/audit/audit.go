@@ -0,0 +1,227 @@
+// Package audit 工具执行审计日志：每个脑子分区一个 audit.jsonl（只追加，每次工具执行一行），
+// 记录参数、cwd、退出码、耗时、写入量、确认结果与输出哈希，供 cata audit 按时间、工具与路径查询。
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cata/internal/brain"
+	"cata/internal/clock"
+	"cata/internal/protocol"
+)
+
+// Entry 审计日志的一行。
+type Entry = protocol.AuditEntry
+
+// maxArgString 参数中超过该长度的字符串只记长度与哈希（append_file 的 content 等）。
+const maxArgString = 200
+
+type entryCtxKey struct{}
+
+// WithEntry 将进行中的审计记录放入 ctx，工具实现经 From 补充退出码、确认结果等。
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryCtxKey{}, e)
+}
+
+// From 取 ctx 中进行中的审计记录（无则为 nil）。
+func From(ctx context.Context) *Entry {
+	if ctx == nil {
+		return nil
+	}
+	e, _ := ctx.Value(entryCtxKey{}).(*Entry)
+	return e
+}
+
+// Hash 内容的 sha256 前 16 位十六进制。
+func Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NormalizeArgs 参数 JSON 规范化：键排序、紧凑输出，长字符串替换为长度与哈希；非法 JSON 原样截断。
+func NormalizeArgs(args string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(args), &v); err != nil {
+		if len(args) > maxArgString {
+			return args[:maxArgString] + "…"
+		}
+		return args
+	}
+	b, err := json.Marshal(shorten(v))
+	if err != nil {
+		return args
+	}
+	return string(b)
+}
+
+func shorten(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		if len(x) > maxArgString {
+			return fmt.Sprintf("<%d bytes sha256:%s>", len(x), Hash(x))
+		}
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = shorten(e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = shorten(e)
+		}
+	}
+	return v
+}
+
+var logMu sync.Mutex
+
+// Record 追加一条记录到 ws 的审计日志（补齐时间）。
+func Record(ws *brain.Workspace, e Entry) error {
+	if ws == nil {
+		return nil
+	}
+	if e.At == "" {
+		e.At = clock.RFC3339()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	path := ws.AuditLogPath()
+	logMu.Lock()
+	defer logMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Filter 查询条件；零值字段不过滤。
+type Filter struct {
+	Since time.Time
+	Tool  string
+	// Path 绝对路径（匹配该文件或目录下的文件）或 glob（匹配完整路径或文件名）
+	Path string
+}
+
+// Match e 是否满足条件。
+func (f Filter) Match(e Entry) bool {
+	if f.Tool != "" && e.Tool != f.Tool {
+		return false
+	}
+	if !f.Since.IsZero() {
+		at, err := time.Parse(time.RFC3339, e.At)
+		if err != nil || at.Before(f.Since) {
+			return false
+		}
+	}
+	if f.Path != "" {
+		if matchPath(f.Path, e.Path) {
+			return true
+		}
+		for _, p := range e.Paths {
+			if matchPath(f.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchPath(pattern, path string) bool {
+	if path == "" {
+		return false
+	}
+	if path == pattern || strings.HasPrefix(path, strings.TrimSuffix(pattern, string(filepath.Separator))+string(filepath.Separator)) {
+		return true
+	}
+	if ok, _ := filepath.Match(pattern, path); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
+
+// Load 读取 ws 审计日志中满足 f 的记录（时间升序）。坏行跳过。
+func Load(ws *brain.Workspace, f Filter) ([]Entry, error) {
+	data, err := os.ReadFile(ws.AuditLogPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
+
+// Query 汇集 workspaces 中满足 f 的记录，按时间排序后保留最近 limit 条（limit ≤ 0 为全部）。
+func Query(workspaces []*brain.Workspace, f Filter, limit int) (protocol.AuditReport, error) {
+	r := protocol.AuditReport{Workspaces: []string{}, Entries: []Entry{}}
+	if !f.Since.IsZero() {
+		r.Since = clock.FormatTime(f.Since, time.RFC3339)
+	}
+	for _, ws := range workspaces {
+		entries, err := Load(ws, f)
+		if err != nil {
+			return r, fmt.Errorf("audit log %s: %w", ws.ID, err)
+		}
+		r.Workspaces = append(r.Workspaces, ws.ID)
+		r.Entries = append(r.Entries, entries...)
+	}
+	if len(workspaces) > 1 {
+		sortByTime(r.Entries)
+	}
+	r.Matched = len(r.Entries)
+	if limit > 0 && len(r.Entries) > limit {
+		r.Entries = r.Entries[len(r.Entries)-limit:]
+	}
+	return r, nil
+}
+
+// sortByTime 按 At 稳定排序（解析失败的排在最前）。
+func sortByTime(es []Entry) {
+	at := make([]time.Time, len(es))
+	for i, e := range es {
+		at[i], _ = time.Parse(time.RFC3339, e.At)
+	}
+	idx := make([]int, len(es))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return at[idx[a]].Before(at[idx[b]]) })
+	sorted := make([]Entry, len(es))
+	for i, j := range idx {
+		sorted[i] = es[j]
+	}
+	copy(es, sorted)
+}
@@ -7,7 +7,7 @@ var (
 	activeWS *Workspace
 )
 
-// SetActive 设置当前请求上下文的工作区。
+// SetActive 设置进程级工作区（CLI 单会话；server 的 chat 与演进经 Session 传递，不写这里）。
 func SetActive(w *Workspace) {
 	activeMu.Lock()
 	activeWS = w
@@ -21,10 +21,15 @@ func Active() *Workspace {
 	return activeWS
 }
 
-// MustActive 返回当前工作区；若无则尝试用 cwd 解析。
+// MustActive 返回当前工作区；若无则用 cwd 解析并设为活跃。
 func MustActive() (*Workspace, error) {
 	if w := Active(); w != nil {
 		return w, nil
 	}
-	return ResolveWorkspace("")
+	w, err := ResolveWorkspace("")
+	if err != nil {
+		return nil, err
+	}
+	SetActive(w)
+	return w, nil
 }
@@ -12,13 +12,20 @@ type Capabilities struct {
 	MCP    []string
 }
 
-// LoadActiveCapabilities 读取当前 workspace 活跃 mode 的 capabilities.yaml。
+// LoadActiveCapabilities 读取进程级活跃 workspace 的 capabilities.yaml（CLI 用；server 走 Session.Capabilities）。
 func LoadActiveCapabilities() Capabilities {
-	w := Active()
+	return LoadCapabilitiesFor(Active(), "")
+}
+
+// LoadCapabilitiesFor 读取 w 某 mode 的 capabilities.yaml；modeID 空为 workspace 活跃 mode，w 为 nil 时仅 browser。
+func LoadCapabilitiesFor(w *Workspace, modeID string) Capabilities {
 	if w == nil {
 		return Capabilities{MCP: []string{"browser"}}
 	}
-	path := filepath.Join(w.ModeDir(w.modeID()), FileCapabilities)
+	if strings.TrimSpace(modeID) == "" {
+		modeID = w.modeID()
+	}
+	path := filepath.Join(w.ModeDir(modeID), FileCapabilities)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return Capabilities{MCP: []string{"browser"}}
@@ -3,35 +3,15 @@ package brain
 import (
 	"fmt"
 	"strings"
-	"sync"
 )
 
 // TerminalPathsSystemPrefix 注入 LLM 的路径约定 system 消息前缀（与 llm.log 识别一致）。
 const TerminalPathsSystemPrefix = "【Cata 路径：脑子与产出区】"
 
-var (
-	outputMu       sync.RWMutex
-	activeOutputCwd string
-)
-
-// SetOutputCwd 设置当前请求的产出区目录（cata chat 的 cwd）。
-func SetOutputCwd(cwd string) {
-	outputMu.Lock()
-	activeOutputCwd = strings.TrimSpace(cwd)
-	outputMu.Unlock()
-}
-
-// OutputCwd 返回当前产出区路径。
-func OutputCwd() string {
-	outputMu.RLock()
-	defer outputMu.RUnlock()
-	return activeOutputCwd
-}
-
-// TerminalPathsSystemBlock 每轮对话注入的动态路径说明（脑子 vs 产出区）。
-func TerminalPathsSystemBlock() string {
+// PathsSystemBlock 每轮对话注入的动态路径说明（脑子 vs 产出区）。
+func (s *Session) PathsSystemBlock() string {
 	home := CataHome()
-	out := OutputCwd()
+	out := s.OutputCwd()
 	var b strings.Builder
 	b.WriteString(TerminalPathsSystemPrefix)
 	b.WriteString("\n\n")
@@ -39,10 +19,11 @@ func TerminalPathsSystemBlock() string {
 	b.WriteString("- **脑子（Brain）**：`")
 	b.WriteString(home)
 	b.WriteString("/`（CATA_HOME）。记忆、persona、short-term、evolution_log 只在脑子目录；**禁止**把用户项目交付物写入脑子。\n")
-	b.WriteString("- **产出区（Output）**：当前工作目录。`read_file` / `search_replace` / `append_file` / `run_command`、构建与交付物**只**在产出区。\n")
+	b.WriteString("- **产出区（Output）**：`cata chat --dir` 指定的目录（默认当前目录）。`list_dir` / `glob` / `search_files` / `read_file` / `search_replace` / `apply_patch` / `write_file` / `append_file` / `run_command`、构建与交付物**只**在产出区。\n")
+	b.WriteString("- 相对路径按**主产出区**解析；访问其他产出区请用其下的绝对路径（`run_command` 可传 `cwd` 切换目录）。\n")
 	b.WriteString("- 项目内 `.cata/workspace.yaml` 仅是**门牌**（绑定哪一格脑子），不是脑子正文。\n\n")
 	b.WriteString("## 当前绑定\n\n")
-	if w := Active(); w != nil {
+	if w := s.Workspace; w != nil {
 		b.WriteString("- 脑子分区目录：`")
 		b.WriteString(w.Dir())
 		b.WriteString("`\n")
@@ -55,11 +36,19 @@ func TerminalPathsSystemBlock() string {
 	if out != "" {
 		b.WriteString("- 产出区 output_cwd：`")
 		b.WriteString(out)
-		b.WriteString("`\n")
+		b.WriteString("`（主产出区）\n")
+		for _, d := range s.OutputDirs {
+			if d == out {
+				continue
+			}
+			b.WriteString("- 附加产出区：`")
+			b.WriteString(d)
+			b.WriteString("`\n")
+		}
 	} else {
 		b.WriteString("- 产出区 output_cwd：（未知）\n")
 	}
-	env := ActiveRuntimeEnv()
+	env := s.Env()
 	b.WriteString("\n## 运行环境（run_command 必遵）\n\n")
 	b.WriteString(fmt.Sprintf("- llm_os（命令语法）：`%s`  host_os（二进制）：`%s`  arch：`%s`\n",
 		env.OS, env.HostOS, env.Arch))
@@ -75,9 +64,9 @@ func TerminalPathsSystemBlock() string {
 		b.WriteString(fmt.Sprintf("- 产出区 WSL 路径：`%s`\n", WSLPathForOutput(out)))
 	}
 	b.WriteString("\n")
-	b.WriteString(env.runCommandHints())
+	b.WriteString(env.runCommandHints(out))
 	b.WriteString("\n执行工具或建议写文件时，默认针对 **产出区**；引用 persona/约束时读取 **脑子** 下已注入节选。\n")
-	b.WriteString("改文件优先 **read_file** → **search_replace** / **append_file**；跑命令用 **run_command**。禁止只写代码块或 XML 假装已执行。\n")
+	b.WriteString("找文件用 **list_dir** / **glob**、搜内容用 **search_files**（遵循 .gitignore，勿用 run_command grep）；改文件优先 **read_file** → **search_replace**，一处以上或跨文件的修改用 **apply_patch**（unified diff）；新建或整体重写用 **write_file**（覆盖前先读）；跑命令用 **run_command**。禁止只写代码块或 XML 假装已执行。\n")
 	return b.String()
 }
 
@@ -26,6 +26,10 @@ const (
 	RelShortCurrent       = "memory/short/current.md"
 	RelMemoryLong         = "memory/long"
 	RelMemoryArchive      = "memory/archive"
+	RelChatSessions       = "sessions"
+	RelUsageLedger        = "usage.jsonl"
+	RelAuditLog           = "audit.jsonl"
+	RelCheckpoints        = "checkpoints"
 
 	DirModes        = "modes"
 	ModeDefaultID   = "_default"
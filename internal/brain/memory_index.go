@@ -99,9 +99,9 @@ func SaveMemoryIndexFor(w *Workspace, idx *MemoryIndex) error {
 	return os.WriteFile(w.MemoryIndexPath(), data, 0644)
 }
 
-// SyncMemoryIndexAfterEvolution 根据本轮演进 touched 文件、learning 与归档路径更新索引。
-func SyncMemoryIndexAfterEvolution(touched []string, learning, archivedRel string) error {
-	idx, err := LoadMemoryIndex()
+// SyncMemoryIndexAfterEvolution 根据本轮演进 touched 文件、learning 与归档路径更新 w 的索引。
+func SyncMemoryIndexAfterEvolution(w *Workspace, touched []string, learning, archivedRel string) error {
+	idx, err := LoadMemoryIndexFor(w)
 	if err != nil {
 		return err
 	}
@@ -114,7 +114,7 @@ func SyncMemoryIndexAfterEvolution(touched []string, learning, archivedRel strin
 			continue
 		}
 		seen[rel] = true
-		entry, ok := indexEntryFromFile(rel, now)
+		entry, ok := indexEntryFromFile(w, rel, now)
 		if !ok {
 			continue
 		}
@@ -132,11 +132,9 @@ func SyncMemoryIndexAfterEvolution(touched []string, learning, archivedRel strin
 			UpdatedAt:       now,
 			Keywords:        []string{"archive", "short-term", "session"},
 		}
-		if w := Active(); w != nil {
-			if b, err := os.ReadFile(w.Path(arch)); err == nil {
-				entry.Summary = truncateRunes(firstLineSummary(string(b)), maxIndexSummaryRunes)
-				entry.Keywords = extractKeywords(string(b), arch)
-			}
+		if b, err := os.ReadFile(w.Path(arch)); err == nil {
+			entry.Summary = truncateRunes(firstLineSummary(string(b)), maxIndexSummaryRunes)
+			entry.Keywords = extractKeywords(string(b), arch)
 		}
 		idx.Upsert(entry)
 	}
@@ -154,15 +152,13 @@ func SyncMemoryIndexAfterEvolution(touched []string, learning, archivedRel strin
 			UpdatedAt:       now,
 		})
 		// 可选：把 learning 落盘，便于按需 read
-		if w := Active(); w != nil {
-			p := w.Path(RelMemoryLong + "/learnings/" + id + ".md")
-			_ = os.MkdirAll(filepath.Dir(p), 0755)
-			_ = os.WriteFile(p, []byte("# Evolution learning\n\n"+learn+"\n"), 0644)
-		}
+		p := w.Path(RelMemoryLong + "/learnings/" + id + ".md")
+		_ = os.MkdirAll(filepath.Dir(p), 0755)
+		_ = os.WriteFile(p, []byte("# Evolution learning\n\n"+learn+"\n"), 0644)
 	}
 
 	idx.Prune(maxIndexEntries)
-	return SaveMemoryIndex(idx)
+	return SaveMemoryIndexFor(w, idx)
 }
 
 // Upsert 按 source 或 id 替换/追加条目。
@@ -199,12 +195,15 @@ func (idx *MemoryIndex) Prune(max int) {
 	idx.Entries = entries[:max]
 }
 
-// MemoryIndexPromptBlock 注入对话的紧凑索引（不含全文）。
-func MemoryIndexPromptBlock(maxBytes int) string {
+// MemoryIndexPromptBlock 注入对话的紧凑索引（不含全文）；w 为 nil 时为空。
+func MemoryIndexPromptBlock(w *Workspace, maxBytes int) string {
+	if w == nil {
+		return ""
+	}
 	if maxBytes <= 0 {
 		maxBytes = maxIndexPromptBytes
 	}
-	idx, err := LoadMemoryIndex()
+	idx, err := LoadMemoryIndexFor(w)
 	if err != nil || len(idx.Entries) == 0 {
 		return ""
 	}
@@ -245,8 +244,7 @@ func (idx *MemoryIndex) entriesByPriority() []IndexEntry {
 	return out
 }
 
-func indexEntryFromFile(rel, updatedAt string) (IndexEntry, bool) {
-	w := Active()
+func indexEntryFromFile(w *Workspace, rel, updatedAt string) (IndexEntry, bool) {
 	if w == nil {
 		return IndexEntry{}, false
 	}
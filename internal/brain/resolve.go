@@ -1,17 +1,15 @@
 package brain
 
 import (
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"unicode"
 
 	"cata/internal/clock"
-	"cata/internal/config"
 )
 
-// ResolveWorkspace 用产出区 cwd 解析脑子分区（focus_path），并设置 exec 产出目录。
+// ResolveWorkspace 用产出区 cwd 解析脑子分区（focus_path）并登记 registry；不修改进程级状态。
 func ResolveWorkspace(clientCwd string) (*Workspace, error) {
 	if err := EnsureCataLayout(); err != nil {
 		return nil, err
@@ -28,8 +26,6 @@ func ResolveWorkspace(clientCwd string) (*Workspace, error) {
 	if err != nil {
 		return nil, err
 	}
-	SetOutputCwd(outputCwd)
-	syncOutputDir(outputCwd)
 
 	focus, kind, err := resolveFocusPath(outputCwd)
 	if err != nil {
@@ -52,8 +48,6 @@ func ResolveWorkspace(clientCwd string) (*Workspace, error) {
 		_ = ws.EnsureScaffold()
 		touchRegistryEntry(ent.ID)
 		_ = upsertRegistryEntry(workspaceToEntry(ws))
-		SetActive(ws)
-		log.Printf("cata binding: %s", LogBinding())
 		return ws, nil
 	}
 
@@ -83,19 +77,9 @@ func ResolveWorkspace(clientCwd string) (*Workspace, error) {
 	}); err != nil {
 		return nil, err
 	}
-	SetActive(ws)
-	log.Printf("cata binding: %s", LogBinding())
 	return ws, nil
 }
 
-// syncOutputDir 将 config 的 brain.base_dir 设为产出区（run_command cwd）。
-func syncOutputDir(outputCwd string) {
-	if config.Config != nil {
-		config.Config.Brain.BaseDir = outputCwd
-	}
-	config.BrainBaseDir = outputCwd
-}
-
 // workspaceID 从 root 路径生成可读标识（参考 Claude 的 ~/.claude/projects/<id> 命名）。
 // Windows: D--project-mybot
 // Unix:    home-user-project
@@ -3,7 +3,6 @@ package brain
 import (
 	"fmt"
 	"strings"
-	"sync"
 )
 
 // RuntimeEnv 描述产出区所在机器与终端（由 cata chat 每轮上报，注入 LLM）。
@@ -18,42 +17,12 @@ type RuntimeEnv struct {
 	Terminal  string `json:"terminal,omitempty"`
 }
 
-var (
-	runtimeMu     sync.RWMutex
-	activeRuntime *RuntimeEnv
-)
-
-// SetRuntimeEnv 设置当前 chat 请求的运行环境。
-func SetRuntimeEnv(env *RuntimeEnv) {
-	runtimeMu.Lock()
-	defer runtimeMu.Unlock()
-	if env == nil {
-		activeRuntime = nil
-		return
-	}
-	c := *env
-	activeRuntime = &c
-}
-
-// ActiveRuntimeEnv 返回当前会话运行环境。
-func ActiveRuntimeEnv() *RuntimeEnv {
-	runtimeMu.RLock()
-	defer runtimeMu.RUnlock()
-	if activeRuntime == nil {
-		e := DetectRuntimeEnvFromProcess()
-		return &e
-	}
-	out := *activeRuntime
-	return &out
-}
-
 // DetectLocalRuntimeEnv 兼容旧名。
 func DetectLocalRuntimeEnv() RuntimeEnv {
 	return DetectRuntimeEnvFromProcess()
 }
 
-func (e *RuntimeEnv) runCommandHints() string {
-	out := OutputCwd()
+func (e *RuntimeEnv) runCommandHints(out string) string {
 	var b strings.Builder
 
 	switch {
@@ -96,13 +65,12 @@ func (e *RuntimeEnv) runCommandHints() string {
 	return b.String()
 }
 
-// ShellLineToArgv 将模型给出的一行 shell 命令转为 argv（与当前 RuntimeEnv 一致）。
-func ShellLineToArgv(line string) []string {
+// ShellLineToArgv 将模型给出的一行 shell 命令转为 argv（与该 RuntimeEnv 一致）。
+func (e *RuntimeEnv) ShellLineToArgv(line string) []string {
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return nil
 	}
-	e := ActiveRuntimeEnv()
 	if e == nil {
 		return []string{"cmd.exe", "/c", line}
 	}
@@ -135,9 +103,9 @@ func ShellLineToArgv(line string) []string {
 	}
 }
 
-// RunCommandToolDescription 根据运行环境生成 run_command 工具说明。
-func RunCommandToolDescription() string {
-	e := ActiveRuntimeEnv()
+// RunCommandToolDescription 根据会话运行环境生成 run_command 工具说明。
+func (s *Session) RunCommandToolDescription() string {
+	e := s.Env()
 	verb := "cmd.exe /c"
 	if e.IsWSL() || e.Shell == "bash" && e.OS == "linux" {
 		verb = "bash -lc"
@@ -150,21 +118,6 @@ func RunCommandToolDescription() string {
 		"Run in output cwd (NOT ~/.cata). LLM-facing os=%s host_os=%s shell=%s terminal=%s. "+
 			"Use API tool_calls argv[]; typical wrapper: %s. Blacklist hits need confirm. %s",
 		e.OS, e.HostOS, e.Shell, e.Terminal, verb,
-		strings.ReplaceAll(e.runCommandHints(), "\n", " "),
+		strings.ReplaceAll(e.runCommandHints(s.OutputCwd()), "\n", " "),
 	)
 }
-
-// LogBinding 记录脑子与产出区绑定。
-func LogBinding() string {
-	w := Active()
-	env := ActiveRuntimeEnv()
-	envS := ""
-	if env != nil {
-		envS = fmt.Sprintf(" llm_os=%s shell=%s term=%s", env.OS, env.Shell, env.Terminal)
-	}
-	if w == nil {
-		return fmt.Sprintf("brain_home=%s output_cwd=%s%s", CataHome(), OutputCwd(), envS)
-	}
-	return fmt.Sprintf("brain_id=%s brain_dir=%s focus_path=%s output_cwd=%s%s",
-		w.ID, w.Dir(), w.FocusPath(), OutputCwd(), envS)
-}
@@ -0,0 +1,126 @@
+package brain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"cata/internal/config"
+)
+
+// Session 一条 cata chat 连接（或一次演进周期）的脑子绑定：脑子分区、产出区、运行环境与 mode。
+// 由调用方持有并经 context 传递，不再写进程级状态，因此并发会话与后台演进互不覆盖。
+type Session struct {
+	Workspace *Workspace
+	// OutputDirs 产出区（绝对路径）；OutputDirs[0] 为主产出区
+	OutputDirs []string
+	// Runtime 客户端上报的运行环境；nil 时按 server 进程探测
+	Runtime *RuntimeEnv
+	// Mode 活跃 mode；空时取 Workspace.ActiveMode
+	Mode string
+}
+
+type sessionCtxKey struct{}
+
+// WithSession 将会话放入 ctx（工具、LLM 上下文组装、演进均从 ctx 取）。
+func WithSession(ctx context.Context, s *Session) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sessionCtxKey{}, s)
+}
+
+// SessionFrom 返回 ctx 中的会话；没有时按进程级绑定（CLI 单会话）构造。
+func SessionFrom(ctx context.Context) *Session {
+	if ctx != nil {
+		if s, ok := ctx.Value(sessionCtxKey{}).(*Session); ok && s != nil {
+			return s
+		}
+	}
+	s := &Session{Workspace: Active()}
+	if base := config.GetBrainBaseDir(); base != "" {
+		s.OutputDirs = []string{base}
+	}
+	return s
+}
+
+// NewSession 用主产出区解析脑子分区并构造会话（不修改任何全局状态）。
+func NewSession(outputDirs []string, env *RuntimeEnv) (*Session, error) {
+	var dirs []string
+	for _, d := range outputDirs {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, abs)
+	}
+	s := &Session{OutputDirs: dirs}
+	if env != nil {
+		c := *env
+		s.Runtime = &c
+	}
+	ws, err := ResolveWorkspace(s.OutputCwd())
+	if err != nil {
+		return s, err
+	}
+	s.Workspace = ws
+	s.Mode = ws.ActiveMode
+	if len(s.OutputDirs) == 0 {
+		s.OutputDirs = []string{ws.FocusPath()}
+	}
+	log.Printf("cata binding: %s", s.LogBinding())
+	return s, nil
+}
+
+// OutputCwd 主产出区；未知时为空。
+func (s *Session) OutputCwd() string {
+	if s == nil || len(s.OutputDirs) == 0 {
+		return ""
+	}
+	return s.OutputDirs[0]
+}
+
+// Env 返回运行环境（未上报时探测 server 进程）。
+func (s *Session) Env() *RuntimeEnv {
+	if s == nil || s.Runtime == nil {
+		e := DetectRuntimeEnvFromProcess()
+		return &e
+	}
+	return s.Runtime
+}
+
+// ModeID 当前会话 mode。
+func (s *Session) ModeID() string {
+	if s != nil && strings.TrimSpace(s.Mode) != "" {
+		return s.Mode
+	}
+	if s != nil && s.Workspace != nil {
+		return s.Workspace.modeID()
+	}
+	return ModeDefaultID
+}
+
+// Capabilities 读取会话 mode 的 capabilities.yaml。
+func (s *Session) Capabilities() Capabilities {
+	if s == nil || s.Workspace == nil {
+		return LoadCapabilitiesFor(nil, "")
+	}
+	return LoadCapabilitiesFor(s.Workspace, s.ModeID())
+}
+
+// LogBinding 记录脑子与产出区绑定。
+func (s *Session) LogBinding() string {
+	env := s.Env()
+	envS := fmt.Sprintf(" llm_os=%s shell=%s term=%s", env.OS, env.Shell, env.Terminal)
+	out := strings.Join(s.OutputDirs, ",")
+	if s.Workspace == nil {
+		return fmt.Sprintf("brain_home=%s output_dirs=%s%s", CataHome(), out, envS)
+	}
+	return fmt.Sprintf("brain_id=%s brain_dir=%s focus_path=%s mode=%s output_dirs=%s%s",
+		s.Workspace.ID, s.Workspace.Dir(), s.Workspace.FocusPath(), s.ModeID(), out, envS)
+}
@@ -44,6 +44,11 @@ func AppendSessionBoundary() error {
 	if err != nil {
 		return err
 	}
+	return AppendSessionBoundaryFor(w)
+}
+
+// AppendSessionBoundaryFor 向指定 workspace 写入会话边界。
+func AppendSessionBoundaryFor(w *Workspace) error {
 	path := w.ShortTermPath()
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
@@ -142,10 +147,9 @@ func EnsureShortTermFileFor(w *Workspace) error {
 
 // FinalizeShortTermAfterConsolidate 将当前 short-term 归档到 memory/long/ 并重置文件，避免演进重复喂同一段原文。
 // keepRecentBytes 为 0 时使用 DefaultKeepRecentAfterConsolidate。
-func FinalizeShortTermAfterConsolidate(keepRecentBytes int) (archivedRel string, err error) {
-	w, err := MustActive()
-	if err != nil {
-		return "", err
+func FinalizeShortTermAfterConsolidate(w *Workspace, keepRecentBytes int) (archivedRel string, err error) {
+	if w == nil {
+		return "", fmt.Errorf("no workspace")
 	}
 	if keepRecentBytes <= 0 {
 		keepRecentBytes = DefaultKeepRecentAfterConsolidate
@@ -27,12 +27,12 @@ type RunSkillArgs struct {
 }
 
 // ResolveSkillDir workspace 脑子优先，其次 ~/.cata/skills/。
-func ResolveSkillDir(skillID string) (dir string, err error) {
+func ResolveSkillDir(w *Workspace, skillID string) (dir string, err error) {
 	skillID = strings.TrimSpace(skillID)
 	if skillID == "" {
 		return "", fmt.Errorf("skill name required")
 	}
-	if w := Active(); w != nil {
+	if w != nil {
 		p := w.SkillDir(skillID)
 		if _, e := os.Stat(filepath.Join(p, FileSkillManifest)); e == nil {
 			return p, nil
@@ -78,9 +78,10 @@ func LoadSkillManifest(dir string) (*SkillManifest, error) {
 	return m, nil
 }
 
-// RunSkill 在产出区 cwd 执行脑子内脚本。
+// RunSkill 在会话主产出区执行脑子内脚本（会话取自 ctx）。
 func RunSkill(ctx context.Context, args RunSkillArgs) (string, error) {
-	dir, err := ResolveSkillDir(args.Skill)
+	sess := SessionFrom(ctx)
+	dir, err := ResolveSkillDir(sess.Workspace, args.Skill)
 	if err != nil {
 		return "", err
 	}
@@ -92,7 +93,7 @@ func RunSkill(ctx context.Context, args RunSkillArgs) (string, error) {
 	if _, err := os.Stat(entry); err != nil {
 		return "", fmt.Errorf("entry %s: %w", manifest.Entry, err)
 	}
-	wd, err := skillOutputCwd()
+	wd, err := skillOutputCwd(sess)
 	if err != nil {
 		return "", err
 	}
@@ -101,8 +102,8 @@ func RunSkill(ctx context.Context, args RunSkillArgs) (string, error) {
 		return "", err
 	}
 	to := 120 * time.Second
-	if config.Config != nil && config.Config.Exec.TimeoutSeconds > 0 {
-		to = time.Duration(config.Config.Exec.TimeoutSeconds) * time.Second
+	if cfg := config.Current(); cfg != nil && cfg.Exec.TimeoutSeconds > 0 {
+		to = time.Duration(cfg.Exec.TimeoutSeconds) * time.Second
 	}
 	xctx, cancel := context.WithTimeout(ctx, to)
 	defer cancel()
@@ -110,8 +111,8 @@ func RunSkill(ctx context.Context, args RunSkillArgs) (string, error) {
 	cmd.Dir = wd
 	outb, err := cmd.CombinedOutput()
 	maxB := 256 * 1024
-	if config.Config != nil && config.Config.Exec.MaxOutputBytes > 0 {
-		maxB = config.Config.Exec.MaxOutputBytes
+	if cfg := config.Current(); cfg != nil && cfg.Exec.MaxOutputBytes > 0 {
+		maxB = cfg.Exec.MaxOutputBytes
 	}
 	trunc := false
 	if len(outb) > maxB {
@@ -128,11 +129,16 @@ func RunSkill(ctx context.Context, args RunSkillArgs) (string, error) {
 	return fmt.Sprintf("run_skill %s ok (cwd=%s)\n%s", args.Skill, wd, text), nil
 }
 
-func skillOutputCwd() (string, error) {
-	if config.Config != nil && strings.TrimSpace(config.Config.Exec.WorkingDir) != "" {
-		return filepath.Abs(config.Config.Exec.WorkingDir)
+func skillOutputCwd(sess *Session) (string, error) {
+	base := sess.OutputCwd()
+	if cfg := config.Current(); cfg != nil && strings.TrimSpace(cfg.Exec.WorkingDir) != "" {
+		wd := cfg.Exec.WorkingDir
+		if base != "" && !filepath.IsAbs(wd) {
+			return filepath.Join(base, wd), nil
+		}
+		return filepath.Abs(wd)
 	}
-	if base := config.GetBrainBaseDir(); base != "" {
+	if base != "" {
 		return filepath.Abs(base)
 	}
 	return os.Getwd()
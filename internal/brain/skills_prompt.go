@@ -16,7 +16,7 @@ const (
 )
 
 // SkillsPromptBlock 将 capabilities 中的 skill 名对应的 SKILL.md 拼成 system 段。
-func SkillsPromptBlock(skillNames []string) string {
+func SkillsPromptBlock(w *Workspace, skillNames []string) string {
 	if len(skillNames) == 0 {
 		return ""
 	}
@@ -27,7 +27,7 @@ func SkillsPromptBlock(skillNames []string) string {
 		if name == "" {
 			continue
 		}
-		body, path, err := loadSkillMarkdown(name)
+		body, path, err := loadSkillMarkdown(w, name)
 		if err != nil {
 			blocks = append(blocks, fmt.Sprintf("## skill:%s\n(load failed: %v)", name, err))
 			continue
@@ -49,8 +49,8 @@ func SkillsPromptBlock(skillNames []string) string {
 	return SkillsSystemPrefix + "\n\n" + strings.Join(blocks, "\n\n")
 }
 
-func loadSkillMarkdown(name string) (body, from string, err error) {
-	for _, p := range skillSearchPaths(name) {
+func loadSkillMarkdown(w *Workspace, name string) (body, from string, err error) {
+	for _, p := range skillSearchPaths(w, name) {
 		data, e := os.ReadFile(p)
 		if e == nil {
 			return CompactExcessiveNewlines(strings.TrimSpace(string(data))), p, nil
@@ -65,9 +65,9 @@ func loadSkillMarkdown(name string) (body, from string, err error) {
 	return "", "", fmt.Errorf("SKILL.md not found for %q", name)
 }
 
-func skillSearchPaths(name string) []string {
+func skillSearchPaths(w *Workspace, name string) []string {
 	var paths []string
-	if w := Active(); w != nil {
+	if w != nil {
 		paths = append(paths, w.SkillMarkdownPath(name))
 	}
 	paths = append(paths, GlobalSkillMarkdownPath(name))
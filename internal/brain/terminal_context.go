@@ -3,6 +3,7 @@ package brain
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -33,8 +34,8 @@ func CompactExcessiveNewlines(s string) string {
 	return b.String()
 }
 
-// TerminalBrainSystemExtension 注入 global 约束/行为 + mode persona + persona.local。
-func TerminalBrainSystemExtension(maxPerFile, maxTotal int) string {
+// BrainSystemExtension 注入路径块 + global 约束/行为 + 会话 mode persona + persona.local。
+func (s *Session) BrainSystemExtension(maxPerFile, maxTotal int) string {
 	if maxPerFile <= 0 {
 		maxPerFile = 6500
 	}
@@ -53,10 +54,11 @@ func TerminalBrainSystemExtension(maxPerFile, maxTotal int) string {
 	if p := GlobalBehaviorPath(); fileExists(p) {
 		sections = append(sections, struct{ title, path string }{"global/behavior", p})
 	}
-	if w := Active(); w != nil {
-		if p := w.PersonaPath(); fileExists(p) {
+	if w := s.Workspace; w != nil {
+		mode := s.ModeID()
+		if p := filepath.Join(w.ModeDir(mode), FilePersona); fileExists(p) {
 			sections = append(sections, struct{ title, path string }{
-				fmt.Sprintf("mode/%s/persona", w.modeID()), p,
+				fmt.Sprintf("mode/%s/persona", mode), p,
 			})
 		}
 		if p := w.PersonaLocalPath(); fileExists(p) {
@@ -88,11 +90,11 @@ func TerminalBrainSystemExtension(maxPerFile, maxTotal int) string {
 		used += len(block)
 	}
 	body := strings.Join(blocks, "\n\n")
-	paths := TerminalPathsSystemBlock()
+	paths := s.PathsSystemBlock()
 	skills := ""
-	if w := Active(); w != nil {
-		caps := LoadActiveCapabilities()
-		skills = SkillsPromptBlock(caps.Skills)
+	if w := s.Workspace; w != nil {
+		caps := s.Capabilities()
+		skills = SkillsPromptBlock(w, caps.Skills)
 	}
 	var b strings.Builder
 	b.WriteString(paths)
@@ -100,7 +102,7 @@ func TerminalBrainSystemExtension(maxPerFile, maxTotal int) string {
 		b.WriteString("\n\n")
 		b.WriteString(skills)
 	}
-	if idx := MemoryIndexPromptBlock(maxIndexPromptBytes); strings.TrimSpace(idx) != "" {
+	if idx := MemoryIndexPromptBlock(s.Workspace, maxIndexPromptBytes); strings.TrimSpace(idx) != "" {
 		b.WriteString("\n\n")
 		b.WriteString(idx)
 	}
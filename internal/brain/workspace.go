@@ -81,6 +81,26 @@ func (w *Workspace) MemoryIndexPath() string {
 	return filepath.Join(w.Dir(), RelMemoryIndex)
 }
 
+// ChatSessionsDir 持久化的 chat 会话（每个会话一个 <id>.jsonl，可 --resume）。
+func (w *Workspace) ChatSessionsDir() string {
+	return filepath.Join(w.Dir(), RelChatSessions)
+}
+
+// UsageLedgerPath 模型调用用量台账（每次调用一行 JSON）。
+func (w *Workspace) UsageLedgerPath() string {
+	return filepath.Join(w.Dir(), RelUsageLedger)
+}
+
+// AuditLogPath 工具执行审计日志（每次执行一行 JSON，只追加）。
+func (w *Workspace) AuditLogPath() string {
+	return filepath.Join(w.Dir(), RelAuditLog)
+}
+
+// CheckpointsDir 文件修改检查点（每个 chat 会话一个子目录，见 internal/checkpoint）。
+func (w *Workspace) CheckpointsDir() string {
+	return filepath.Join(w.Dir(), RelCheckpoints)
+}
+
 // Path 工作区内的相对路径。
 func (w *Workspace) Path(rel string) string {
 	return filepath.Join(w.Dir(), filepath.FromSlash(rel))
@@ -0,0 +1,292 @@
+// Package checkpoint agent 文件修改的检查点：每个 chat 回合首次修改某文件前保存其原内容（新建的文件记为不存在），
+// 按会话存成栈，/undo、/restore 据此回退。存储在脑子分区下：
+// checkpoints/<session>/<id>/meta.json（protocol.CheckpointInfo）与 files/<n>（Files[n] 的原内容）。
+// run_command 等外部命令改动的文件不在记录范围内。
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"cata/internal/brain"
+	"cata/internal/clock"
+	"cata/internal/protocol"
+)
+
+const (
+	// MaxSnapshotBytes 超过此大小的文件无法保存快照，Snapshot 报错，工具拒绝修改它
+	MaxSnapshotBytes = 8 << 20
+	// MaxPerSession 每个会话保留的检查点数，超出时删除最旧的
+	MaxPerSession = 50
+)
+
+func sessionDir(ws *brain.Workspace, session string) string {
+	return filepath.Join(ws.CheckpointsDir(), session)
+}
+
+// Turn 一个回合的检查点；第一次 Snapshot 时才落盘，没有改文件的回合不留检查点。方法对 nil 安全。
+type Turn struct {
+	mu     sync.Mutex
+	ws     *brain.Workspace
+	dir    string
+	info   protocol.CheckpointInfo
+	seen   map[string]bool
+	failed error
+}
+
+// Begin 开始记录 session 的一个回合；ws 或 session 为空时返回 nil（不记录）。
+func Begin(ws *brain.Workspace, session, prompt string) *Turn {
+	if ws == nil || session == "" {
+		return nil
+	}
+	return &Turn{
+		ws:   ws,
+		info: protocol.CheckpointInfo{Session: session, Prompt: prompt},
+		seen: map[string]bool{},
+	}
+}
+
+// Snapshot 在修改 full（绝对路径）之前调用：本回合第一次遇到该文件时保存其当前内容。
+// 失败时返回错误，调用方应放弃这次修改（否则将无法撤销）。
+func (t *Turn) Snapshot(full string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen[full] {
+		return nil
+	}
+	if t.failed != nil {
+		return t.failed
+	}
+	f := protocol.CheckpointFile{Path: full}
+	st, err := os.Stat(full)
+	switch {
+	case os.IsNotExist(err):
+		f.Created = true
+	case err != nil:
+		return fmt.Errorf("checkpoint: %w", err)
+	case st.IsDir():
+		return fmt.Errorf("checkpoint: %s is a directory", full)
+	case st.Size() > MaxSnapshotBytes:
+		return fmt.Errorf("checkpoint: %s is larger than %d bytes and cannot be snapshotted for undo", full, MaxSnapshotBytes)
+	}
+	if t.dir == "" {
+		if err := t.create(); err != nil {
+			t.failed = fmt.Errorf("checkpoint: %w", err)
+			return t.failed
+		}
+	}
+	if !f.Created {
+		f.Bytes, f.Mode = st.Size(), uint32(st.Mode().Perm())
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		blob := filepath.Join(t.dir, "files", strconv.Itoa(len(t.info.Files)))
+		if err := os.WriteFile(blob, data, 0600); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+	t.info.Files = append(t.info.Files, f)
+	if err := writeMeta(t.dir, t.info); err != nil {
+		t.info.Files = t.info.Files[:len(t.info.Files)-1]
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	t.seen[full] = true
+	return nil
+}
+
+// ID 本回合检查点的 id（还没有文件被修改时为空）。
+func (t *Turn) ID() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.info.ID
+}
+
+// create 分配会话内递增的 id 并建目录，顺带清理超出 MaxPerSession 的旧检查点。
+func (t *Turn) create() error {
+	base := sessionDir(t.ws, t.info.Session)
+	ids, err := listIDs(base)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	dir := filepath.Join(base, strconv.Itoa(next))
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0755); err != nil {
+		return err
+	}
+	for len(ids) >= MaxPerSession {
+		_ = os.RemoveAll(filepath.Join(base, strconv.Itoa(ids[0])))
+		ids = ids[1:]
+	}
+	t.dir = dir
+	t.info.ID = strconv.Itoa(next)
+	t.info.CreatedAt = clock.RFC3339()
+	return nil
+}
+
+func writeMeta(dir string, info protocol.CheckpointInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "meta.json.tmp")
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "meta.json"))
+}
+
+// listIDs 会话目录下的检查点 id（升序）。
+func listIDs(base string) ([]int, error) {
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		if n, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() && n > 0 {
+			ids = append(ids, n)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// List session 的检查点（从旧到新）；meta 损坏或为空的跳过。
+func List(ws *brain.Workspace, session string) ([]protocol.CheckpointInfo, error) {
+	if ws == nil || session == "" {
+		return nil, nil
+	}
+	base := sessionDir(ws, session)
+	ids, err := listIDs(base)
+	if err != nil {
+		return nil, err
+	}
+	var out []protocol.CheckpointInfo
+	for _, id := range ids {
+		data, err := os.ReadFile(filepath.Join(base, strconv.Itoa(id), "meta.json"))
+		if err != nil {
+			continue
+		}
+		var info protocol.CheckpointInfo
+		if json.Unmarshal(data, &info) != nil || len(info.Files) == 0 {
+			continue
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// Restore 撤销检查点 id 及其后的所有回合（id 为空时只撤销最近一个）：从新到旧把文件恢复到各回合修改前，
+// 回合中新建的文件删除；成功恢复的检查点随之删除。
+func Restore(ws *brain.Workspace, session, id string) (protocol.CheckpointRestore, error) {
+	var res protocol.CheckpointRestore
+	list, err := List(ws, session)
+	if err != nil {
+		return res, err
+	}
+	if len(list) == 0 {
+		return res, fmt.Errorf("no checkpoints in this session")
+	}
+	from := len(list) - 1
+	if id != "" {
+		from = -1
+		for i, c := range list {
+			if c.ID == id {
+				from = i
+			}
+		}
+		if from < 0 {
+			return res, fmt.Errorf("checkpoint %s not found (see /checkpoints)", id)
+		}
+	}
+	base := sessionDir(ws, session)
+	restored, removed := map[string]bool{}, map[string]bool{}
+	for i := len(list) - 1; i >= from; i-- {
+		c := list[i]
+		dir := filepath.Join(base, c.ID)
+		ok := true
+		for n, f := range c.Files {
+			if err := restoreFile(dir, n, f); err != nil {
+				res.Failed = append(res.Failed, fmt.Sprintf("%s: %v", f.Path, err))
+				ok = false
+				continue
+			}
+			// 更早的检查点会覆盖同一文件，最终状态以最早的为准
+			if f.Created {
+				removed[f.Path], restored[f.Path] = true, false
+			} else {
+				restored[f.Path], removed[f.Path] = true, false
+			}
+		}
+		// 有文件没能恢复时保留该检查点，修好原因后可再次 /restore
+		if !ok {
+			continue
+		}
+		_ = os.RemoveAll(dir)
+		res.Checkpoints = append(res.Checkpoints, c.ID)
+	}
+	for p, ok := range restored {
+		if ok {
+			res.Restored = append(res.Restored, p)
+		}
+	}
+	for p, ok := range removed {
+		if ok {
+			res.Removed = append(res.Removed, p)
+		}
+	}
+	sort.Strings(res.Restored)
+	sort.Strings(res.Removed)
+	return res, nil
+}
+
+func restoreFile(dir string, n int, f protocol.CheckpointFile) error {
+	if f.Created {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "files", strconv.Itoa(n)))
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(f.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	tmp := f.Path + ".cata-restore"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, f.Path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cata/internal/brain"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	t.Setenv("CATA_HOME", t.TempDir())
+	ws := &brain.Workspace{ID: "test"}
+	out := t.TempDir()
+	a := filepath.Join(out, "a.txt")
+	b := filepath.Join(out, "sub", "b.txt")
+	if err := os.WriteFile(a, []byte("v1\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	write := func(p, s string) {
+		t.Helper()
+		_ = os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(s), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 回合 1：改 a；回合 2：再改 a 并新建 b；回合 3 不改文件
+	t1 := Begin(ws, "s1", "first")
+	for i := 0; i < 2; i++ {
+		if err := t1.Snapshot(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(a, "v2\n")
+	t2 := Begin(ws, "s1", "second")
+	_ = t2.Snapshot(a)
+	write(a, "v3\n")
+	_ = t2.Snapshot(b)
+	write(b, "new\n")
+	_ = Begin(ws, "s1", "third")
+
+	list, err := List(ws, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "1" || len(list[0].Files) != 1 || len(list[1].Files) != 2 || !list[1].Files[1].Created {
+		t.Fatalf("list = %+v", list)
+	}
+
+	res, err := Restore(ws, "s1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(a); string(got) != "v2\n" {
+		t.Fatalf("after undo a = %q", got)
+	}
+	if _, err := os.Stat(b); !os.IsNotExist(err) {
+		t.Fatalf("after undo b still exists (%v); res %+v", err, res)
+	}
+
+	write(a, "v4\n")
+	if _, err := Restore(ws, "s1", "1"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(a)
+	st, _ := os.Stat(a)
+	if string(got) != "v1\n" || st.Mode().Perm() != 0640 {
+		t.Fatalf("after restore 1 a = %q mode %v", got, st.Mode().Perm())
+	}
+	if list, _ := List(ws, "s1"); len(list) != 0 {
+		t.Fatalf("checkpoints left after restore: %+v", list)
+	}
+	if _, err := Restore(ws, "s1", ""); err == nil {
+		t.Fatal("restore with no checkpoints should fail")
+	}
+}
+
+func TestRestoreKeepsFailedCheckpoint(t *testing.T) {
+	t.Setenv("CATA_HOME", t.TempDir())
+	ws := &brain.Workspace{ID: "test"}
+	out := t.TempDir()
+	c := filepath.Join(out, "sub", "c.txt")
+	_ = os.MkdirAll(filepath.Dir(c), 0755)
+	if err := os.WriteFile(c, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Begin(ws, "s1", "edit").Snapshot(c); err != nil {
+		t.Fatal(err)
+	}
+	// sub 被换成普通文件：c.txt 无法写回
+	_ = os.RemoveAll(filepath.Dir(c))
+	if err := os.WriteFile(filepath.Dir(c), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Restore(ws, "s1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Failed) != 1 || len(res.Checkpoints) != 0 {
+		t.Fatalf("res = %+v", res)
+	}
+	if list, _ := List(ws, "s1"); len(list) != 1 {
+		t.Fatalf("failed checkpoint should be kept, list = %+v", list)
+	}
+}
+
+func TestSnapshotRefusesLargeFile(t *testing.T) {
+	t.Setenv("CATA_HOME", t.TempDir())
+	ws := &brain.Workspace{ID: "test"}
+	big := filepath.Join(t.TempDir(), "big.bin")
+	f, err := os.Create(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(MaxSnapshotBytes + 1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := Begin(ws, "s1", "edit big").Snapshot(big); err == nil {
+		t.Fatal("snapshot of an oversized file succeeded")
+	}
+	if list, err := List(ws, "s1"); err != nil || len(list) != 0 {
+		t.Fatalf("refused snapshot left a checkpoint: %+v %v", list, err)
+	}
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// AskOptions cata ask 命令行参数。
+type AskOptions struct {
+	Dirs   []string
+	Prompt string
+	// Approve / Deny exec_confirm_required / file_confirm_required 自动批准 / 拒绝；都未给时文本模式拒绝，--json 模式等 stdin 回复
+	Approve bool
+	Deny    bool
+	// Choice ask_user 的默认选择：选项 id、1 起的序号或 first；空为取消（--json 模式等 stdin 回复）
+	Choice string
+	// Extend limit_reached 时延长回合（默认收尾总结）
+	Extend bool
+	// JSON --json：事件流写 stdout，stdin 回复确认与选择
+	JSON bool
+}
+
+// ask 退出码：0 成功，1 回合失败，2 参数错误，130 被中断取消。
+const (
+	askExitFailed    = 1
+	askExitUsage     = 2
+	askExitCancelled = 130
+)
+
+// ParseAskArgs 解析 cata ask [flags] [prompt...]；无 prompt 或 prompt 为 - 时从 stdin 读取。
+func ParseAskArgs(args []string, stdin io.Reader) (AskOptions, error) {
+	var opts AskOptions
+	var raw, words []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			words = append(words, args[i+1:]...)
+			i = len(args)
+		case a == "--dir" || a == "-d":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires a directory", a)
+			}
+			i++
+			raw = append(raw, args[i])
+		case strings.HasPrefix(a, "--dir="):
+			raw = append(raw, strings.TrimPrefix(a, "--dir="))
+		case a == "--approve" || a == "--yes" || a == "-y":
+			opts.Approve, opts.Deny = true, false
+		case a == "--deny":
+			opts.Approve, opts.Deny = false, true
+		case a == "--json":
+			opts.JSON = true
+		case a == "--extend":
+			opts.Extend = true
+		case a == "--choice":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--choice requires an option id or number")
+			}
+			i++
+			opts.Choice = args[i]
+		case strings.HasPrefix(a, "--choice="):
+			opts.Choice = strings.TrimPrefix(a, "--choice=")
+		case a != "-" && strings.HasPrefix(a, "-"):
+			return opts, fmt.Errorf("unknown ask argument: %s", a)
+		default:
+			words = append(words, a)
+		}
+	}
+	prompt := strings.TrimSpace(strings.Join(words, " "))
+	if opts.JSON && (prompt == "" || prompt == "-") {
+		return opts, fmt.Errorf("with --json pass the prompt as an argument (stdin carries replies)")
+	}
+	if prompt == "" || prompt == "-" {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return opts, fmt.Errorf("read prompt from stdin: %w", err)
+		}
+		prompt = strings.TrimSpace(string(b))
+	}
+	if prompt == "" {
+		return opts, fmt.Errorf("empty prompt (pass it as an argument or on stdin)")
+	}
+	opts.Prompt = prompt
+	dirs, err := resolveOutputDirs(raw)
+	if err != nil {
+		return opts, err
+	}
+	opts.Dirs = dirs
+	return opts, nil
+}
+
+// RunAsk 非交互单轮：cata ask "prompt"。最终回复写 stdout，工具进度写 stderr。
+// 不加产出区锁（脚本 / git hook 可与交互 chat 并存）。
+func RunAsk(args []string) {
+	if err := config.InitBrainPath(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(askExitFailed)
+	}
+	opts, err := ParseAskArgs(args, os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata ask:", err)
+		os.Exit(askExitUsage)
+	}
+	if err := EnsureServer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(askExitFailed)
+	}
+	s, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(askExitFailed)
+	}
+	var code int
+	if opts.JSON {
+		code = s.askJSON(opts)
+	} else {
+		code = s.ask(opts)
+	}
+	_ = s.conn.Close()
+	os.Exit(code)
+}
+
+// ask 发送一轮 chat 并按 opts 自动应答确认与选择；返回退出码。
+func (s *session) ask(opts AskOptions) int {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		// 第一次中断请服务端取消回合；再次中断直接退出
+		<-sigCh
+		askLog("interrupted, cancelling… (again to quit)")
+		_ = s.write(req{Command: protocol.CmdChatCancel})
+		<-sigCh
+		os.Exit(askExitCancelled)
+	}()
+
+	if err := s.write(req{Command: protocol.CmdChat, Text: opts.Prompt, Stream: true, Cwd: opts.Dirs[0], Dirs: opts.Dirs, Runtime: CollectRuntimeEnv()}); err != nil {
+		askLog("error: %v", err)
+		return askExitFailed
+	}
+
+	// answer 当前模型轮次的正文；出现工具调用说明不是最终回复，清空
+	var answer strings.Builder
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			askLog("error: %v", err)
+			return askExitFailed
+		}
+		if len(line) == 0 {
+			continue
+		}
+		ev, err := protocol.Decode(line)
+		if err != nil {
+			askLog("error: %v", err)
+			return askExitFailed
+		}
+		switch ev := ev.(type) {
+		case *protocol.Token:
+			answer.WriteString(ev.Content)
+
+		case *protocol.Progress:
+			if ev.Message != "" {
+				askLog("%s", ev.Message)
+			}
+
+		case *protocol.ToolStart:
+			answer.Reset()
+			if ev.Name != "" {
+				askLog("tool %s", ev.Name)
+			}
+
+		case *protocol.ExecConfirmRequired:
+			line := execLine(ev.CommandLine, ev.Argv)
+			if opts.Approve {
+				askLog("exec %s (auto-approved)", line)
+			} else {
+				askLog("exec %s (auto-denied; pass --approve to allow)", line)
+			}
+			if err := s.write(req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: opts.Approve}); err != nil {
+				askLog("error: %v", err)
+				return askExitFailed
+			}
+
+		case *protocol.FileConfirmRequired:
+			r := req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: opts.Approve}
+			if opts.Approve {
+				askLog("%s %s (+%d -%d, auto-approved)", ev.Tool, ev.Path, ev.Added, ev.Removed)
+			} else {
+				r.Reason = "unattended run without approval"
+				askLog("%s %s (+%d -%d, auto-rejected; pass --approve to allow)", ev.Tool, ev.Path, ev.Added, ev.Removed)
+			}
+			if err := s.write(r); err != nil {
+				askLog("error: %v", err)
+				return askExitFailed
+			}
+
+		case *protocol.FileWritten:
+			askLog("%s", fileWrittenText(ev))
+
+		case *protocol.LimitReached:
+			choice := "stop"
+			if opts.Extend {
+				choice = "extend"
+			}
+			askLog("turn limit reached: %s → %s", limitText(ev), choice)
+			if len(ev.Options) > 0 {
+				if err := s.write(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: []string{choice}}); err != nil {
+					askLog("error: %v", err)
+					return askExitFailed
+				}
+			}
+
+		case *protocol.ExecDone:
+			askLog("exec done: exit %d  %s", ev.ExitCode, execLine(ev.CommandLine, ev.Argv))
+
+		case *protocol.UserChoice:
+			selected := protocol.AskChoice(opts.Choice, ev.Options)
+			askLog("ask_user %q → %s", ev.Prompt, strings.Join(selected, ","))
+			if err := s.write(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: selected}); err != nil {
+				askLog("error: %v", err)
+				return askExitFailed
+			}
+
+		case *protocol.Error:
+			askLog("error: %s", ev.Message)
+
+		case *protocol.Done:
+			if ev.Cancelled {
+				return askExitCancelled
+			}
+			if !ev.Success {
+				return askExitFailed
+			}
+			text := strings.TrimSpace(answer.String())
+			if text != "" {
+				fmt.Fprintln(os.Stdout, text)
+			}
+			return 0
+		}
+	}
+}
+
+// askLog 纯文本进度行（stderr，无 ANSI，便于脚本日志）。
+func askLog(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "cata: "+format+"\n", args...)
+}
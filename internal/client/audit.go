@@ -0,0 +1,183 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// auditDefaultLimit cata audit 默认显示的最近记录数。
+const auditDefaultLimit = 50
+
+// RunAudit cata audit [--since D] [--tool T] [--path P] [--limit N] [--all] [--json]：查询工具执行审计日志。
+func RunAudit(args []string) {
+	r := req{Limit: auditDefaultLimit}
+	asJSON := false
+	value := func(i *int, a, name string) string {
+		if v := strings.TrimPrefix(a, name+"="); v != a {
+			return v
+		}
+		if *i+1 >= len(args) {
+			fmt.Fprintf(os.Stderr, "cata audit: %s requires a value\n", name)
+			os.Exit(2)
+		}
+		*i++
+		return args[*i]
+	}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--json":
+			asJSON = true
+		case a == "--all":
+			r.All = true
+		case a == "--since" || strings.HasPrefix(a, "--since="):
+			t, err := parseSince(value(&i, a, "--since"), time.Now())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "cata audit:", err)
+				os.Exit(2)
+			}
+			r.Since = t.Format(time.RFC3339)
+		case a == "--tool" || strings.HasPrefix(a, "--tool="):
+			r.Tool = value(&i, a, "--tool")
+		case a == "--path" || strings.HasPrefix(a, "--path="):
+			r.Path = auditPathArg(value(&i, a, "--path"))
+		case a == "--limit" || strings.HasPrefix(a, "--limit="):
+			n, err := strconv.Atoi(value(&i, a, "--limit"))
+			if err != nil || n < 0 {
+				fmt.Fprintln(os.Stderr, "cata audit: --limit requires a number (0 for all)")
+				os.Exit(2)
+			}
+			r.Limit = n
+		default:
+			fmt.Fprintf(os.Stderr, "cata audit: unknown argument: %s\n", a)
+			os.Exit(2)
+		}
+	}
+	if err := config.InitBrainPath(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cwd, _ := os.Getwd()
+	r.Cwd = cwd
+	r.Dirs = []string{cwd}
+	r.Runtime = CollectRuntimeEnv()
+	if err := EnsureServer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rep, err := s.fetchAudit(r)
+	_ = s.conn.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if asJSON {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	printAudit(os.Stdout, rep)
+}
+
+// auditPathArg 普通路径按当前目录转为绝对路径；含通配符的按 glob 原样传给 server。
+func auditPathArg(p string) string {
+	if strings.ContainsAny(p, "*?[") {
+		return p
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// fetchAudit 发送 audit 并解码结果。
+func (s *session) fetchAudit(r req) (protocol.AuditReport, error) {
+	var rep protocol.AuditReport
+	if !s.has(protocol.FeatureAuditLog) {
+		return rep, fmt.Errorf("running cata server has no audit log; run `cata restart` to load the new server")
+	}
+	r.Command = protocol.CmdAudit
+	out, err := s.call(r)
+	if err != nil {
+		return rep, err
+	}
+	if !out.Success {
+		return rep, fmt.Errorf("%s", out.Message)
+	}
+	return rep, json.Unmarshal(out.Data, &rep)
+}
+
+func printAudit(w io.Writer, rep protocol.AuditReport) {
+	scope := "workspace " + strings.Join(rep.Workspaces, ", ")
+	if len(rep.Workspaces) != 1 {
+		scope = fmt.Sprintf("%d workspaces", len(rep.Workspaces))
+	}
+	since := "all time"
+	if rep.Since != "" {
+		since = "since " + sessionTime(rep.Since)
+	}
+	fmt.Fprintf(w, "audit (%s, %s): %d matching", scope, since, rep.Matched)
+	if len(rep.Entries) < rep.Matched {
+		fmt.Fprintf(w, ", showing last %d", len(rep.Entries))
+	}
+	fmt.Fprintln(w)
+	for _, e := range rep.Entries {
+		fmt.Fprintf(w, "  %s  %-14s %-14s %6s  %s\n", sessionTime(e.At), e.Tool, auditStatus(e), auditDuration(e.DurationMS), auditTarget(e))
+	}
+}
+
+// auditStatus 退出码 / 确认结果 / 写入量 / 出错的简写。
+func auditStatus(e protocol.AuditEntry) string {
+	var parts []string
+	if e.Approval == "denied" {
+		parts = append(parts, "denied")
+	} else if e.ExitCode != nil {
+		parts = append(parts, fmt.Sprintf("exit %d", *e.ExitCode))
+	}
+	if e.Added > 0 || e.Removed > 0 {
+		parts = append(parts, fmt.Sprintf("+%d -%d", e.Added, e.Removed))
+	}
+	if e.Error != "" {
+		parts = append(parts, "error")
+	}
+	if len(parts) == 0 {
+		return "ok"
+	}
+	return strings.Join(parts, " ")
+}
+
+func auditDuration(ms int64) string {
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.1fs", float64(ms)/1000)
+}
+
+// auditTarget 文件工具显示路径，其余显示参数（截断）。
+func auditTarget(e protocol.AuditEntry) string {
+	if e.Path != "" && len(e.Paths) > 0 {
+		return fmt.Sprintf("%s (+%d more)", e.Path, len(e.Paths))
+	}
+	if e.Path != "" {
+		return e.Path
+	}
+	s := e.Args
+	if len([]rune(s)) > 100 {
+		s = string([]rune(s)[:100]) + "…"
+	}
+	return s
+}
@@ -4,38 +4,44 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 
-	"cata/internal/brain"
 	"cata/internal/config"
 	"cata/internal/execcmd"
+	"cata/internal/protocol"
 )
 
-type req struct {
-	Command   string            `json:"command"`
-	Text      string            `json:"text,omitempty"`
-	Stream    bool              `json:"stream,omitempty"`
-	ConfirmID string            `json:"confirm_id,omitempty"`
-	Approved  bool              `json:"approved,omitempty"`
-	Cwd       string            `json:"cwd,omitempty"`
-	Runtime   *brain.RuntimeEnv `json:"runtime,omitempty"`
-}
+type req = protocol.Request
 
+// resp 命令应答；Data 保留原始 JSON，由调用方按命令解码。
 type resp struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
 type session struct {
 	conn        net.Conn
 	br          *bufio.Reader
+	wmu         sync.Mutex // 流式期间 Ctrl-C 协程与确认回复并发写
 	lastExecCmd string
 	lastExecCwd string
+	// quit 流式期间收到 SIGTERM：本回合取消后退出 REPL
+	quit bool
+	// features hello 协商出的协议特性
+	features []string
+	// sessionID 服务端持久化会话 id（done 事件带回）；断线重连后据此续接
+	sessionID string
+	// tail run_command 运行中的输出尾部
+	tail liveTail
 }
 
 func dial() (*session, error) {
@@ -46,7 +52,36 @@ func dial() (*session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("connect: %w", err)
 	}
-	return &session{conn: conn, br: bufio.NewReader(conn)}, nil
+	s := &session{conn: conn, br: bufio.NewReader(conn)}
+	if err := s.hello(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// hello 与 server 协商协议版本；不兼容时返回错误，避免在流式回合中途才失败。
+func (s *session) hello() error {
+	out, err := s.call(protocol.HelloRequest())
+	if err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	if !out.Success {
+		if strings.HasPrefix(out.Message, "Unknown command") {
+			return fmt.Errorf("cata server is older than this client (no protocol handshake); restart the server and try again")
+		}
+		return fmt.Errorf("incompatible cata server: %s; restart the server with this version of cata", out.Message)
+	}
+	var h protocol.Hello
+	if err := json.Unmarshal(out.Data, &h); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	_, features, err := protocol.Negotiate(h.Version, h.MinVersion, h.Features)
+	if err != nil {
+		return fmt.Errorf("incompatible cata server: %w; restart the server with this version of cata", err)
+	}
+	s.features = features
+	return nil
 }
 
 func (s *session) write(v any) error {
@@ -54,6 +89,8 @@ func (s *session) write(v any) error {
 	if err != nil {
 		return err
 	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
 	_, err = s.conn.Write(append(b, '\n'))
 	return err
 }
@@ -78,18 +115,18 @@ func (s *session) call(r req) (resp, error) {
 	return out, json.Unmarshal(line, &out)
 }
 
-// RunChat 启动终端交互（默认 cata / cata chat）。
-func RunChat() {
+// RunChat 启动终端交互（默认 cata / cata chat [--dir <dir> ...] [--resume [id] | --continue]）。
+func RunChat(args []string) {
 	if err := config.InitBrainPath(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	cwd, err := os.Getwd()
+	opts, err := ParseChatArgs(args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	release, err := AcquireOutputLock(cwd)
+	release, err := acquireOutputLocks(opts.Dirs)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -108,10 +145,40 @@ func RunChat() {
 	}
 	defer s.conn.Close()
 
+	if opts.JSON {
+		if code := s.runJSON(opts); code != 0 {
+			_ = s.conn.Close()
+			release()
+			os.Exit(code)
+		}
+		return
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	welcome()
+	if len(opts.Dirs) > 1 {
+		meta("  %soutput dirs:%s %s\n", ansiDim, ansiReset, strings.Join(opts.Dirs, ", "))
+	}
+	switch {
+	case opts.Continue:
+		if err := s.resumeSession(opts, ""); err != nil {
+			errorMsg(err.Error())
+		}
+	case opts.Resume != "":
+		if err := s.resumeSession(opts, opts.Resume); err != nil {
+			errorMsg(err.Error())
+		}
+	case opts.ResumePick:
+		if id, err := s.pickSession(opts); err != nil {
+			errorMsg(err.Error())
+		} else if id != "" {
+			if err := s.resumeSession(opts, id); err != nil {
+				errorMsg(err.Error())
+			}
+		}
+	}
 
 	for {
 		select {
@@ -130,12 +197,16 @@ func RunChat() {
 		}
 
 		if strings.HasPrefix(line, "/") {
-			cmd := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(line), "/"))
+			fields := strings.Fields(strings.TrimPrefix(line, "/"))
+			cmd, args := "", []string(nil)
+			if len(fields) > 0 {
+				cmd, args = strings.ToLower(fields[0]), fields[1:]
+			}
 			switch cmd {
 			case "exit", "quit", "q":
 				return
 			case "clear", "reset":
-				r, err := s.call(req{Command: "chat_reset"})
+				r, err := s.call(req{Command: protocol.CmdChatReset})
 				if err != nil {
 					errorMsg(err.Error())
 					continue
@@ -144,7 +215,31 @@ func RunChat() {
 					errorMsg(r.Message)
 					continue
 				}
+				s.sessionID = ""
 				progressMsg(r.Message)
+			case "sessions":
+				id, err := s.pickSession(opts)
+				if err != nil {
+					errorMsg(err.Error())
+					continue
+				}
+				if id != "" {
+					if err := s.resumeSession(opts, id); err != nil {
+						errorMsg(err.Error())
+					}
+				}
+			case "cost":
+				s.showCost(opts)
+			case "checkpoints":
+				s.showCheckpoints(opts)
+			case "undo":
+				s.restoreCheckpoint(opts, "")
+			case "restore":
+				if len(args) != 1 {
+					meta("  %susage:%s /restore <id> (see /checkpoints)\n", ansiDim, ansiReset)
+					continue
+				}
+				s.restoreCheckpoint(opts, args[0])
 			case "config":
 				meta("  config: %s%s%s\n", ansiYellow, config.GetConfigPath(), ansiReset)
 			case "cls":
@@ -160,12 +255,16 @@ func RunChat() {
 			continue
 		}
 
-		outCwd, _ := os.Getwd()
-		if err := s.write(req{Command: "chat", Text: line, Stream: true, Cwd: outCwd, Runtime: CollectRuntimeEnv()}); err != nil {
+		if err := s.write(req{Command: protocol.CmdChat, Text: line, Stream: true, Cwd: opts.Dirs[0], Dirs: opts.Dirs, Runtime: CollectRuntimeEnv()}); err != nil {
 			errorMsg(err.Error())
 			continue
 		}
-		if err := s.drainStream(); err != nil {
+		err = s.drainStream(sigCh)
+		if s.quit {
+			meta("\n")
+			return
+		}
+		if err != nil {
 			errorMsg(err.Error())
 			if connLost(err) {
 				meta("  %s提示:%s 连接断开。直接发送下一条消息自动重连。\n", ansiDim, ansiReset)
@@ -174,14 +273,42 @@ func RunChat() {
 				if ns, derr := dial(); derr == nil {
 					s.conn = ns.conn
 					s.br = ns.br
+					s.features = ns.features
 					progressMsg("已重新连接 cata server")
+					if s.sessionID != "" {
+						if err := s.resumeSession(opts, s.sessionID); err != nil {
+							errorMsg(err.Error())
+						}
+					}
 				}
 			}
 		}
 	}
 }
 
-func (s *session) drainStream() error {
+// drainStream 读取一个 chat 回合的事件直到 done；期间 Ctrl-C 发送 chat_cancel，由服务端收尾后仍以 done 结束。
+func (s *session) drainStream(sigCh <-chan os.Signal) error {
+	stop, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(stop)
+		<-exited
+	}()
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-stop:
+				return
+			case sig := <-sigCh:
+				if sig == syscall.SIGTERM {
+					s.quit = true
+				}
+				progressMsg("cancelling…")
+				_ = s.write(req{Command: protocol.CmdChatCancel})
+			}
+		}
+	}()
+
 	firstToken := true
 	for {
 		line, err := s.readLine()
@@ -191,140 +318,137 @@ func (s *session) drainStream() error {
 		if len(line) == 0 {
 			continue
 		}
-		var ev map[string]any
-		if err := json.Unmarshal(line, &ev); err != nil {
+		ev, err := protocol.Decode(line)
+		if err != nil {
 			return err
 		}
-		switch ev["type"] {
-		case "token":
-			c, _ := ev["content"].(string)
-			if c == "" {
+		if _, ok := ev.(*protocol.ToolOutput); !ok && ev != nil {
+			s.tail.clear()
+		}
+		switch ev := ev.(type) {
+		case *protocol.ToolOutput:
+			s.tail.update(ev)
+
+		case *protocol.Token:
+			if ev.Content == "" {
 				continue
 			}
 			if firstToken {
 				firstToken = false
 				outToken("\n")
 			}
-			outToken(c)
+			outToken(ev.Content)
 
-		case "thinking":
-			c, _ := ev["content"].(string)
-			if c != "" {
-				meta("  %s…%s %s%s%s\n", ansiDim, ansiReset, ansiDim, truncate(c, 120), ansiReset)
+		case *protocol.Progress:
+			if ev.Message != "" {
+				progressMsg(ev.Message)
 			}
 
-		case "progress":
-			m, _ := ev["message"].(string)
-			if m != "" {
-				progressMsg(m)
+		case *protocol.ToolStart:
+			if ev.Name != "" {
+				toolStart(ev.Name, ev.Display)
 			}
 
-		case "tool_start":
-			name, _ := ev["name"].(string)
-			display, _ := ev["display"].(string)
-			if name != "" {
-				toolStart(name, display)
+		case *protocol.ToolResult:
+			if ev.Name == "run_command" {
+				runCmdResult(s.lastExecCmd, s.lastExecCwd, ev.Output)
+			} else if ev.Output != "" {
+				toolOutput(ev.Name, ev.Output, ev.Display)
 			}
 
-		case "tool_result":
-			out, _ := ev["output"].(string)
-			name, _ := ev["name"].(string)
-			display, _ := ev["display"].(string)
-			if name == "run_command" {
-				runCmdResult(s.lastExecCmd, s.lastExecCwd, out)
-			} else if out != "" {
-				toolOutput(name, out, display)
+		case *protocol.Diff:
+			if ev.Display != protocol.DisplaySilent {
+				diffBlock(ev.Content)
 			}
 
-		case "file_written":
-			path, _ := ev["path"].(string)
-			bytes, _ := ev["bytes"].(float64)
-			fileWritten(path, int(bytes))
-
-		case "diff":
-			c, _ := ev["content"].(string)
-			if c != "" {
-				diffLine(c)
+		case *protocol.FileWritten:
+			if ev.Display != protocol.DisplaySilent {
+				fileWritten(ev)
 			}
 
-		case "exec_confirm_required":
-			id, _ := ev["confirm_id"].(string)
-			cmd := execLine(ev)
-			cwd, _ := ev["cwd"].(string)
+		case *protocol.ExecConfirmRequired:
+			cmd := execLine(ev.CommandLine, ev.Argv)
 			s.lastExecCmd = cmd
-			s.lastExecCwd = cwd
-			approved, err := confirmPrompt(id, cmd, cwd)
+			s.lastExecCwd = ev.Cwd
+			approved, err := confirmPrompt(ev.ConfirmID, cmd, ev.Cwd)
 			if err != nil {
 				return err
 			}
-			if err := s.write(req{Command: "exec_confirm", ConfirmID: id, Approved: approved}); err != nil {
+			if err := s.write(req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: approved}); err != nil {
 				return err
 			}
 			if !approved {
 				execDenied()
 			}
 
-		case "exec_denied":
+		case *protocol.FileConfirmRequired:
+			r, err := fileConfirmPrompt(ev)
+			if err != nil {
+				return err
+			}
+			if err := s.write(r); err != nil {
+				return err
+			}
+
+		case *protocol.ExecDenied:
 			execDenied()
 
-		case "exec_done":
-			s.lastExecCmd = execLine(ev)
-			if cwd, ok := ev["cwd"].(string); ok {
-				s.lastExecCwd = cwd
+		case *protocol.ExecDone:
+			s.lastExecCmd = execLine(ev.CommandLine, ev.Argv)
+			if ev.Cwd != "" {
+				s.lastExecCwd = ev.Cwd
 			}
-			exitCode := 0
-			if ec, ok := ev["exit_code"].(float64); ok {
-				exitCode = int(ec)
-			}
-			timedOut, _ := ev["timed_out"].(bool)
-			execDone(s.lastExecCmd, exitCode, timedOut)
-
-		case "error":
-			m, _ := ev["message"].(string)
-			errorMsg(m)
-
-		case "user_choice":
-			id, _ := ev["id"].(string)
-			prompt, _ := ev["prompt"].(string)
-			detail, _ := ev["detail"].(string)
-			multi, _ := ev["multi"].(bool)
-			rawOpts, _ := ev["options"].([]any)
-			var opts []SelectOption
-			for _, r := range rawOpts {
-				if m, ok := r.(map[string]any); ok {
-					opts = append(opts, SelectOption{
-						ID:    str(m["id"]),
-						Label: str(m["label"]),
-						Desc:  str(m["desc"]),
-					})
-				}
+			execDone(s.lastExecCmd, ev.ExitCode, ev.TimedOut)
+
+		case *protocol.Error:
+			errorMsg(ev.Message)
+
+		case *protocol.UserChoice:
+			opts := make([]SelectOption, 0, len(ev.Options))
+			for _, o := range ev.Options {
+				opts = append(opts, SelectOption{ID: o.ID, Label: o.Label, Desc: o.Desc})
 			}
-			if id == "" || len(opts) < 2 {
+			if ev.ID == "" || len(opts) < 2 {
 				errorMsg("invalid user_choice event")
 				continue
 			}
 			var selected []string
-			if multi {
-				selected, _ = SelectMulti(prompt, detail, opts)
+			if ev.Multi {
+				selected, _ = SelectMulti(ev.Prompt, ev.Detail, opts)
 			} else {
-				single, _ := Select(prompt, detail, opts)
+				single, _ := Select(ev.Prompt, ev.Detail, opts)
 				if single != "" {
 					selected = []string{single}
 				}
 			}
-			// Send response directly (not via s.write which wraps in req struct)
-			type choiceResp struct {
-				Command  string   `json:"command"`
-				ChoiceID string   `json:"choice_id"`
-				Selected []string `json:"selected"`
+			_ = s.write(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: selected})
+
+		case *protocol.LimitReached:
+			if len(ev.Options) == 0 {
+				progressMsg("turn limit reached: " + limitText(ev) + ", summarizing")
+				continue
+			}
+			opts := make([]SelectOption, 0, len(ev.Options))
+			for _, o := range ev.Options {
+				opts = append(opts, SelectOption{ID: o.ID, Label: o.Label, Desc: o.Desc})
 			}
-			b, _ := json.Marshal(choiceResp{Command: "user_choice", ChoiceID: id, Selected: selected})
-			s.conn.Write(append(b, '\n'))
+			choice, _ := Select("⏸ turn limit reached: "+limitText(ev), "", opts)
+			if choice == "" {
+				choice = "stop"
+			}
+			_ = s.write(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: []string{choice}})
 
-		case "done":
+		case *protocol.Done:
 			firstToken = true
-			success, _ := ev["success"].(bool)
-			if !success {
+			if ev.Session != "" {
+				s.sessionID = ev.Session
+			}
+			if ev.Cancelled {
+				outToken("\n")
+				execDenied()
+				return nil
+			}
+			if !ev.Success {
 				return fmt.Errorf("chat failed")
 			}
 			outToken("\n")
@@ -333,27 +457,20 @@ func (s *session) drainStream() error {
 	}
 }
 
-func execLine(ev map[string]any) string {
-	if s, ok := ev["command_line"].(string); ok && s != "" {
-		return s
-	}
-	argv, ok := ev["argv"].([]any)
-	if !ok {
-		return ""
-	}
-	parts := make([]string, 0, len(argv))
-	for _, a := range argv {
-		if s, ok := a.(string); ok {
-			parts = append(parts, s)
-		}
+func execLine(commandLine string, argv []string) string {
+	if commandLine != "" {
+		return commandLine
 	}
-	return execcmd.FormatLine(parts)
+	return execcmd.FormatLine(argv)
 }
 
 func connLost(err error) bool {
 	if err == nil {
 		return false
 	}
+	if errors.Is(err, io.EOF) {
+		return true
+	}
 	msg := strings.ToLower(err.Error())
 	return strings.Contains(msg, "forcibly closed") ||
 		strings.Contains(msg, "connection reset") ||
@@ -367,8 +484,3 @@ func truncate(s string, n int) string {
 	}
 	return s[:n] + "…"
 }
-
-func str(v any) string {
-	s, _ := v.(string)
-	return s
-}
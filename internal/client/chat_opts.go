@@ -0,0 +1,136 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cata/internal/config"
+)
+
+// ChatOptions cata chat 命令行参数。
+type ChatOptions struct {
+	// Dirs 产出区（绝对路径、去重）；Dirs[0] 为主产出区（brain 分区、相对路径基准）
+	Dirs []string
+	// Resume --resume <id>：启动后载入该会话
+	Resume string
+	// ResumePick --resume 不带 id：启动后列出会话供选择
+	ResumePick bool
+	// Continue --continue：载入最近的会话
+	Continue bool
+	// JSON --json：不进 REPL，事件流写 stdout、请求从 stdin 读（见 runJSON）
+	JSON bool
+}
+
+// ParseChatArgs 解析 cata chat 参数：--dir <dir>（可重复）、--resume [id]、--continue、--json。
+// 未传 --dir 时用 workspace.default_dir，再回退当前目录。
+func ParseChatArgs(args []string) (ChatOptions, error) {
+	var opts ChatOptions
+	var raw []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--dir" || a == "-d":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires a directory", a)
+			}
+			i++
+			raw = append(raw, args[i])
+		case strings.HasPrefix(a, "--dir="):
+			raw = append(raw, strings.TrimPrefix(a, "--dir="))
+		case a == "--resume" || a == "-r":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				opts.Resume = args[i]
+			} else {
+				opts.ResumePick = true
+			}
+		case strings.HasPrefix(a, "--resume="):
+			opts.Resume = strings.TrimPrefix(a, "--resume=")
+		case a == "--continue" || a == "-c":
+			opts.Continue = true
+		case a == "--json":
+			opts.JSON = true
+		default:
+			return opts, fmt.Errorf("unknown chat argument: %s", a)
+		}
+	}
+	if opts.Continue && (opts.Resume != "" || opts.ResumePick) {
+		return opts, fmt.Errorf("--continue and --resume are mutually exclusive")
+	}
+	dirs, err := resolveOutputDirs(raw)
+	if err != nil {
+		return opts, err
+	}
+	opts.Dirs = dirs
+	return opts, nil
+}
+
+// resolveOutputDirs 未传 --dir 时用 workspace.default_dir，再回退当前目录；随后规范化。
+func resolveOutputDirs(raw []string) ([]string, error) {
+	if len(raw) == 0 {
+		if cfg := config.Current(); cfg != nil && strings.TrimSpace(cfg.Workspace.DefaultDir) != "" {
+			raw = []string{cfg.Workspace.DefaultDir}
+		} else {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return nil, err
+			}
+			raw = []string{cwd}
+		}
+	}
+	return normalizeOutputDirs(raw)
+}
+
+// normalizeOutputDirs 展开 ~、转绝对路径并去重；每个须为已存在目录。
+func normalizeOutputDirs(raw []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, d := range raw {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		abs, err := filepath.Abs(config.ExpandHome(d))
+		if err != nil {
+			return nil, err
+		}
+		abs = filepath.Clean(abs)
+		st, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("--dir %s: %w", d, err)
+		}
+		if !st.IsDir() {
+			return nil, fmt.Errorf("--dir %s: not a directory", d)
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		out = append(out, abs)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no output directory")
+	}
+	return out, nil
+}
+
+// acquireOutputLocks 为每个产出区加锁；任一失败则释放已获取的锁。
+func acquireOutputLocks(dirs []string) (release func(), err error) {
+	var releases []func()
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	for _, d := range dirs {
+		r, err := AcquireOutputLock(d)
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releaseAll, nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cata/internal/protocol"
+)
+
+// checkpointsCall 发送 checkpoint 命令并把 Data 解码到 v；旧 server 没有该特性时提示重启。
+func (s *session) checkpointsCall(r req, v any) (string, error) {
+	if !s.has(protocol.FeatureCheckpoints) {
+		return "", fmt.Errorf("running cata server has no checkpoints; run `cata restart` to load the new server")
+	}
+	out, err := s.call(r)
+	if err != nil {
+		return "", err
+	}
+	if !out.Success {
+		return "", fmt.Errorf("%s", out.Message)
+	}
+	return out.Message, json.Unmarshal(out.Data, v)
+}
+
+// showCheckpoints /checkpoints：本会话各回合改过的文件，最新的在最后。
+func (s *session) showCheckpoints(opts ChatOptions) {
+	var list []protocol.CheckpointInfo
+	if _, err := s.checkpointsCall(sessionReq(protocol.CmdCheckpointList, opts), &list); err != nil {
+		errorMsg(err.Error())
+		return
+	}
+	if len(list) == 0 {
+		progressMsg("no checkpoints in this session (they are recorded when the agent edits files)")
+		return
+	}
+	for _, c := range list {
+		meta("  %s%3s%s  %s  %s%s%s\n", ansiBold, c.ID, ansiReset, sessionTime(c.CreatedAt), ansiDim, truncateRunes(c.Prompt, 60), ansiReset)
+		for _, f := range c.Files {
+			note := ""
+			if f.Created {
+				note = " (created)"
+			}
+			meta("       %s%s\n", f.Path, note)
+		}
+	}
+	meta("  %s/undo reverts the last checkpoint; /restore <id> reverts that one and everything after it%s\n", ansiDim, ansiReset)
+}
+
+// restoreCheckpoint /undo（id 为空）与 /restore <id>。
+func (s *session) restoreCheckpoint(opts ChatOptions, id string) {
+	r := sessionReq(protocol.CmdCheckpointRestore, opts)
+	r.Checkpoint = id
+	var res protocol.CheckpointRestore
+	msg, err := s.checkpointsCall(r, &res)
+	if err != nil {
+		errorMsg(err.Error())
+		return
+	}
+	progressMsg(msg)
+	for _, p := range res.Restored {
+		meta("  %s↺%s %s\n", ansiGreen, ansiReset, p)
+	}
+	for _, p := range res.Removed {
+		meta("  %s✕%s %s %s(created by the agent)%s\n", ansiRed, ansiReset, p, ansiDim, ansiReset)
+	}
+	for _, f := range res.Failed {
+		errorMsg("not restored: " + f)
+	}
+}
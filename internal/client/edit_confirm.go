@@ -0,0 +1,99 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"cata/internal/protocol"
+)
+
+// fileConfirmPrompt 展示待确认的文件修改并读取用户的选择：批准、在编辑器里改后批准，或拒绝（可附理由）。
+func fileConfirmPrompt(ev *protocol.FileConfirmRequired) (req, error) {
+	r := req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID}
+	title := fmt.Sprintf("✎ %s %s (+%d -%d)", ev.Tool, ev.Path, ev.Added, ev.Removed)
+	switch {
+	case ev.Deleted:
+		title = fmt.Sprintf("✎ %s delete %s", ev.Tool, ev.Path)
+	case ev.From != "":
+		title = fmt.Sprintf("✎ %s %s → %s (+%d -%d)", ev.Tool, ev.From, ev.Path, ev.Added, ev.Removed)
+	}
+	diffBlock(ev.Diff)
+	opts := make([]SelectOption, 0, len(ev.Options))
+	for _, o := range ev.Options {
+		opts = append(opts, SelectOption{ID: o.ID, Label: o.Label, Desc: o.Desc})
+	}
+	if len(opts) == 0 {
+		opts = []SelectOption{{ID: "approve", Label: "Approve"}, {ID: "reject", Label: "Reject"}}
+	}
+	for {
+		choice, err := Select(title, "this edit needs your approval", opts)
+		if err != nil {
+			return r, err
+		}
+		switch choice {
+		case "approve":
+			r.Approved = true
+			return r, nil
+		case "edit":
+			content, err := editInEditor(ev.Path, ev.Content)
+			if err != nil {
+				errorMsg("edit: " + err.Error())
+				continue
+			}
+			r.Approved, r.EditedContent = true, &content
+			return r, nil
+		}
+		meta("  %sreason for the model (optional, Enter to skip)%s\n", ansiDim, ansiReset)
+		restore, err := rawMode()
+		if err != nil {
+			return r, err
+		}
+		reason, _ := readLineRaw()
+		restore()
+		r.Reason = strings.TrimSpace(reason)
+		execDenied()
+		return r, nil
+	}
+}
+
+// editInEditor 在 $VISUAL / $EDITOR（缺省 vi，Windows 为 notepad）里编辑 content，返回保存后的内容。
+func editInEditor(path, content string) (string, error) {
+	tmp, err := os.CreateTemp("", "cata-edit-*"+filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// 允许带参数，如 "code --wait"
+	argv := append(strings.Fields(editor), tmp.Name())
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", argv[0], err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -16,6 +16,11 @@ var commands = []cmdDef{
 	{Name: "config", Desc: "edit configuration"},
 	{Name: "exit", Aliases: []string{"quit", "q"}, Desc: "exit cata"},
 	{Name: "clear", Aliases: []string{"reset"}, Desc: "reset chat session"},
+	{Name: "sessions", Desc: "list and resume saved sessions"},
+	{Name: "cost", Desc: "token usage and cost for this session and workspace"},
+	{Name: "undo", Desc: "revert the agent's file edits from the last turn"},
+	{Name: "checkpoints", Desc: "list file checkpoints of this session"},
+	{Name: "restore", Desc: "revert file edits back to a checkpoint: /restore <id>"},
 	{Name: "cls", Desc: "clear terminal screen"},
 	{Name: "help", Desc: "show available commands"},
 }
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"cata/internal/protocol"
+)
+
+// --json 模式：服务端 NDJSON 事件逐行原样写 stdout（不带 type 的命令响应补 type=response），
+// stdin 每行一条与 socket 相同格式的请求（{"command":"exec_confirm",...}）转发给服务端，
+// 使编辑器插件 / CI 可完全驱动 cata。事件与请求格式见 README「机器可读输出」。
+
+// jsonOut 串行写 stdout（服务端事件与本地错误来自不同协程）。
+type jsonOut struct {
+	mu sync.Mutex
+}
+
+func (o *jsonOut) line(b []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	os.Stdout.Write(append(b, '\n'))
+}
+
+func (o *jsonOut) event(ev protocol.Event) {
+	b, err := protocol.Encode(ev)
+	if err != nil {
+		return
+	}
+	o.line(b)
+}
+
+// errorf 写出一条本地 error 事件。
+func (o *jsonOut) errorf(format string, args ...any) {
+	o.event(protocol.Error{Message: fmt.Sprintf(format, args...)})
+}
+
+// forward 写出一条服务端行（命令响应补 type=response）；返回解析后的事件，命令响应时 ev 为 nil、isResp 为 true。
+func (o *jsonOut) forward(line []byte) (ev protocol.Event, isResp bool, err error) {
+	var head map[string]any
+	if err := json.Unmarshal(line, &head); err != nil {
+		return nil, false, err
+	}
+	if _, ok := head["type"]; !ok {
+		head["type"] = "response"
+		if b, err := json.Marshal(head); err == nil {
+			o.line(b)
+		}
+		return nil, true, nil
+	}
+	o.line(line)
+	ev, err = protocol.Decode(line)
+	return ev, false, err
+}
+
+// stdinCommands 允许从 stdin 发出的命令及是否等待一条响应（done 或 response）。
+var (
+	askStdinCommands = map[string]bool{
+		protocol.CmdExecConfirm: false, protocol.CmdUserChoice: false, protocol.CmdChatCancel: false,
+	}
+	chatStdinCommands = map[string]bool{
+		protocol.CmdExecConfirm: false, protocol.CmdUserChoice: false, protocol.CmdChatCancel: false,
+		protocol.CmdChat: true, protocol.CmdChatReset: true, protocol.CmdSessionList: true, protocol.CmdSessionResume: true,
+	}
+)
+
+// jsonDriver 一次 --json 运行的共享状态：待回应的请求数与 stdin 是否已关闭。
+type jsonDriver struct {
+	s       *session
+	out     *jsonOut
+	dirs    []string
+	allowed map[string]bool
+	// closeOnEOF stdin 关闭后（无待回应请求时）结束运行；ask 的 stdin 只承载回复，不据此退出
+	closeOnEOF bool
+
+	mu          sync.Mutex
+	pending     int
+	stdinClosed bool
+}
+
+// send 发送请求；chat 请求补上产出区、运行环境与 stream。
+func (d *jsonDriver) send(r req) error {
+	switch r.Command {
+	case protocol.CmdChat, protocol.CmdSessionList, protocol.CmdSessionResume:
+		r.Cwd = d.dirs[0]
+		r.Dirs = d.dirs
+		r.Runtime = CollectRuntimeEnv()
+	}
+	if r.Command == protocol.CmdChat {
+		r.Stream = true
+	}
+	if d.allowed[r.Command] {
+		d.mu.Lock()
+		d.pending++
+		d.mu.Unlock()
+	}
+	return d.s.write(r)
+}
+
+// answered 一条请求得到回应（done / response）；stdin 已关闭且无待回应时返回 true。
+func (d *jsonDriver) answered() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending > 0 {
+		d.pending--
+	}
+	return d.stdinClosed && d.pending == 0
+}
+
+// readStdin 逐行读取 stdin 请求并转发；closeOnEOF 时 EOF 且无待回应请求则关闭连接结束运行。
+func (d *jsonDriver) readStdin() {
+	sc := bufio.NewScanner(os.Stdin)
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var r req
+		if err := json.Unmarshal(line, &r); err != nil {
+			d.out.errorf("stdin: invalid JSON: %v", err)
+			continue
+		}
+		if _, ok := d.allowed[r.Command]; !ok {
+			d.out.errorf("stdin: command %q not allowed here", r.Command)
+			continue
+		}
+		if err := d.send(r); err != nil {
+			d.out.errorf("stdin: %v", err)
+		}
+	}
+	if !d.closeOnEOF {
+		return
+	}
+	d.mu.Lock()
+	d.stdinClosed = true
+	idle := d.pending == 0
+	d.mu.Unlock()
+	if idle {
+		_ = d.s.conn.Close()
+	}
+}
+
+// interruptToCancel Ctrl-C / SIGTERM 时向服务端发送 chat_cancel。
+func (d *jsonDriver) interruptToCancel() func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range sigCh {
+			_ = d.s.write(req{Command: protocol.CmdChatCancel})
+		}
+	}()
+	return func() { signal.Stop(sigCh) }
+}
+
+// runJSON cata chat --json：stdin 请求 → 服务端，服务端事件 → stdout；stdin 关闭且无进行中的请求时退出。
+func (s *session) runJSON(opts ChatOptions) int {
+	if opts.ResumePick {
+		fmt.Fprintln(os.Stderr, "--json: --resume needs a session id")
+		return askExitUsage
+	}
+	d := &jsonDriver{s: s, out: &jsonOut{}, dirs: opts.Dirs, allowed: chatStdinCommands, closeOnEOF: true}
+	defer d.interruptToCancel()()
+	switch {
+	case opts.Continue:
+		_ = d.send(req{Command: protocol.CmdSessionResume})
+	case opts.Resume != "":
+		_ = d.send(req{Command: protocol.CmdSessionResume, Session: opts.Resume})
+	}
+	go d.readStdin()
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			d.mu.Lock()
+			done := d.stdinClosed && d.pending == 0
+			d.mu.Unlock()
+			if done {
+				return 0
+			}
+			d.out.errorf("%v", err)
+			return askExitFailed
+		}
+		if len(line) == 0 {
+			continue
+		}
+		ev, isResp, err := d.out.forward(line)
+		if err != nil {
+			continue
+		}
+		if _, done := ev.(*protocol.Done); done || isResp {
+			if d.answered() {
+				return 0
+			}
+		}
+	}
+}
+
+// askJSON cata ask --json：单轮；确认与选择在未给 --approve/--deny/--choice 时等待 stdin 回复。
+func (s *session) askJSON(opts AskOptions) int {
+	d := &jsonDriver{s: s, out: &jsonOut{}, dirs: opts.Dirs, allowed: askStdinCommands}
+	defer d.interruptToCancel()()
+	go d.readStdin()
+	if err := d.send(req{Command: protocol.CmdChat, Text: opts.Prompt}); err != nil {
+		d.out.errorf("%v", err)
+		return askExitFailed
+	}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			d.out.errorf("%v", err)
+			return askExitFailed
+		}
+		if len(line) == 0 {
+			continue
+		}
+		ev, _, err := d.out.forward(line)
+		if err != nil {
+			continue
+		}
+		switch ev := ev.(type) {
+		case *protocol.ExecConfirmRequired:
+			if opts.Approve || opts.Deny {
+				_ = d.send(req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: opts.Approve})
+			}
+		case *protocol.FileConfirmRequired:
+			if opts.Approve || opts.Deny {
+				_ = d.send(req{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: opts.Approve})
+			}
+		case *protocol.UserChoice:
+			if opts.Choice != "" {
+				_ = d.send(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: protocol.AskChoice(opts.Choice, ev.Options)})
+			}
+		case *protocol.LimitReached:
+			// 给了任一自动应答参数即视为无人值守：--extend 延长，否则收尾
+			if len(ev.Options) > 0 && (opts.Extend || opts.Approve || opts.Deny || opts.Choice != "") {
+				choice := "stop"
+				if opts.Extend {
+					choice = "extend"
+				}
+				_ = d.send(req{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: []string{choice}})
+			}
+		case *protocol.Done:
+			if ev.Cancelled {
+				return askExitCancelled
+			}
+			if !ev.Success {
+				return askExitFailed
+			}
+			return 0
+		}
+	}
+}
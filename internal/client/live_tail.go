@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+const (
+	// liveTailLines run_command 运行中显示的最近输出行数
+	liveTailLines = 5
+	// liveTailWidth 每行最多显示的字符数（避免折行打乱原地重绘）
+	liveTailWidth = 100
+)
+
+// liveTail run_command 运行中的输出尾部：按 tool_output 原地重绘，其他事件渲染前清掉（完整输出随 tool_result 展示）。
+type liveTail struct {
+	toolID  string
+	lines   []string
+	skipped int
+	drawn   int
+}
+
+// update 追加 ev 的输出并重绘。
+func (t *liveTail) update(ev *protocol.ToolOutput) {
+	t.clear()
+	if ev.ToolID != t.toolID {
+		*t = liveTail{toolID: ev.ToolID}
+	}
+	t.skipped += ev.Skipped
+	for _, line := range ev.Lines {
+		line = tailLine(line)
+		if ev.Stream == "stderr" {
+			line = ansiYellow + line + ansiReset
+		}
+		t.lines = append(t.lines, line)
+	}
+	if n := len(t.lines) - liveTailLines; n > 0 {
+		t.lines = t.lines[n:]
+	}
+
+	elapsed := (time.Duration(ev.ElapsedMS) * time.Millisecond).Round(time.Second)
+	head := fmt.Sprintf("running %s", elapsed)
+	if t.skipped > 0 {
+		head += fmt.Sprintf(", %d lines not shown", t.skipped)
+	}
+	meta("  %s⏱ %s%s\n", ansiDim, head, ansiReset)
+	for _, line := range t.lines {
+		meta("  %s│%s %s\n", ansiDim, ansiReset, line)
+	}
+	t.drawn = 1 + len(t.lines)
+}
+
+// clear 擦掉已绘制的尾部（保留已收集的行，下一条 tool_output 接着画）。
+func (t *liveTail) clear() {
+	if t.drawn > 0 {
+		clearSelect(t.drawn)
+		t.drawn = 0
+	}
+}
+
+// tailLine 去掉控制字符、展开 tab 并截断到 liveTailWidth。
+func tailLine(s string) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			continue
+		}
+		if n == liveTailWidth {
+			b.WriteString("…")
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
+
+	"cata/internal/protocol"
 )
 
 // ANSI escape sequences.
@@ -106,15 +109,65 @@ func execDone(cmd string, exitCode int, timedOut bool) {
 	}
 }
 
+// limitText describes a limit_reached event, e.g. "30/30 model rounds".
+func limitText(ev *protocol.LimitReached) string {
+	switch ev.Limit {
+	case protocol.LimitRounds:
+		return fmt.Sprintf("%d/%d model rounds", ev.Used, ev.Max)
+	case protocol.LimitToolCalls:
+		return fmt.Sprintf("%d/%d tool calls", ev.Used, ev.Max)
+	case protocol.LimitTime:
+		return fmt.Sprintf("%s/%s", time.Duration(ev.Used)*time.Second, time.Duration(ev.Max)*time.Second)
+	}
+	return fmt.Sprintf("%s %d/%d", ev.Limit, ev.Used, ev.Max)
+}
+
 // fileWritten renders a file write confirmation.
-func fileWritten(path string, bytes int) {
-	meta("  %s✎%s wrote %s%s%s (%d bytes)\n", ansiGreen, ansiReset, ansiYellow, path, ansiReset, bytes)
+func fileWritten(ev *protocol.FileWritten) {
+	switch {
+	case ev.Deleted:
+		meta("  %s✎%s deleted %s%s%s (%s-%d%s)\n", ansiRed, ansiReset, ansiYellow, ev.Path, ansiReset, ansiRed, ev.Removed, ansiReset)
+	case ev.From != "":
+		meta("  %s✎%s renamed %s → %s%s%s (%d bytes, %s+%d%s %s-%d%s)\n", ansiGreen, ansiReset, ev.From, ansiYellow, ev.Path, ansiReset, ev.Bytes,
+			ansiGreen, ev.Added, ansiReset, ansiRed, ev.Removed, ansiReset)
+	default:
+		meta("  %s✎%s wrote %s%s%s (%d bytes, %s+%d%s %s-%d%s)\n", ansiGreen, ansiReset, ansiYellow, ev.Path, ansiReset, ev.Bytes,
+			ansiGreen, ev.Added, ansiReset, ansiRed, ev.Removed, ansiReset)
+	}
+}
+
+// fileWrittenText file_written 的无颜色描述（ask 日志与 transcript 用）。
+func fileWrittenText(ev *protocol.FileWritten) string {
+	switch {
+	case ev.Deleted:
+		return fmt.Sprintf("deleted %s (-%d)", ev.Path, ev.Removed)
+	case ev.From != "":
+		return fmt.Sprintf("renamed %s → %s (%d bytes, +%d -%d)", ev.From, ev.Path, ev.Bytes, ev.Added, ev.Removed)
+	}
+	return fmt.Sprintf("wrote %s (%d bytes, +%d -%d)", ev.Path, ev.Bytes, ev.Added, ev.Removed)
+}
+
+// diffBlock renders a unified diff, truncated to keep the terminal readable.
+func diffBlock(diff string) {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	const maxLines = 80
+	for i, line := range lines {
+		if i == maxLines {
+			meta("  %s… %d more lines%s\n", ansiDim, len(lines)-maxLines, ansiReset)
+			break
+		}
+		diffLine(line)
+	}
 }
 
 // diffLine renders a single line of a diff.
 func diffLine(content string) {
 	content = strings.TrimRight(content, "\n\r")
-	if strings.HasPrefix(content, "+") {
+	if strings.HasPrefix(content, "+++ ") || strings.HasPrefix(content, "--- ") {
+		meta("  %s%s%s\n", ansiBold, content, ansiReset)
+	} else if strings.HasPrefix(content, "@@") {
+		meta("  %s%s%s\n", ansiCyan, content, ansiReset)
+	} else if strings.HasPrefix(content, "+") {
 		meta("  %s%s%s\n", ansiGreen, content, ansiReset)
 	} else if strings.HasPrefix(content, "-") {
 		meta("  %s%s%s\n", ansiRed, content, ansiReset)
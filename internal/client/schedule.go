@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"cata/internal/clock"
+	"cata/internal/config"
+	"cata/internal/protocol"
+	"cata/internal/schedule"
+)
+
+// 定时任务：cata schedule add / list / logs / rm。任务文件在 $CATA_HOME/schedule，由 server 每分钟检查执行。
+
+// RunSchedule cata schedule <add|list|logs|rm> ...
+func RunSchedule(args []string) {
+	if err := config.InitBrainPath(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		scheduleUsage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "add":
+		err = scheduleAdd(args[1:])
+	case "list", "ls":
+		err = scheduleList(args[1:])
+	case "logs", "log":
+		err = scheduleLogs(args[1:])
+	case "rm", "remove":
+		if len(args) != 2 {
+			scheduleUsage()
+			os.Exit(2)
+		}
+		if err = schedule.Remove(args[1]); err == nil {
+			fmt.Printf("removed scheduled job %s\n", args[1])
+		}
+	default:
+		scheduleUsage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata schedule:", err)
+		os.Exit(1)
+	}
+}
+
+func scheduleUsage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  cata schedule add "<cron>" [--dir D]... [--approve] [--choice <id|n|first>] "prompt"
+  cata schedule list [--json]
+  cata schedule logs [id] [-n N] [--json]
+  cata schedule rm <id>`)
+}
+
+// scheduleAdd 解析 add 参数并保存任务；cron 为第一个非 flag 参数，其余拼为提示词。
+func scheduleAdd(args []string) error {
+	var j schedule.Job
+	var raw, words []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			words = append(words, args[i+1:]...)
+			i = len(args)
+		case a == "--dir" || a == "-d":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a directory", a)
+			}
+			i++
+			raw = append(raw, args[i])
+		case strings.HasPrefix(a, "--dir="):
+			raw = append(raw, strings.TrimPrefix(a, "--dir="))
+		case a == "--approve" || a == "--yes" || a == "-y":
+			j.Approve = true
+		case a == "--deny":
+			j.Approve = false
+		case a == "--choice":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--choice requires an option id or number")
+			}
+			i++
+			j.Choice = args[i]
+		case strings.HasPrefix(a, "--choice="):
+			j.Choice = strings.TrimPrefix(a, "--choice=")
+		case strings.HasPrefix(a, "-"):
+			return fmt.Errorf("unknown schedule add argument: %s", a)
+		case j.Cron == "":
+			j.Cron = a
+		default:
+			words = append(words, a)
+		}
+	}
+	j.Prompt = strings.TrimSpace(strings.Join(words, " "))
+	if j.Cron == "" || j.Prompt == "" {
+		scheduleUsage()
+		os.Exit(2)
+	}
+	dirs, err := resolveOutputDirs(raw)
+	if err != nil {
+		return err
+	}
+	j.Dirs = dirs
+	j, err = schedule.Add(j)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added scheduled job %s (%s) in %s\n", j.ID, j.Cron, strings.Join(j.Dirs, ", "))
+	if next := j.NextRun(clock.Now()); !next.IsZero() {
+		fmt.Printf("next run: %s\n", next.Format("2006-01-02 15:04 Mon"))
+	}
+	scheduleServerNote()
+	return nil
+}
+
+// scheduleServerNote 提示任务只在常驻 server 中执行。
+func scheduleServerNote() {
+	s, err := dialAdmin()
+	if err != nil || s == nil {
+		fmt.Println("note: jobs run inside the cata server, which is not running; start a long-lived one with `cata run`")
+		return
+	}
+	defer s.conn.Close()
+	if !s.has(protocol.FeatureSchedule) {
+		fmt.Println("note: the running cata server predates scheduled jobs; run `cata restart` to load the new server")
+		return
+	}
+	if st, err := s.fetchStatus(); err == nil && st.Managed {
+		fmt.Println("note: the running server was started by `cata chat` and exits with the last chat; use `cata run` to keep jobs running")
+	}
+}
+
+func scheduleList(args []string) error {
+	asJSON := false
+	for _, a := range args {
+		if a != "--json" {
+			return fmt.Errorf("unknown schedule list argument: %s", a)
+		}
+		asJSON = true
+	}
+	jobs, err := schedule.Load()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if jobs == nil {
+			jobs = []schedule.Job{}
+		}
+		b, _ := json.MarshalIndent(jobs, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	if len(jobs) == 0 {
+		fmt.Println("no scheduled jobs (add one with `cata schedule add \"0 9 * * 1-5\" \"prompt\"`)")
+		return nil
+	}
+	last, err := schedule.LastRuns()
+	if err != nil {
+		return err
+	}
+	now := clock.Now()
+	for _, j := range jobs {
+		next := "never"
+		if t := j.NextRun(now); !t.IsZero() {
+			next = t.Format("2006-01-02 15:04 Mon")
+		}
+		fmt.Printf("%s  %-16s next %s\n", j.ID, j.Cron, next)
+		fmt.Printf("    dir    %s\n", strings.Join(j.Dirs, ", "))
+		fmt.Printf("    prompt %s\n", truncateRunes(j.Prompt, 100))
+		if r, ok := last[j.ID]; ok {
+			fmt.Printf("    last   %s  %s\n", sessionTime(r.At), runStatus(r))
+		}
+	}
+	return nil
+}
+
+// scheduleLogs 无 id：最近运行列表；有 id：该任务的运行列表与最近一次的事件流摘要（--json 为原始事件流）。
+func scheduleLogs(args []string) error {
+	var id string
+	n, asJSON := 20, false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--json":
+			asJSON = true
+		case a == "-n" || a == "--limit":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a number", a)
+			}
+			i++
+			v, err := strconv.Atoi(args[i])
+			if err != nil || v <= 0 {
+				return fmt.Errorf("%s requires a positive number", a)
+			}
+			n = v
+		case strings.HasPrefix(a, "-"):
+			return fmt.Errorf("unknown schedule logs argument: %s", a)
+		default:
+			id = a
+		}
+	}
+	runs, err := schedule.Runs(id)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		if id != "" {
+			fmt.Printf("job %s has not run yet\n", id)
+		} else {
+			fmt.Println("no scheduled runs yet")
+		}
+		return nil
+	}
+	latest := runs[len(runs)-1]
+	if asJSON && id != "" {
+		data, err := os.ReadFile(schedule.TranscriptPath(latest.Job, latest.Transcript))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if len(runs) > n {
+		runs = runs[len(runs)-n:]
+	}
+	if asJSON {
+		b, _ := json.MarshalIndent(runs, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, r := range runs {
+		fmt.Printf("%s  %s  %-8s %s\n", sessionTime(r.At), r.Job, auditDuration(r.DurationMS), runStatus(r))
+	}
+	if id == "" {
+		return nil
+	}
+	path := schedule.TranscriptPath(latest.Job, latest.Transcript)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n── %s (%s)\n", sessionTime(latest.At), path)
+	printTranscript(os.Stdout, data)
+	if latest.Session != "" {
+		dir := "<job dir>"
+		if jobs, err := schedule.Load(); err == nil {
+			for _, j := range jobs {
+				if j.ID == latest.Job && len(j.Dirs) > 0 {
+					dir = j.Dirs[0]
+				}
+			}
+		}
+		fmt.Printf("\ncontinue it with: cata chat --dir %s --resume %s\n", dir, latest.Session)
+	}
+	return nil
+}
+
+// runStatus 一次运行的结果简写。
+func runStatus(r schedule.Run) string {
+	switch {
+	case r.Cancelled:
+		return "cancelled"
+	case r.Success && r.Limit != "":
+		return "stopped at " + r.Limit + " limit"
+	case r.Success:
+		return "ok"
+	case r.Error != "":
+		return "failed: " + truncateRunes(r.Error, 80)
+	}
+	return "failed"
+}
+
+// printTranscript 事件流的纯文本摘要：工具与命令、写入、错误，以及最终回复。
+func printTranscript(w io.Writer, data []byte) {
+	var answer strings.Builder
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for sc.Scan() {
+		ev, err := protocol.Decode(sc.Bytes())
+		if err != nil {
+			continue
+		}
+		switch ev := ev.(type) {
+		case *protocol.Token:
+			answer.WriteString(ev.Content)
+		case *protocol.ToolStart:
+			answer.Reset()
+			fmt.Fprintf(w, "  tool %s\n", ev.Name)
+		case *protocol.ExecDone:
+			fmt.Fprintf(w, "  exec done: exit %d  %s\n", ev.ExitCode, execLine(ev.CommandLine, ev.Argv))
+		case *protocol.ExecDenied:
+			fmt.Fprintf(w, "  exec denied: %s\n", ev.CommandLine)
+		case *protocol.FileWritten:
+			fmt.Fprintf(w, "  %s\n", fileWrittenText(ev))
+		case *protocol.LimitReached:
+			fmt.Fprintf(w, "  turn limit reached: %s\n", limitText(ev))
+		case *protocol.Error:
+			fmt.Fprintf(w, "  error: %s\n", ev.Message)
+		}
+	}
+	if text := strings.TrimSpace(answer.String()); text != "" {
+		fmt.Fprintf(w, "\n%s\n", text)
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+// server 管理：cata status / stop / restart。均不自动拉起 server。
+
+// stopWaitTimeout 等待 server 退出（含取消进行中回合、落盘会话）或重启就绪的上限。
+const stopWaitTimeout = 30 * time.Second
+
+// has 协商结果是否含特性 f。
+func (s *session) has(f string) bool {
+	for _, x := range s.features {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+// dialAdmin 连接正在运行的 server；未运行时返回 nil, nil。
+func dialAdmin() (*session, error) {
+	if err := PingServer(); err != nil {
+		return nil, nil
+	}
+	s, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	if !s.has(protocol.FeatureServerControl) {
+		_ = s.conn.Close()
+		return nil, fmt.Errorf("running cata server does not support status/stop/restart; stop it manually (kill the `cata run` process)")
+	}
+	return s, nil
+}
+
+// fetchStatus 发送 status 并解码。
+func (s *session) fetchStatus() (protocol.Status, error) {
+	var st protocol.Status
+	out, err := s.call(req{Command: protocol.CmdStatus})
+	if err != nil {
+		return st, err
+	}
+	if !out.Success {
+		return st, fmt.Errorf("%s", out.Message)
+	}
+	return st, json.Unmarshal(out.Data, &st)
+}
+
+// RunStatus cata status [--json]：server 是否运行、连接的客户端与工作区、MCP、演进。未运行时退出码 1。
+func RunStatus(args []string) {
+	asJSON := false
+	for _, a := range args {
+		switch a {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "cata status: unknown argument: %s\n", a)
+			os.Exit(2)
+		}
+	}
+	s, err := dialAdmin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if s == nil {
+		if asJSON {
+			fmt.Println(`{"running":false}`)
+		} else {
+			fmt.Println("cata server: not running")
+		}
+		os.Exit(1)
+	}
+	st, err := s.fetchStatus()
+	_ = s.conn.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if asJSON {
+		b, _ := json.MarshalIndent(struct {
+			Running bool `json:"running"`
+			protocol.Status
+		}{true, st}, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	printStatus(st)
+}
+
+func printStatus(st protocol.Status) {
+	mode := "foreground"
+	if st.Managed {
+		mode = "managed"
+	}
+	up := ""
+	if t, err := time.Parse(time.RFC3339, st.StartedAt); err == nil {
+		up = ", up " + time.Since(t).Round(time.Second).String()
+	}
+	fmt.Printf("cata server: running (pid %d, %s%s)\n", st.PID, mode, up)
+	fmt.Printf("  socket:     %s\n", st.Socket)
+	fmt.Printf("  protocol:   v%d\n", st.Version)
+
+	fmt.Printf("  clients:    %d\n", len(st.Clients))
+	for _, c := range st.Clients {
+		var parts []string
+		if c.Workspace != "" {
+			parts = append(parts, "workspace "+c.Workspace)
+		}
+		if c.Session != "" {
+			parts = append(parts, "session "+c.Session)
+		}
+		if c.InTurn {
+			parts = append(parts, "in turn")
+		}
+		dirs := strings.Join(c.Dirs, ", ")
+		if dirs == "" {
+			dirs = "(no output dir yet)"
+		}
+		fmt.Printf("    - %s", dirs)
+		if len(parts) > 0 {
+			fmt.Printf("  [%s]", strings.Join(parts, ", "))
+		}
+		fmt.Println()
+	}
+
+	if len(st.Workspaces) > 0 {
+		fmt.Printf("  workspaces:\n")
+		for _, w := range st.Workspaces {
+			last := "never evolved"
+			if w.LastEvolutionAt != "" {
+				last = "last evolution " + sessionTime(w.LastEvolutionAt)
+				if w.LastEvolutionAction != "" {
+					last += " (" + w.LastEvolutionAction + ")"
+				}
+			}
+			fmt.Printf("    - %s  %s  %s\n", w.ID, w.Root, last)
+		}
+	}
+
+	if len(st.MCP) == 0 {
+		fmt.Printf("  mcp:        none connected\n")
+	} else {
+		names := make([]string, 0, len(st.MCP))
+		for _, m := range st.MCP {
+			names = append(names, fmt.Sprintf("%s (%d tools)", m.Name, m.Tools))
+		}
+		fmt.Printf("  mcp:        %s\n", strings.Join(names, ", "))
+	}
+
+	ev := st.Evolution
+	switch {
+	case !ev.Enabled:
+		fmt.Printf("  evolution:  disabled\n")
+	case ev.LastRun == "":
+		fmt.Printf("  evolution:  every %ds, not run yet, next %s\n", ev.IntervalSeconds, sessionTime(ev.NextRun))
+	default:
+		fmt.Printf("  evolution:  every %ds, last %s, next %s\n", ev.IntervalSeconds, sessionTime(ev.LastRun), sessionTime(ev.NextRun))
+	}
+}
+
+// RunStop cata stop：优雅停止 server（进行中的回合被取消，会话落盘）。
+func RunStop(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "cata stop: unknown argument: %s\n", args[0])
+		os.Exit(2)
+	}
+	s, err := dialAdmin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if s == nil {
+		fmt.Println("cata server: not running")
+		return
+	}
+	out, err := s.call(req{Command: protocol.CmdStop})
+	_ = s.conn.Close()
+	if err == nil && !out.Success {
+		err = fmt.Errorf("%s", out.Message)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata stop:", err)
+		os.Exit(1)
+	}
+	fmt.Println(out.Message)
+	deadline := time.Now().Add(stopWaitTimeout)
+	for time.Now().Before(deadline) {
+		if PingServer() != nil {
+			fmt.Println("cata server: stopped")
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "cata stop: server still running after %s\n", stopWaitTimeout)
+	os.Exit(1)
+}
+
+// RunReload cata reload：server 重新读取配置，报告生效的变化（进行中的回合结束后替换）。
+func RunReload(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "cata reload: unknown argument: %s\n", args[0])
+		os.Exit(2)
+	}
+	s, err := dialAdmin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if s == nil {
+		fmt.Println("cata server: not running (config is read when it starts)")
+		return
+	}
+	defer s.conn.Close()
+	if !s.has(protocol.FeatureReload) {
+		fmt.Fprintln(os.Stderr, "cata reload: running server does not support reload; use cata restart")
+		os.Exit(1)
+	}
+	out, err := s.call(req{Command: protocol.CmdReload})
+	if err == nil && !out.Success {
+		err = fmt.Errorf("%s", out.Message)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata reload:", err)
+		os.Exit(1)
+	}
+	var res protocol.Reload
+	_ = json.Unmarshal(out.Data, &res)
+	if len(res.Changes) == 0 {
+		fmt.Printf("cata reload: no changes in %s\n", res.Config)
+		return
+	}
+	fmt.Printf("cata reload: %s\n", out.Message)
+	restart := false
+	for _, c := range res.Changes {
+		note := ""
+		if c.Restart {
+			note = "  (needs cata restart)"
+			restart = true
+		}
+		fmt.Printf("  %s: %s → %s%s\n", c.Key, truncate(c.Old, 60), truncate(c.New, 60), note)
+	}
+	if res.MCPRestarted {
+		fmt.Println("  mcp: servers restarted with the new config")
+	}
+	if restart {
+		fmt.Println("Some settings are only read at startup; run cata restart to apply them.")
+	}
+}
+
+// RunRestart cata restart：优雅停止后以相同参数重新执行 server（重新加载配置）；chat 客户端下一条消息自动重连并续接会话。
+func RunRestart(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "cata restart: unknown argument: %s\n", args[0])
+		os.Exit(2)
+	}
+	s, err := dialAdmin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if s == nil {
+		fmt.Println("cata server: not running (cata chat starts it on demand)")
+		return
+	}
+	before, err := s.fetchStatus()
+	if err != nil {
+		_ = s.conn.Close()
+		fmt.Fprintln(os.Stderr, "cata restart:", err)
+		os.Exit(1)
+	}
+	out, err := s.call(req{Command: protocol.CmdRestart})
+	_ = s.conn.Close()
+	if err == nil && !out.Success {
+		err = fmt.Errorf("%s", out.Message)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata restart:", err)
+		os.Exit(1)
+	}
+	fmt.Println(out.Message)
+	deadline := time.Now().Add(stopWaitTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		ns, err := dialAdmin()
+		if err != nil || ns == nil {
+			continue
+		}
+		st, err := ns.fetchStatus()
+		_ = ns.conn.Close()
+		if err == nil && st.StartedAt != before.StartedAt {
+			fmt.Printf("cata server: restarted (pid %d)\n", st.PID)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "cata restart: server not back after %s (see cata-server.log)\n", stopWaitTimeout)
+	os.Exit(1)
+}
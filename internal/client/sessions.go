@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+// maxSessionChoices /sessions 与 --resume 列出的最近会话数。
+const maxSessionChoices = 20
+
+type sessionInfo struct {
+	ID       string `json:"id"`
+	Updated  string `json:"updated"`
+	Messages int    `json:"messages"`
+	Title    string `json:"title"`
+}
+
+// sessionReq 带上产出区与运行环境的会话请求（服务端据此选脑子分区）。
+func sessionReq(command string, opts ChatOptions) req {
+	return req{Command: command, Cwd: opts.Dirs[0], Dirs: opts.Dirs, Runtime: CollectRuntimeEnv()}
+}
+
+// resumeSession 让服务端载入会话 id（空为最近的会话）作为本连接 history。
+func (s *session) resumeSession(opts ChatOptions, id string) error {
+	r := sessionReq(protocol.CmdSessionResume, opts)
+	r.Session = id
+	out, err := s.call(r)
+	if err != nil {
+		return err
+	}
+	if !out.Success {
+		return fmt.Errorf("%s", out.Message)
+	}
+	var resumed string
+	if json.Unmarshal(out.Data, &resumed) == nil && resumed != "" {
+		s.sessionID = resumed
+	}
+	progressMsg(out.Message)
+	return nil
+}
+
+// pickSession 列出最近会话供选择；返回空 id 表示没有会话或用户取消。
+func (s *session) pickSession(opts ChatOptions) (string, error) {
+	out, err := s.call(sessionReq(protocol.CmdSessionList, opts))
+	if err != nil {
+		return "", err
+	}
+	if !out.Success {
+		return "", fmt.Errorf("%s", out.Message)
+	}
+	var list []sessionInfo
+	if len(out.Data) > 0 {
+		if err := json.Unmarshal(out.Data, &list); err != nil {
+			return "", err
+		}
+	}
+	if len(list) == 0 {
+		progressMsg("no saved sessions")
+		return "", nil
+	}
+	if len(list) > maxSessionChoices {
+		list = list[:maxSessionChoices]
+	}
+	choices := make([]SelectOption, 0, len(list))
+	for _, si := range list {
+		label := si.Title
+		if label == "" {
+			label = si.ID
+		}
+		choices = append(choices, SelectOption{
+			ID:    si.ID,
+			Label: label,
+			Desc:  fmt.Sprintf("%s · %d msgs", sessionTime(si.Updated), si.Messages),
+		})
+	}
+	return Select("Resume session", "", choices)
+}
+
+func sessionTime(rfc string) string {
+	t, err := time.Parse(time.RFC3339, rfc)
+	if err != nil {
+		return rfc
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,301 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+	"cata/internal/tasks"
+)
+
+// 后台 task：cata task submit / list / status / attach / cancel / logs。task 在 server 内运行，不需要客户端在线。
+
+// RunTask cata task <submit|list|status|attach|cancel|logs> ...
+func RunTask(args []string) {
+	if err := config.InitBrainPath(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		taskUsage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "submit", "add":
+		err = taskSubmit(args[1:])
+	case "list", "ls":
+		err = taskList(args[1:])
+	case "status", "attach", "cancel", "logs", "log":
+		var id string
+		asJSON := false
+		for _, a := range args[1:] {
+			switch {
+			case a == "--json" && args[0] != "attach" && args[0] != "cancel":
+				asJSON = true
+			case strings.HasPrefix(a, "-") || id != "":
+				taskUsage()
+				os.Exit(2)
+			default:
+				id = a
+			}
+		}
+		if id == "" {
+			taskUsage()
+			os.Exit(2)
+		}
+		switch args[0] {
+		case "status":
+			err = taskStatus(id, asJSON)
+		case "attach":
+			err = taskAttach(id)
+		case "cancel":
+			err = taskCancel(id)
+		default:
+			err = taskLogs(id, asJSON)
+		}
+	default:
+		taskUsage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cata task:", err)
+		os.Exit(1)
+	}
+}
+
+func taskUsage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  cata task submit [--dir D]... [--approve|--deny] [--choice <id|n|first>] [--extend] "prompt"
+  cata task list [--json]
+  cata task status <id> [--json]
+  cata task attach <id>
+  cata task cancel <id>
+  cata task logs <id> [--json]`)
+}
+
+// taskServer 连接 server（未运行时拉起），要求支持后台 task。
+func taskServer() (*session, error) {
+	if err := EnsureServer(); err != nil {
+		return nil, err
+	}
+	s, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	if !s.has(protocol.FeatureTasks) {
+		_ = s.conn.Close()
+		return nil, fmt.Errorf("running cata server has no background tasks; run `cata restart` to load the new server")
+	}
+	return s, nil
+}
+
+// taskCall 发送一条 task 命令并把 Data 解码到 v。
+func taskCall(r req, v any) (string, error) {
+	s, err := taskServer()
+	if err != nil {
+		return "", err
+	}
+	defer s.conn.Close()
+	out, err := s.call(r)
+	if err != nil {
+		return "", err
+	}
+	if !out.Success {
+		return "", fmt.Errorf("%s", out.Message)
+	}
+	return out.Message, json.Unmarshal(out.Data, v)
+}
+
+// taskSubmit 参数同 cata ask（不含 --json）：确认与选择按给出的策略自动应答，都未给时等待 attach 的客户端。
+func taskSubmit(args []string) error {
+	for _, a := range args {
+		if a == "--json" {
+			return fmt.Errorf("submit has no --json; use `cata task status <id> --json`")
+		}
+	}
+	opts, err := ParseAskArgs(args, os.Stdin)
+	if err != nil {
+		return err
+	}
+	policy := &protocol.TaskPolicy{Choice: opts.Choice, Extend: opts.Extend}
+	if opts.Approve {
+		policy.Exec = "approve"
+	} else if opts.Deny {
+		policy.Exec = "deny"
+	}
+	var info protocol.TaskInfo
+	if _, err := taskCall(req{Command: protocol.CmdTaskSubmit, Text: opts.Prompt, Cwd: opts.Dirs[0], Dirs: opts.Dirs, Runtime: CollectRuntimeEnv(), Policy: policy}, &info); err != nil {
+		return err
+	}
+	fmt.Printf("queued task %s in %s\n", info.ID, strings.Join(info.Dirs, ", "))
+	if info.Policy.Waits() {
+		fmt.Println("confirmations wait for an attached client (pass --approve/--deny/--choice to answer them unattended)")
+	}
+	fmt.Printf("follow it with: cata task attach %s\n", info.ID)
+	if s, err := dialAdmin(); err == nil && s != nil {
+		if st, err := s.fetchStatus(); err == nil && st.Managed {
+			fmt.Println("note: the server was started on demand and exits once its tasks and chats finish")
+		}
+		_ = s.conn.Close()
+	}
+	return nil
+}
+
+// taskList server 未运行时直接读 task 文件。
+func taskList(args []string) error {
+	asJSON := false
+	for _, a := range args {
+		if a != "--json" {
+			return fmt.Errorf("unknown task list argument: %s", a)
+		}
+		asJSON = true
+	}
+	var list []protocol.TaskInfo
+	if s, err := dialAdmin(); err == nil && s != nil && s.has(protocol.FeatureTasks) {
+		_ = s.conn.Close()
+		if _, err := taskCall(req{Command: protocol.CmdTaskList}, &list); err != nil {
+			return err
+		}
+	} else {
+		if s != nil {
+			_ = s.conn.Close()
+		}
+		if list, err = tasks.List(); err != nil {
+			return err
+		}
+	}
+	if asJSON {
+		if list == nil {
+			list = []protocol.TaskInfo{}
+		}
+		b, _ := json.MarshalIndent(list, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	if len(list) == 0 {
+		fmt.Println("no tasks (submit one with `cata task submit \"prompt\"`)")
+		return nil
+	}
+	for _, t := range list {
+		fmt.Printf("%s  %-11s %s  %s\n", t.ID, t.State, sessionTime(t.SubmittedAt), truncateRunes(t.Prompt, 70))
+		if t.Waiting != "" {
+			fmt.Printf("    waiting: %s\n", truncateRunes(t.Waiting, 100))
+		}
+	}
+	return nil
+}
+
+func taskStatus(id string, asJSON bool) error {
+	var info protocol.TaskInfo
+	if s, err := dialAdmin(); err == nil && s != nil && s.has(protocol.FeatureTasks) {
+		_ = s.conn.Close()
+		if _, err := taskCall(req{Command: protocol.CmdTaskStatus, Task: id}, &info); err != nil {
+			return err
+		}
+	} else {
+		if s != nil {
+			_ = s.conn.Close()
+		}
+		if info, err = tasks.Load(id); err != nil {
+			return err
+		}
+	}
+	if asJSON {
+		b, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	fmt.Printf("task %s: %s\n", info.ID, info.State)
+	fmt.Printf("  dir        %s\n", strings.Join(info.Dirs, ", "))
+	fmt.Printf("  prompt     %s\n", truncateRunes(info.Prompt, 100))
+	fmt.Printf("  submitted  %s\n", sessionTime(info.SubmittedAt))
+	if info.StartedAt != "" {
+		fmt.Printf("  started    %s\n", sessionTime(info.StartedAt))
+	}
+	if info.FinishedAt != "" {
+		fmt.Printf("  finished   %s\n", sessionTime(info.FinishedAt))
+	}
+	if info.Attached > 0 {
+		fmt.Printf("  attached   %d client(s)\n", info.Attached)
+	}
+	if info.Waiting != "" {
+		fmt.Printf("  waiting    %s (answer with `cata task attach %s`)\n", info.Waiting, info.ID)
+	}
+	if info.Limit != "" {
+		fmt.Printf("  stopped at %s limit\n", info.Limit)
+	}
+	if info.Error != "" {
+		fmt.Printf("  error      %s\n", info.Error)
+	}
+	if info.Session != "" && len(info.Dirs) > 0 {
+		fmt.Printf("  continue   cata chat --dir %s --resume %s\n", info.Dirs[0], info.Session)
+	}
+	return nil
+}
+
+// taskAttach 回放已有事件后实时跟随，确认与选择在本终端应答；Ctrl-C 只断开（task 继续运行）。
+func taskAttach(id string) error {
+	s, err := taskServer()
+	if err != nil {
+		return err
+	}
+	defer s.conn.Close()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		fmt.Fprintf(os.Stderr, "\ndetached; task %s keeps running (reattach with `cata task attach %s`)\n", id, id)
+		os.Exit(0)
+	}()
+	if err := s.write(req{Command: protocol.CmdTaskAttach, Task: id}); err != nil {
+		return err
+	}
+	if err := s.drainStream(nil); err != nil && !strings.Contains(err.Error(), "chat failed") {
+		return err
+	}
+	var info protocol.TaskInfo
+	if _, err := taskCall(req{Command: protocol.CmdTaskStatus, Task: id}, &info); err == nil {
+		fmt.Printf("task %s: %s\n", info.ID, info.State)
+	}
+	return nil
+}
+
+func taskCancel(id string) error {
+	var info protocol.TaskInfo
+	msg, err := taskCall(req{Command: protocol.CmdTaskCancel, Task: id}, &info)
+	if err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	return nil
+}
+
+// taskLogs 事件流摘要（--json 为原始事件流）；直接读 task 文件，不需要 server。
+func taskLogs(id string, asJSON bool) error {
+	info, err := tasks.Load(id)
+	if err != nil {
+		return err
+	}
+	path := tasks.TranscriptPath(info.ID)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if asJSON {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	fmt.Printf("task %s: %s (%s)\n", info.ID, info.State, path)
+	if len(data) == 0 {
+		fmt.Println("  no events yet")
+		return nil
+	}
+	printTranscript(os.Stdout, data)
+	return nil
+}
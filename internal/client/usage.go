@@ -0,0 +1,190 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// 用量台账：cata usage 与 chat 内的 /cost。
+
+// parseSince 解析 --since：相对时长（30m、24h、7d、2w）、日期（2006-01-02，本地零点）或 RFC3339。
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		if v, err := strconv.Atoi(s[:n-1]); err == nil && v >= 0 {
+			days := v
+			if s[n-1] == 'w' {
+				days *= 7
+			}
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (e.g. 24h, 7d, 2w, 2026-10-01)", s)
+}
+
+// fetchUsage 发送 usage 并解码报表。
+func (s *session) fetchUsage(r req) (protocol.UsageReport, error) {
+	var rep protocol.UsageReport
+	if !s.has(protocol.FeatureUsageLedger) {
+		return rep, fmt.Errorf("running cata server has no usage ledger; run `cata restart` to load the new server")
+	}
+	r.Command = protocol.CmdUsage
+	out, err := s.call(r)
+	if err != nil {
+		return rep, err
+	}
+	if !out.Success {
+		return rep, fmt.Errorf("%s", out.Message)
+	}
+	return rep, json.Unmarshal(out.Data, &rep)
+}
+
+// RunUsage cata usage [--since D] [--all] [--json]：当前目录（或全部）脑子分区的 token 用量与费用。
+func RunUsage(args []string) {
+	var r req
+	asJSON := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--json":
+			asJSON = true
+		case a == "--all":
+			r.All = true
+		case a == "--since" || strings.HasPrefix(a, "--since="):
+			v := strings.TrimPrefix(a, "--since=")
+			if a == "--since" {
+				if i+1 >= len(args) {
+					fmt.Fprintln(os.Stderr, "cata usage: --since requires a value")
+					os.Exit(2)
+				}
+				i++
+				v = args[i]
+			}
+			t, err := parseSince(v, time.Now())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "cata usage:", err)
+				os.Exit(2)
+			}
+			r.Since = t.Format(time.RFC3339)
+		default:
+			fmt.Fprintf(os.Stderr, "cata usage: unknown argument: %s\n", a)
+			os.Exit(2)
+		}
+	}
+	if err := config.InitBrainPath(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cwd, _ := os.Getwd()
+	r.Cwd = cwd
+	r.Dirs = []string{cwd}
+	r.Runtime = CollectRuntimeEnv()
+	if err := EnsureServer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rep, err := s.fetchUsage(r)
+	_ = s.conn.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if asJSON {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	printUsage(os.Stdout, rep)
+}
+
+// showCost /cost：本会话与本工作区累计的用量。
+func (s *session) showCost(opts ChatOptions) {
+	rep, err := s.fetchUsage(sessionReq(protocol.CmdUsage, opts))
+	if err != nil {
+		errorMsg(err.Error())
+		return
+	}
+	printUsage(os.Stderr, rep)
+}
+
+func printUsage(w *os.File, rep protocol.UsageReport) {
+	scope := "workspace " + strings.Join(rep.Workspaces, ", ")
+	if len(rep.Workspaces) != 1 {
+		scope = fmt.Sprintf("%d workspaces", len(rep.Workspaces))
+	}
+	since := "all time"
+	if rep.Since != "" {
+		since = "since " + sessionTime(rep.Since)
+	}
+	fmt.Fprintf(w, "usage (%s, %s)\n", scope, since)
+	if rep.Session != nil {
+		fmt.Fprintf(w, "  %-14s %s\n", "this session", usageLine(*rep.Session))
+	}
+	fmt.Fprintf(w, "  %-14s %s\n", "total", usageLine(rep.Total))
+	for _, g := range []struct {
+		title string
+		m     map[string]protocol.UsageTotals
+	}{{"by role", rep.ByRole}, {"by model", rep.ByModel}} {
+		if len(g.m) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(g.m))
+		for k := range g.m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "  %s:\n", g.title)
+		for _, k := range keys {
+			fmt.Fprintf(w, "    %-12s %s\n", k, usageLine(g.m[k]))
+		}
+	}
+	if rep.Total.Unpriced > 0 {
+		fmt.Fprintf(w, "  (%d call(s) without a price; add the model to llm.prices in %s)\n", rep.Total.Unpriced, config.GetConfigPath())
+	}
+}
+
+// usageLine 一组合计的单行摘要。
+func usageLine(t protocol.UsageTotals) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d call(s)  %d tokens (in %d", t.Calls, t.TotalTokens, t.PromptTokens)
+	if t.CachedTokens > 0 {
+		fmt.Fprintf(&b, ", cached %d", t.CachedTokens)
+	}
+	fmt.Fprintf(&b, " / out %d", t.CompletionTokens)
+	if t.ReasoningTokens > 0 {
+		fmt.Fprintf(&b, ", reasoning %d", t.ReasoningTokens)
+	}
+	b.WriteString(")")
+	if t.Calls > t.Unpriced {
+		fmt.Fprintf(&b, "  cost %.4f", t.Cost)
+	}
+	if t.Estimated > 0 {
+		fmt.Fprintf(&b, "  [%d estimated]", t.Estimated)
+	}
+	return b.String()
+}
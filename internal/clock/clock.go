@@ -22,7 +22,12 @@ var (
 func Init(name string) error {
 	mu.Lock()
 	defer mu.Unlock()
+	initLocked(name)
+	return nil
+}
 
+// initLocked 持 mu 调用。
+func initLocked(name string) {
 	if name == "" {
 		name = os.Getenv(EnvTimezone)
 	}
@@ -35,7 +40,6 @@ func Init(name string) error {
 	}
 	loc = l
 	time.Local = l
-	return nil
 }
 
 // Location 返回当前配置的时区。
@@ -43,7 +47,7 @@ func Location() *time.Location {
 	mu.Lock()
 	defer mu.Unlock()
 	if loc == nil {
-		_ = Init("")
+		initLocked("")
 	}
 	return loc
 }
@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"cata/internal/clock"
+	"cata/internal/ignore"
 )
 
 const (
@@ -22,9 +24,21 @@ const (
 var (
 	BrainDir     string
 	BrainBaseDir string
-	Config       *AppConfig
+	// current 当前生效的配置；reload 整体替换指针，读方经 Current 取快照（不要修改快照字段）
+	current atomic.Pointer[AppConfig]
 )
 
+// Current 当前配置（未加载时为 nil）。一个操作内多处读取时取一次快照复用。
+func Current() *AppConfig {
+	return current.Load()
+}
+
+// Set 发布新配置（启动加载与 reload）并按其设置进程时区；已取得旧快照的读方不受影响。
+func Set(cfg *AppConfig) {
+	current.Store(cfg)
+	_ = clock.Init(cfg.Server.Timezone)
+}
+
 // AppConfig 应用配置（主文件：CATA_HOME/config.json）。
 type AppConfig struct {
 	Brain          BrainConfig          `json:"brain"`
@@ -34,6 +48,25 @@ type AppConfig struct {
 	Exec           ExecToolConfig       `json:"exec"`
 	WorkspaceFiles WorkspaceFilesConfig `json:"workspace_files"`
 	MCP            MCPConfig            `json:"mcp"`
+	Workspace      WorkspaceConfig      `json:"workspace"`
+	Turn           TurnConfig           `json:"turn"`
+}
+
+// TurnConfig 单个用户回合（一条消息触发的模型 + 工具循环）的上限；0 取默认值，负数不限。
+// 达到上限时客户端可选择延长（再给一份同样的额度），否则模型不带工具做最后一轮总结。
+type TurnConfig struct {
+	MaxRounds    int `json:"max_rounds"`
+	MaxToolCalls int `json:"max_tool_calls"`
+	MaxSeconds   int `json:"max_seconds"`
+	// LoopWarn 连续相同工具调用 / 相同错误达到该次数起提示模型换思路；LoopPause 达到该次数时暂停询问用户
+	LoopWarn  int `json:"loop_warn"`
+	LoopPause int `json:"loop_pause"`
+}
+
+// WorkspaceConfig cata chat 产出区默认值（未传 --dir 时使用）。
+type WorkspaceConfig struct {
+	// DefaultDir 默认主产出区；空则为当前目录。支持 ~ 前缀。
+	DefaultDir string `json:"default_dir,omitempty"`
 }
 
 // MCPConfig MCP 工具服务（stdio）；默认 browser 使用 @playwright/mcp。
@@ -70,8 +103,39 @@ type LLMConfig struct {
 	Timeout       int               `json:"timeout"`
 	ContextWindow int               `json:"context_window"`
 	// Thinking DeepSeek 思考模式：auto（有 tools 时 disabled）、enabled、disabled
-	Thinking  string `json:"thinking,omitempty"`
-	Enabled   bool   `json:"enabled"`
+	Thinking string `json:"thinking,omitempty"`
+	Enabled  bool   `json:"enabled"`
+	// StreamUsage 流式请求是否带 stream_options.include_usage：auto（默认；端点回 400 时去掉重试并记住）、disabled
+	StreamUsage string `json:"stream_usage,omitempty"`
+	// Prices 按模型名的单价（每百万 token）；"default" 为未列出模型的兜底。未配置时只记 token 不计费。
+	Prices map[string]ModelPrice `json:"prices,omitempty"`
+	// Limits 发往同一 provider 的全局并发与限流（所有会话、task、演进共享）
+	Limits LLMLimits `json:"limits"`
+}
+
+// LLMLimits 每个 provider（按 api_url 主机区分）的请求预算。MaxInFlight 0 取默认 4、负数不限；
+// RequestsPerMinute / TokensPerMinute 0 为不限。交互 chat 优先于后台请求（演进、定时任务、后台 task）。
+type LLMLimits struct {
+	MaxInFlight       int `json:"max_in_flight"`
+	RequestsPerMinute int `json:"requests_per_minute"`
+	TokensPerMinute   int `json:"tokens_per_minute"`
+}
+
+// ModelPrice 每百万 token 的单价（币种由用户自定，用量报表原样相加）。
+type ModelPrice struct {
+	Input float64 `json:"input"`
+	// CachedInput 命中缓存的输入单价；0 时按 Input 计
+	CachedInput float64 `json:"cached_input,omitempty"`
+	Output      float64 `json:"output"`
+}
+
+// PriceFor 返回模型的单价（精确匹配，其次 "default"）。
+func (c LLMConfig) PriceFor(model string) (ModelPrice, bool) {
+	if p, ok := c.Prices[strings.TrimSpace(model)]; ok {
+		return p, true
+	}
+	p, ok := c.Prices["default"]
+	return p, ok
 }
 
 // ServerConfig 服务器配置。
@@ -106,6 +170,10 @@ type WorkspaceFilesConfig struct {
 	Enabled       *bool `json:"enabled,omitempty"`
 	MaxReadBytes  int   `json:"max_read_bytes,omitempty"`
 	MaxWriteBytes int   `json:"max_write_bytes,omitempty"`
+	// RequireConfirm 每次写文件前都展示 diff 等用户确认；ConfirmPaths 只对命中的路径确认
+	// （相对产出区的 glob：不含 / 的匹配任一层的名字，如 *.tf；含 / 的从产出区根匹配，如 migrations/**）
+	RequireConfirm bool     `json:"require_confirm,omitempty"`
+	ConfirmPaths   []string `json:"confirm_paths,omitempty"`
 }
 
 // WorkspaceFilesEnabled 文件工具是否启用（缺省 true）。
@@ -119,8 +187,32 @@ func (c *AppConfig) WorkspaceFilesEnabled() bool {
 	return *c.WorkspaceFiles.Enabled
 }
 
-// LoadConfig 加载配置文件。
+// LoadConfig 加载配置文件并设为当前配置（启动时）：未配置的 brain.base_dir 取项目根或当前目录，并设置 BrainDir / BrainBaseDir。
 func LoadConfig() (*AppConfig, error) {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Brain.BaseDir == "" {
+		if root := FindProjectRoot(); root != "" {
+			cfg.Brain.BaseDir = root
+		} else {
+			wd, err := os.Getwd()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get working directory: %w", err)
+			}
+			cfg.Brain.BaseDir = wd
+		}
+	}
+	BrainDir = cfg.Brain.Dir
+	BrainBaseDir = cfg.Brain.BaseDir
+	Set(cfg)
+	return cfg, nil
+}
+
+// ReadConfig 读取并校验配置文件（含环境变量覆盖），无副作用：不修改当前配置、全局路径与时区；
+// 未配置的 brain.base_dir 保持为空（由 LoadConfig 按启动目录决定）。
+func ReadConfig() (*AppConfig, error) {
 	configPath := getConfigPath()
 	if _, err := os.Stat(configPath); err == nil {
 		data, err := os.ReadFile(configPath)
@@ -135,7 +227,6 @@ func LoadConfig() (*AppConfig, error) {
 		if err := validateAndSetDefaults(&cfg); err != nil {
 			return nil, err
 		}
-		Config = &cfg
 		return &cfg, nil
 	}
 	cfg := getDefaultConfig()
@@ -143,7 +234,6 @@ func LoadConfig() (*AppConfig, error) {
 	if err := validateAndSetDefaults(cfg); err != nil {
 		return nil, err
 	}
-	Config = cfg
 	return cfg, nil
 }
 
@@ -325,15 +415,7 @@ func validateAndSetDefaults(config *AppConfig) error {
 	}
 
 	if strings.TrimSpace(config.Brain.BaseDir) == "" {
-		if root := FindProjectRoot(); root != "" {
-			config.Brain.BaseDir = root
-		} else {
-			wd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("failed to get working directory: %w", err)
-			}
-			config.Brain.BaseDir = wd
-		}
+		config.Brain.BaseDir = ""
 	} else {
 		absBaseDir, err := filepath.Abs(config.Brain.BaseDir)
 		if err != nil {
@@ -342,9 +424,6 @@ func validateAndSetDefaults(config *AppConfig) error {
 		config.Brain.BaseDir = absBaseDir
 	}
 
-	BrainDir = config.Brain.Dir
-	BrainBaseDir = config.Brain.BaseDir
-
 	if config.LLM.Provider == "" {
 		config.LLM.Provider = getDefaultProvider()
 	}
@@ -365,6 +444,7 @@ func validateAndSetDefaults(config *AppConfig) error {
 	normalizeExecConfig(&config.Exec)
 	normalizeWorkspaceFiles(&config.WorkspaceFiles)
 	normalizeMCPConfig(&config.MCP)
+	normalizeTurnConfig(&config.Turn)
 
 	if config.LLM.Enabled && !config.Exec.Enabled {
 		if v := strings.TrimSpace(os.Getenv(EnvExecEnabled)); v == "0" || strings.EqualFold(v, "false") {
@@ -401,7 +481,6 @@ func ensureServerTimezone(cfg *AppConfig) {
 	if strings.TrimSpace(cfg.Server.Timezone) == "" {
 		cfg.Server.Timezone = clock.DefaultTimezone
 	}
-	_ = clock.Init(cfg.Server.Timezone)
 }
 
 func normalizeMCPConfig(m *MCPConfig) {
@@ -436,6 +515,27 @@ func normalizeWorkspaceFiles(w *WorkspaceFilesConfig) {
 	}
 }
 
+func normalizeTurnConfig(t *TurnConfig) {
+	if t == nil {
+		return
+	}
+	if t.MaxRounds == 0 {
+		t.MaxRounds = 30
+	}
+	if t.MaxToolCalls == 0 {
+		t.MaxToolCalls = 80
+	}
+	if t.MaxSeconds == 0 {
+		t.MaxSeconds = 1200
+	}
+	if t.LoopWarn == 0 {
+		t.LoopWarn = 3
+	}
+	if t.LoopPause == 0 {
+		t.LoopPause = 5
+	}
+}
+
 func normalizeExecConfig(e *ExecToolConfig) {
 	if e == nil {
 		return
@@ -495,20 +595,21 @@ func matchesExecWhitelistItem(base, item string) bool {
 
 // CheckExecArgv 黑白名单校验（整条命令行小写子串匹配 blacklist）。
 func CheckExecArgv(argv []string) error {
-	if Config == nil {
+	cfg := Current()
+	if cfg == nil {
 		return fmt.Errorf("config not loaded")
 	}
 	if len(argv) == 0 {
 		return fmt.Errorf("argv required")
 	}
 	line := strings.ToLower(strings.Join(argv, " "))
-	for _, b := range Config.Exec.Blacklist {
+	for _, b := range cfg.Exec.Blacklist {
 		b = strings.ToLower(strings.TrimSpace(b))
 		if b != "" && strings.Contains(line, b) {
 			return fmt.Errorf("command blocked by blacklist")
 		}
 	}
-	wl := Config.Exec.Whitelist
+	wl := cfg.Exec.Whitelist
 	if execAllowAllWhitelist(wl) {
 		return nil
 	}
@@ -526,10 +627,11 @@ func CheckExecArgv(argv []string) error {
 
 // ExecNeedsConfirm require_confirm=true 时每条都确认；否则仅 blacklist 命中时确认。
 func ExecNeedsConfirm(argv []string) bool {
-	if Config == nil {
+	cfg := Current()
+	if cfg == nil {
 		return true
 	}
-	ec := &Config.Exec
+	ec := &cfg.Exec
 	if ec.RequireConfirm {
 		return true
 	}
@@ -543,12 +645,40 @@ func ExecNeedsConfirm(argv []string) bool {
 	return false
 }
 
+// FileEditNeedsConfirm 文件工具修改 rel（相对所在产出区，/ 分隔）前是否需用户确认：
+// require_confirm=true 时都确认；否则 rel 或其任一上级目录命中 confirm_paths 时确认。
+func FileEditNeedsConfirm(rel string) bool {
+	cfg := Current()
+	if cfg == nil {
+		return false
+	}
+	wf := &cfg.WorkspaceFiles
+	if wf.RequireConfirm {
+		return true
+	}
+	segs := strings.Split(rel, "/")
+	for _, pat := range wf.ConfirmPaths {
+		pat = strings.Trim(strings.TrimSpace(pat), "/")
+		if pat == "" {
+			continue
+		}
+		for i := range segs {
+			if strings.Contains(pat, "/") {
+				if ignore.Match(pat, strings.Join(segs[:i+1], "/")) {
+					return true
+				}
+			} else if ignore.Match(pat, segs[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // InitBrainPath 加载配置并解析 brain 与基目录路径。
 func InitBrainPath() error {
-	if Config == nil {
-		var err error
-		Config, err = LoadConfig()
-		if err != nil {
+	if Current() == nil {
+		if _, err := LoadConfig(); err != nil {
 			return err
 		}
 	}
@@ -557,7 +687,7 @@ func InitBrainPath() error {
 
 // GetBrainDir 脑子目录（CATA_HOME/brain 或覆盖）。
 func GetBrainDir() string {
-	if Config == nil {
+	if Current() == nil {
 		InitBrainPath()
 	}
 	if BrainDir == "" {
@@ -568,7 +698,7 @@ func GetBrainDir() string {
 
 // GetBrainBaseDir 产出区/工作区根（brain.base_dir）。
 func GetBrainBaseDir() string {
-	if Config == nil {
+	if Current() == nil {
 		InitBrainPath()
 	}
 	if BrainBaseDir == "" {
@@ -582,6 +712,22 @@ func GetBrainBaseDir() string {
 	return BrainBaseDir
 }
 
+// ExpandHome 将 ~ 或 ~/ 前缀展开为用户主目录。
+func ExpandHome(p string) string {
+	p = strings.TrimSpace(p)
+	if p != "~" && !strings.HasPrefix(p, "~/") && !strings.HasPrefix(p, `~\`) {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return p
+	}
+	if p == "~" {
+		return home
+	}
+	return filepath.Join(home, p[2:])
+}
+
 // GetBrainPath 脑子目录下的相对路径。
 func GetBrainPath(relPath string) string {
 	return filepath.Join(GetBrainDir(), relPath)
@@ -592,8 +738,8 @@ func ResolvedSocketPath() string {
 	if err := InitBrainPath(); err != nil {
 		return filepath.Join(CataHome(), "cata.sock")
 	}
-	if Config != nil {
-		p := strings.TrimSpace(Config.Server.SocketPath)
+	if cfg := Current(); cfg != nil {
+		p := strings.TrimSpace(cfg.Server.SocketPath)
 		if p != "" {
 			if filepath.IsAbs(p) {
 				return p
@@ -710,6 +856,9 @@ func normalizeLLMConfig(llm *LLMConfig) {
 			llm.APIURL = u + "/chat/completions"
 		}
 	}
+	if llm.Limits.MaxInFlight == 0 {
+		llm.Limits.MaxInFlight = 4
+	}
 }
 
 func getDefaultModelForProvider(provider string) string {
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Change 两份配置间一个叶子字段的变化（键为 JSON 路径，如 exec.enabled）。
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// restartOnlyKeys 仅在 server 启动时读取的配置（前缀匹配）；reload 后需 cata restart 才生效。
+var restartOnlyKeys = []string{
+	"server.socket_path",
+	"brain.",
+	"evolution.enabled",
+	"evolution.cycle_interval",
+}
+
+// KeepRestartOnly 把 restartOnlyKeys 对应的字段从 old 带到 cur：reload 发布的配置只改运行期可生效的键，
+// 其余变化只报告、待 cata restart 后生效。与 restartOnlyKeys 保持一致。
+func KeepRestartOnly(old, cur *AppConfig) {
+	if old == nil || cur == nil {
+		return
+	}
+	cur.Server.SocketPath = old.Server.SocketPath
+	cur.Brain = old.Brain
+	cur.Evolution.Enabled = old.Evolution.Enabled
+	cur.Evolution.CycleInterval = old.Evolution.CycleInterval
+}
+
+// NeedsRestart 该键的变化是否需要重启 server。
+func NeedsRestart(key string) bool {
+	for _, p := range restartOnlyKeys {
+		if key == p || (strings.HasSuffix(p, ".") && strings.HasPrefix(key, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 比较两份配置，返回按键排序的变化；密钥类字段只报告「已修改」。
+func Diff(old, cur *AppConfig) []Change {
+	a, b := flattenConfig(old), flattenConfig(cur)
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	var out []Change
+	for k := range keys {
+		if a[k] == b[k] {
+			continue
+		}
+		c := Change{Key: k, Old: unsetIfEmpty(a[k]), New: unsetIfEmpty(b[k])}
+		switch {
+		case strings.HasSuffix(k, "api_key"):
+			c.Old, c.New = "***", "*** (changed)"
+		case k == "mcp.servers":
+			// 数组含 env（可能有密钥），只展示名称与启用状态
+			c.Old, c.New = mcpServersSummary(old), mcpServersSummary(cur)
+			if c.Old == c.New {
+				c.New += " (command/args/env changed)"
+			}
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func unsetIfEmpty(v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+	return v
+}
+
+func mcpServersSummary(cfg *AppConfig) string {
+	if cfg == nil || len(cfg.MCP.Servers) == 0 {
+		return "[]"
+	}
+	names := make([]string, 0, len(cfg.MCP.Servers))
+	for _, s := range cfg.MCP.Servers {
+		if s.Enabled {
+			names = append(names, s.Name)
+		} else {
+			names = append(names, s.Name+"(disabled)")
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// flattenConfig 将配置展平为 JSON 路径 → 值（对象逐层展开，数组整体序列化）。
+func flattenConfig(cfg *AppConfig) map[string]string {
+	out := make(map[string]string)
+	if cfg == nil {
+		return out
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return out
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return out
+	}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		if m, ok := v.(map[string]interface{}); ok {
+			for k, x := range m {
+				walk(prefix+k+".", x)
+			}
+			return
+		}
+		b, _ := json.Marshal(v)
+		out[strings.TrimSuffix(prefix, ".")] = string(b)
+	}
+	walk("", root)
+	return out
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"cata/internal/brain"
 	"cata/internal/config"
 )
 
@@ -14,19 +13,20 @@ const sessionCompressMinShortBytes = 256
 
 // RunSessionCompress 对话轮次达到阈值后触发一轮演进（consolidate short → persona），跳过周期门控。
 func RunSessionCompress(ctx context.Context) error {
-	if config.Config == nil || !config.Config.LLM.Enabled {
+	cfg := config.Current()
+	if cfg == nil || !cfg.LLM.Enabled {
 		return nil
 	}
-	if !config.Config.Evolution.Enabled {
+	if !cfg.Evolution.Enabled {
 		return nil
 	}
-	ws, err := brain.MustActive()
+	ws, err := sessionWorkspace(ctx)
 	if err != nil {
 		return fmt.Errorf("active workspace: %w", err)
 	}
 	interval := DefaultCycleSeconds
-	if config.Config.Evolution.CycleInterval > 0 {
-		interval = config.Config.Evolution.CycleInterval
+	if cfg.Evolution.CycleInterval > 0 {
+		interval = cfg.Evolution.CycleInterval
 	}
 	e := NewEngine(time.Duration(interval) * time.Second)
 	if err := e.runCycle(ctx, ws, true, false); err != nil {
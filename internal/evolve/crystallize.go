@@ -12,16 +12,17 @@ import (
 
 // RunCrystallize 高 token / 重复任务后尝试将探索固化为脑子内 skill（不修改 mcp）。
 func RunCrystallize(ctx context.Context) error {
-	if config.Config == nil || !config.Config.LLM.Enabled || !config.Config.Evolution.Enabled {
+	cfg := config.Current()
+	if cfg == nil || !cfg.LLM.Enabled || !cfg.Evolution.Enabled {
 		return nil
 	}
-	ws, err := brain.MustActive()
+	ws, err := sessionWorkspace(ctx)
 	if err != nil {
 		return fmt.Errorf("active workspace: %w", err)
 	}
 	interval := DefaultCycleSeconds * time.Second
-	if config.Config.Evolution.CycleInterval > 0 {
-		interval = time.Duration(config.Config.Evolution.CycleInterval) * time.Second
+	if cfg.Evolution.CycleInterval > 0 {
+		interval = time.Duration(cfg.Evolution.CycleInterval) * time.Second
 	}
 	return NewEngine(interval).runCycle(ctx, ws, false, true)
 }
@@ -22,6 +22,9 @@ type Engine struct {
 	mu              sync.Mutex
 	lastFingerprint map[string]string
 	cooldownUntil   map[string]time.Time
+	// lastRun / nextRun 周期时间点（status 展示）；零值表示未启动或尚未运行
+	lastRun time.Time
+	nextRun time.Time
 }
 
 // NewEngine 创建演进引擎。
@@ -38,16 +41,20 @@ func NewEngine(interval time.Duration) *Engine {
 
 // Start 周期执行；对每个已注册 workspace 分别门控与演进。
 func (e *Engine) Start(ctx context.Context) {
-	if config.Config == nil || !config.Config.LLM.Enabled {
+	cfg := config.Current()
+	if cfg == nil || !cfg.LLM.Enabled {
 		log.Println("Autonomous evolution: skipped (LLM not enabled)")
 		return
 	}
-	if config.Config != nil && !config.Config.Evolution.Enabled {
+	if cfg != nil && !cfg.Evolution.Enabled {
 		log.Println("Autonomous evolution: disabled in config")
 		return
 	}
 
 	log.Printf("Autonomous evolution: started (interval %s, per-workspace)", e.interval)
+	e.mu.Lock()
+	e.nextRun = time.Now().Add(e.interval)
+	e.mu.Unlock()
 
 	go func() {
 		ticker := time.NewTicker(e.interval)
@@ -57,13 +64,24 @@ func (e *Engine) Start(ctx context.Context) {
 			case <-ctx.Done():
 				log.Println("Autonomous evolution: stopped")
 				return
-			case <-ticker.C:
+			case now := <-ticker.C:
+				e.mu.Lock()
+				e.lastRun = now
+				e.nextRun = now.Add(e.interval)
+				e.mu.Unlock()
 				e.runAll(ctx)
 			}
 		}
 	}()
 }
 
+// Schedule 返回周期间隔与最近 / 下次运行时间（未启动时 next 为零值）。
+func (e *Engine) Schedule() (interval time.Duration, last, next time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.interval, e.lastRun, e.nextRun
+}
+
 func (e *Engine) runAll(ctx context.Context) {
 	_ = brain.EnsureCataLayout()
 	list, err := brain.ListWorkspaces()
@@ -75,8 +93,8 @@ func (e *Engine) runAll(ctx context.Context) {
 		return
 	}
 	for _, ws := range list {
-		brain.SetActive(ws)
-		if err := e.runCycle(ctx, ws, false, false); err != nil {
+		wctx := brain.WithSession(ctx, &brain.Session{Workspace: ws})
+		if err := e.runCycle(wctx, ws, false, false); err != nil {
 			log.Printf("Autonomous evolution [%s]: %v", ws.ID, err)
 		}
 	}
@@ -87,7 +105,7 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 		return ctx.Err()
 	}
 
-	snap, err := Observe()
+	snap, err := Observe(ws)
 	if err != nil {
 		return fmt.Errorf("observe: %w", err)
 	}
@@ -102,7 +120,7 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 			log.Printf("Autonomous evolution [%s]: crystallize skipped (short-term too small)", ws.ID)
 			return nil
 		}
-		if excerpt, err := readFileCap(brain.ShortTermCurrentPath(), maxShortExcerptBytes); err == nil {
+		if excerpt, err := readFileCap(ws.ShortTermPath(), maxShortExcerptBytes); err == nil {
 			appendCrystallizeTriggers(snap, excerpt)
 		}
 		snap.Triggers = append(snap.Triggers, "high_token_session")
@@ -131,7 +149,7 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 		return fmt.Errorf("LLM: %w", err)
 	}
 
-	prompt := buildDecisionPrompt(snap, sessionCompress, crystallize)
+	prompt := buildDecisionPrompt(ws, snap, sessionCompress, crystallize)
 	sys := evolutionSystemPrompt()
 	if sessionCompress {
 		sys = evolutionSessionCompressPrompt()
@@ -143,7 +161,7 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 		{Role: "user", Content: prompt},
 	}
 
-	reply, err := client.ChatEvolution(messages)
+	reply, err := client.ChatEvolution(ctx, messages)
 	if err != nil {
 		return fmt.Errorf("decide: %w", err)
 	}
@@ -161,7 +179,7 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 	var touched []string
 	action := strings.ToLower(strings.TrimSpace(dec.Action))
 	if action != "idle" && len(dec.Updates) > 0 {
-		touched, err = ApplyUpdates(dec.Updates)
+		touched, err = ApplyUpdates(ws, dec.Updates)
 		if err != nil {
 			return fmt.Errorf("apply: %w", err)
 		}
@@ -191,20 +209,20 @@ func (e *Engine) runCycle(ctx context.Context, ws *brain.Workspace, sessionCompr
 		DocTouched:  touched,
 	}
 	if shouldFinalizeShortTerm(dec, touched, snap, sessionCompress) {
-		if arch, err := brain.FinalizeShortTermAfterConsolidate(brain.DefaultKeepRecentAfterConsolidate); err != nil {
+		if arch, err := brain.FinalizeShortTermAfterConsolidate(ws, brain.DefaultKeepRecentAfterConsolidate); err != nil {
 			log.Printf("Autonomous evolution [%s]: short-term finalize: %v", ws.ID, err)
 		} else if arch != "" {
 			entry.DocTouched = append(entry.DocTouched, arch)
 			log.Printf("Autonomous evolution [%s]: short-term archived to %s", ws.ID, arch)
-			if fresh, err := Observe(); err == nil {
+			if fresh, err := Observe(ws); err == nil {
 				snap = fresh
 			}
 		}
 	}
-	if err := brain.SyncMemoryIndexAfterEvolution(entry.DocTouched, learning, archRel(entry.DocTouched)); err != nil {
+	if err := brain.SyncMemoryIndexAfterEvolution(ws, entry.DocTouched, learning, archRel(entry.DocTouched)); err != nil {
 		log.Printf("Autonomous evolution [%s]: memory index: %v", ws.ID, err)
 	}
-	if err := AppendLog(entry); err != nil {
+	if err := AppendLog(ws, entry); err != nil {
 		return err
 	}
 
@@ -258,7 +276,7 @@ func evolutionCrystallizePrompt() string {
 - SKILL 中写明：适用场景（如东财 A 站）、输出路径（相对产出区 cwd）、禁止 browser_snapshot 整页抓取`
 }
 
-func buildDecisionPrompt(snap *Snapshot, sessionCompress, crystallize bool) string {
+func buildDecisionPrompt(ws *brain.Workspace, snap *Snapshot, sessionCompress, crystallize bool) string {
 	var b strings.Builder
 	b.WriteString("triggers: ")
 	b.WriteString(strings.Join(snap.Triggers, ", "))
@@ -283,14 +301,14 @@ func buildDecisionPrompt(snap *Snapshot, sessionCompress, crystallize bool) stri
 			includeExcerpt = false
 		}
 		if includeExcerpt {
-			if excerpt, err := readFileCap(brain.ShortTermCurrentPath(), maxShortExcerptBytes); err == nil && excerpt != "" {
+			if excerpt, err := readFileCap(ws.ShortTermPath(), maxShortExcerptBytes); err == nil && excerpt != "" {
 				b.WriteString("\n\nshort_term excerpt:\n")
 				b.WriteString(excerpt)
 			}
 		} else {
 			b.WriteString("\n\n(short_term unchanged since last evolution; excerpt omitted)\n")
 		}
-		if hot, err := readFileCap(brain.HotPath(), 1200); err == nil && hot != "" {
+		if hot, err := readFileCap(ws.PersonaPath(), 1200); err == nil && hot != "" {
 			b.WriteString("\n\ncurrent mode persona (merge here, append only):\n")
 			b.WriteString(hot)
 		}
@@ -315,15 +333,23 @@ func readFileCap(path string, max int) (string, error) {
 	return s, nil
 }
 
-// RunCycle 对当前活跃 workspace 执行一轮（测试用）。
+// RunCycle 对 ctx 会话（或进程级活跃）workspace 执行一轮（测试用）。
 func RunCycle(ctx context.Context) error {
-	ws, err := brain.MustActive()
+	ws, err := sessionWorkspace(ctx)
 	if err != nil {
 		return err
 	}
 	interval := DefaultCycleSeconds * time.Second
-	if config.Config != nil && config.Config.Evolution.CycleInterval > 0 {
-		interval = time.Duration(config.Config.Evolution.CycleInterval) * time.Second
+	if cfg := config.Current(); cfg != nil && cfg.Evolution.CycleInterval > 0 {
+		interval = time.Duration(cfg.Evolution.CycleInterval) * time.Second
 	}
 	return NewEngine(interval).runCycle(ctx, ws, false, false)
 }
+
+// sessionWorkspace 取 ctx 中会话的 workspace；无会话时回退进程级活跃 workspace（CLI）。
+func sessionWorkspace(ctx context.Context) (*brain.Workspace, error) {
+	if w := brain.SessionFrom(ctx).Workspace; w != nil {
+		return w, nil
+	}
+	return brain.MustActive()
+}
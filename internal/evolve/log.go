@@ -25,12 +25,8 @@ type LogEntry struct {
 	DocTouched  []string `json:"doc_touched,omitempty"`
 }
 
-// AppendLog 向当前 workspace 的 evolution_log.json 追加。
-func AppendLog(entry LogEntry) error {
-	w, err := brain.MustActive()
-	if err != nil {
-		return err
-	}
+// AppendLog 向 w 的 evolution_log.json 追加。
+func AppendLog(w *brain.Workspace, entry LogEntry) error {
 	path := w.EvolutionLogPath()
 	var log EvolutionLog
 	if data, err := os.ReadFile(path); err == nil {
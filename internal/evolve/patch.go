@@ -18,12 +18,8 @@ type DocUpdate struct {
 	Content string `json:"content"`
 }
 
-// ApplyUpdates 将补丁写入当前活跃 workspace。
-func ApplyUpdates(updates []DocUpdate) ([]string, error) {
-	w, err := brain.MustActive()
-	if err != nil {
-		return nil, err
-	}
+// ApplyUpdates 将补丁写入 w（被演进的 workspace）。
+func ApplyUpdates(w *brain.Workspace, updates []DocUpdate) ([]string, error) {
 	var touched []string
 	for _, u := range updates {
 		if strings.TrimSpace(u.Content) == "" && u.Mode != "write" && u.Mode != "overwrite" {
@@ -142,12 +138,8 @@ func isSkillScriptFile(name string) bool {
 	}
 }
 
-// TouchArchiveDay 创建当日 archive 占位。
-func TouchArchiveDay() (string, error) {
-	w, err := brain.MustActive()
-	if err != nil {
-		return "", err
-	}
+// TouchArchiveDay 在 w 中创建当日 archive 占位。
+func TouchArchiveDay(w *brain.Workspace) (string, error) {
 	rel := filepath.Join(brain.RelMemoryArchive, clock.Format("2006-01-02")+".md")
 	abs := w.Path(rel)
 	if _, err := os.Stat(abs); err == nil {
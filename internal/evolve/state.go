@@ -32,15 +32,15 @@ func (s *Snapshot) Fingerprint() string {
 		s.ShortTermModTime, s.ShortTermBytes, s.LongTermFileCount)
 }
 
-// Observe 读取 ~/.cata/brain 元数据（不读 workflow/core 全文）。
-func Observe() (*Snapshot, error) {
+// Observe 读取 ws 脑子分区元数据（不读 workflow/core 全文）。
+func Observe(ws *brain.Workspace) (*Snapshot, error) {
 	s := &Snapshot{ObservedAt: clock.RFC3339()}
 
-	if info, err := os.Stat(brain.HotPath()); err == nil {
+	if info, err := os.Stat(ws.PersonaPath()); err == nil {
 		s.HotModTime = clock.FormatTime(info.ModTime(), time.RFC3339)
 	}
 
-	shortPath := brain.ShortTermCurrentPath()
+	shortPath := ws.ShortTermPath()
 	if info, err := os.Stat(shortPath); err == nil {
 		s.ShortTermModTime = clock.FormatTime(info.ModTime(), time.RFC3339)
 	}
@@ -48,7 +48,7 @@ func Observe() (*Snapshot, error) {
 		s.ShortTermBytes = int64(len(data))
 	}
 
-	longDir := brain.LongTermDir()
+	longDir := ws.LongTermDir()
 	if entries, err := os.ReadDir(longDir); err == nil {
 		for _, e := range entries {
 			if !e.IsDir() && strings.HasSuffix(e.Name(), ".md") {
@@ -57,7 +57,7 @@ func Observe() (*Snapshot, error) {
 		}
 	}
 
-	archiveDir := brain.ArchiveDir()
+	archiveDir := ws.ArchiveDir()
 	if entries, err := os.ReadDir(archiveDir); err == nil {
 		for _, e := range entries {
 			if !e.IsDir() && strings.HasSuffix(e.Name(), ".md") {
@@ -66,19 +66,24 @@ func Observe() (*Snapshot, error) {
 		}
 	}
 
-	loadLastEvolutionMeta(s)
-	s.RecentLogSummary = summarizeRecentLog(2, 80)
-	if w := brain.Active(); w != nil {
-		if ids, err := brain.ListWorkspaceSkillIDs(w); err == nil {
-			s.SkillIDs = ids
-		}
+	loadLastEvolutionMeta(ws, s)
+	s.RecentLogSummary = summarizeRecentLog(ws, 2, 80)
+	if ids, err := brain.ListWorkspaceSkillIDs(ws); err == nil {
+		s.SkillIDs = ids
 	}
 	computeTriggers(s)
 	return s, nil
 }
 
-func loadLastEvolutionMeta(s *Snapshot) {
-	data, err := os.ReadFile(brain.EvolutionLogPath())
+// LastEvolution 返回 ws 演进日志中最近一条的时间与动作；无日志时为空。
+func LastEvolution(ws *brain.Workspace) (at, action string) {
+	var s Snapshot
+	loadLastEvolutionMeta(ws, &s)
+	return s.LastEvolutionAt, s.LastEvolutionAction
+}
+
+func loadLastEvolutionMeta(ws *brain.Workspace, s *Snapshot) {
+	data, err := os.ReadFile(ws.EvolutionLogPath())
 	if err != nil {
 		return
 	}
@@ -91,8 +96,8 @@ func loadLastEvolutionMeta(s *Snapshot) {
 	s.LastEvolutionAction = last.Action
 }
 
-func summarizeRecentLog(n int, maxLearning int) string {
-	data, err := os.ReadFile(brain.EvolutionLogPath())
+func summarizeRecentLog(ws *brain.Workspace, n int, maxLearning int) string {
+	data, err := os.ReadFile(ws.EvolutionLogPath())
 	if err != nil {
 		return ""
 	}
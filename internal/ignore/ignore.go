@@ -0,0 +1,204 @@
+// Package ignore 产出区文件遍历：.gitignore 规则、含 ** 的 glob，以及默认跳过 .git / node_modules 的遍历（list_dir、glob 等文件工具共用）。
+package ignore
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSkip 默认不进入的目录名。
+var DefaultSkip = map[string]bool{".git": true, "node_modules": true}
+
+// rule 一条 .gitignore 规则；base 为所在 .gitignore 的目录（绝对路径）。
+type rule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Matcher 逐层累积的 .gitignore 规则；后出现（更深、更靠后）的规则优先，! 取反。
+type Matcher struct {
+	rules []rule
+}
+
+// NewMatcher 载入 root 及其祖先目录（直到含 .git 的仓库根）的 .gitignore。
+func NewMatcher(root string) *Matcher {
+	m := &Matcher{}
+	var dirs []string
+	for dir := filepath.Clean(root); ; {
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m.AddDir(dirs[i])
+	}
+	return m
+}
+
+// AddDir 读取 dir/.gitignore（不存在时忽略）。
+func (m *Matcher) AddDir(dir string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if r, ok := parseRule(dir, sc.Text()); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+}
+
+func parseRule(base, line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+	r := rule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// 中间或开头有 / 的相对 .gitignore 所在目录锚定；否则匹配任意层的名字
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+// Ignored full（绝对路径）是否被忽略。
+func (m *Matcher) Ignored(full string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		rel, err := filepath.Rel(r.base, full)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		var ok bool
+		if r.anchored {
+			ok = Match(r.pattern, rel)
+		} else {
+			ok = Match(r.pattern, path.Base(rel))
+		}
+		if ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Match 以 / 分隔的 glob：* ? [..] 不跨越 /，** 作为整段时匹配零或多段。
+func Match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pat[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Options 遍历选项。All 为 true 时不看 .gitignore、也进入 DefaultSkip 目录。
+type Options struct {
+	All bool
+	// MaxDepth 相对 root 的最大层数（1 只列直接子项）；0 不限
+	MaxDepth int
+}
+
+// Walk 按字典序遍历 root 下的文件与目录（不含 root 本身，不跟随符号链接），跳过忽略项；rel 为 / 分隔的相对路径。
+// 回调对目录返回 filepath.SkipDir 可跳过其子树；返回 filepath.SkipAll 提前结束。
+func Walk(root string, opt Options, fn func(rel string, d fs.DirEntry) error) error {
+	var m *Matcher
+	if !opt.All {
+		m = NewMatcher(root)
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			// 无权限等：跳过该项
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/") + 1
+		if m != nil {
+			if d.IsDir() && DefaultSkip[d.Name()] {
+				return filepath.SkipDir
+			}
+			if m.Ignored(p, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if err := fn(rel, d); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if opt.MaxDepth > 0 && depth >= opt.MaxDepth {
+				return filepath.SkipDir
+			}
+			if m != nil {
+				m.AddDir(p)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,83 @@
+package ignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/cata/main.go", true},
+		{"internal/**", "internal/a/b.txt", true},
+		{"internal/**/x_test.go", "internal/x_test.go", true},
+		{"internal/**/x_test.go", "internal/a/b/x_test.go", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"a?c", "abc", true},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.name); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestWalkHonorsGitignore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":            "*.log\nbuild/\n/top.txt\n!keep.log\n",
+		"a.go":                  "",
+		"debug.log":             "",
+		"keep.log":              "",
+		"top.txt":               "",
+		"sub/top.txt":           "",
+		"sub/.gitignore":        "local/\n",
+		"sub/local/x.go":        "",
+		"build/out.bin":         "",
+		"node_modules/m/i.js":   "",
+		".git/HEAD":             "",
+		"deep/er/build/skip.go": "",
+	}
+	for name, data := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	err := Walk(root, Options{}, func(rel string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			got = append(got, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".gitignore", "a.go", "keep.log", "sub/.gitignore", "sub/top.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("walk = %v, want %v", got, want)
+	}
+
+	n := 0
+	_ = Walk(root, Options{All: true}, func(rel string, d fs.DirEntry) error {
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	if n != len(files) {
+		t.Fatalf("walk all saw %d files, want %d", n, len(files))
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"cata/internal/brain"
 	"cata/internal/clock"
 	"cata/internal/config"
+	"cata/internal/usage"
 )
 
 const (
@@ -90,6 +91,8 @@ type Client struct {
 	httpClient         *http.Client
 	streamHTTPClient   *http.Client
 	provider           Provider
+	// role 用量台账里的 LLM 角色（NewClientForRole 设置；其余为 default）
+	role Role
 }
 
 func streamRoundTimeout(base time.Duration) time.Duration {
@@ -164,25 +167,26 @@ func loadBootLeaderPrompt() string {
 
 // withBootLeaderSystemMessage 确保每次请求的消息列表前面都有 boot-leader.md 作为系统提示词。
 // 如果调用方已经自己把 boot-leader 内容放在第一个 system 中，则不会重复注入。
-func withBootLeaderSystemMessage(messages []Message) []Message {
+// 脑子节选按 ctx 中的 brain.Session 组装（每条连接各自的分区、产出区与运行环境）。
+func withBootLeaderSystemMessage(ctx context.Context, messages []Message) []Message {
 	prompt := strings.TrimSpace(loadBootLeaderPrompt())
 	if prompt == "" {
-		return ensureCataBrainExcerptSystem(messages)
+		return ensureCataBrainExcerptSystem(ctx, messages)
 	}
 
 	if len(messages) > 0 && messages[0].Role == "system" && strings.TrimSpace(messages[0].Content) == prompt {
-		return ensureCataBrainExcerptSystem(messages)
+		return ensureCataBrainExcerptSystem(ctx, messages)
 	}
 
 	out := make([]Message, 0, len(messages)+1)
 	out = append(out, Message{Role: "system", Content: prompt})
 	out = append(out, messages...)
-	return ensureCataBrainExcerptSystem(out)
+	return ensureCataBrainExcerptSystem(ctx, out)
 }
 
 // ensureCataBrainExcerptSystem 在 boot-leader 之后插入路径块 + 脑子节选（若尚未存在）。
 // 在 withBootLeaderSystemMessage 末尾调用，使所有 LLM 请求（终端、演进、摘要等）与 llm.log 一致。
-func ensureCataBrainExcerptSystem(msgs []Message) []Message {
+func ensureCataBrainExcerptSystem(ctx context.Context, msgs []Message) []Message {
 	for _, m := range msgs {
 		if m.Role != "system" {
 			continue
@@ -193,7 +197,7 @@ func ensureCataBrainExcerptSystem(msgs []Message) []Message {
 			return msgs
 		}
 	}
-	ext := brain.TerminalBrainSystemExtension(maxBrainExcerptBytesPerFile, maxBrainExcerptBytesTotal)
+	ext := brain.SessionFrom(ctx).BrainSystemExtension(maxBrainExcerptBytesPerFile, maxBrainExcerptBytesTotal)
 	if strings.TrimSpace(ext) == "" {
 		return msgs
 	}
@@ -229,13 +233,13 @@ func resolveModelForRole(cfg config.LLMConfig, role Role) string {
 }
 
 // NewClientForRole 使用全局配置和角色创建 LLM 客户端。
-// - 当配置文件启用 LLM 时，从 config.Config.LLM 读取 Provider/APIURL/APIKey/MaxTokens/Timeout，并按角色解析模型名。
+// - 当配置文件启用 LLM 时，从当前配置的 LLM 段读取 Provider/APIURL/APIKey/MaxTokens/Timeout，并按角色解析模型名。
 // - 当配置未启用或尚未加载时，回退到 NewClient（环境变量与默认策略）。
 func NewClientForRole(role Role) (*Client, error) {
-	if config.Config != nil && config.Config.LLM.Enabled {
-		llmCfg := config.Config.LLM
+	if cfg := config.Current(); cfg != nil && cfg.LLM.Enabled {
+		llmCfg := cfg.LLM
 		model := resolveModelForRole(llmCfg, role)
-		return NewClientFromConfig(
+		c, err := NewClientFromConfig(
 			llmCfg.Provider,
 			llmCfg.APIKey,
 			llmCfg.APIURL,
@@ -243,10 +247,46 @@ func NewClientForRole(role Role) (*Client, error) {
 			llmCfg.MaxTokens,
 			time.Duration(llmCfg.Timeout)*time.Second,
 		)
+		if c != nil {
+			c.role = role
+		}
+		return c, err
 	}
 
 	// 配置未启用或未加载，沿用现有环境变量与默认逻辑
-	return NewClient()
+	c, err := NewClient()
+	if c != nil {
+		c.role = role
+	}
+	return c, err
+}
+
+// Model 本客户端请求使用的模型名。
+func (c *Client) Model() string { return c.model }
+
+// recordUsage 把一次 API 调用记入 ctx 会话所在脑子分区的用量台账；真实用量同时用于校准 token 估算。
+func (c *Client) recordUsage(ctx context.Context, messages []Message, tools []Tool, u Usage) {
+	if !u.Estimated {
+		calibrateEstimate(ctx, c.model, messages, tools, u.PromptTokens)
+	}
+	role := c.role
+	if role == "" {
+		role = RoleDefault
+	}
+	err := usage.Record(brain.SessionFrom(ctx).Workspace, usage.Entry{
+		Session:          usage.SessionFrom(ctx),
+		Role:             string(role),
+		Model:            c.model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens,
+		CachedTokens:     u.CachedTokens,
+		TotalTokens:      u.TotalTokens,
+		Estimated:        u.Estimated,
+	})
+	if err != nil {
+		log.Printf("usage ledger: %v", err)
+	}
 }
 
 // NewClient 创建新的 LLM 客户端（从环境变量或配置读取）
@@ -428,11 +468,7 @@ type ChatResponse struct {
 		Message      Message `json:"message"`
 		FinishReason string  `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage Usage `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
@@ -461,7 +497,7 @@ func (c *Client) Summarize(content string, instructions string) (string, error)
 		Temperature: 0.3, // 较低温度以获得更一致的摘要
 	}
 
-	resp, _, err := c.chat(req, nil, "", false)
+	resp, _, err := c.chat(context.Background(), req, nil, "", false)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate summary: %w", err)
 	}
@@ -516,7 +552,7 @@ func (c *Client) PreprocessQuery(query string) (*QueryPreprocessResult, error) {
 		Temperature: 0.3,
 	}
 
-	resp, _, err := c.chat(req, nil, "", false)
+	resp, _, err := c.chat(context.Background(), req, nil, "", false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to preprocess query: %w", err)
 	}
@@ -607,7 +643,7 @@ func (c *Client) Chat(messages []Message) (string, error) {
 		Temperature: 0.7,
 	}
 
-	resp, _, err := c.chat(req, nil, "", false)
+	resp, _, err := c.chat(context.Background(), req, nil, "", false)
 	if err != nil {
 		return "", fmt.Errorf("failed to chat: %w", err)
 	}
@@ -627,8 +663,8 @@ func (c *Client) Chat(messages []Message) (string, error) {
 // evolutionMaxTokens 自主演进决策 JSON 的输出上限（控制成本）。
 const evolutionMaxTokens = 1024
 
-// ChatEvolution 演进专用：不注入 boot-leader/brain 节选，低温度、限制 max_tokens，不写 llm.log。
-func (c *Client) ChatEvolution(messages []Message) (string, error) {
+// ChatEvolution 演进专用：低温度、限制 max_tokens，不写 llm.log；脑子节选取 ctx 中被演进的会话。
+func (c *Client) ChatEvolution(ctx context.Context, messages []Message) (string, error) {
 	maxTok := evolutionMaxTokens
 	if c.maxTokens > 0 && c.maxTokens < maxTok {
 		maxTok = c.maxTokens
@@ -639,7 +675,7 @@ func (c *Client) ChatEvolution(messages []Message) (string, error) {
 		MaxTokens:   maxTok,
 		Temperature: 0.2,
 	}
-	resp, _, err := c.chat(req, nil, "", true)
+	resp, _, err := c.chat(ctx, req, nil, "", true)
 	if err != nil {
 		return "", fmt.Errorf("evolution chat: %w", err)
 	}
@@ -669,7 +705,7 @@ func (c *Client) ChatWithTools(messages []Message, tools []Tool, toolChoice stri
 		Temperature: temperature,
 	}
 
-	resp, toolCalls, err := c.chat(req, tools, toolChoice, false)
+	resp, toolCalls, err := c.chat(context.Background(), req, tools, toolChoice, false)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to chat with tools: %w", err)
 	}
@@ -693,7 +729,7 @@ func (c *Client) buildHTTPChatRequest(ctx context.Context, req ChatRequest, tool
 		return nil, fmt.Errorf("API key is empty")
 	}
 	if injectBrain {
-		req.Messages = SanitizeMessagesToolCalls(compactMessageContentForAPI(withBootLeaderSystemMessage(req.Messages)))
+		req.Messages = SanitizeMessagesToolCalls(compactMessageContentForAPI(withBootLeaderSystemMessage(ctx, req.Messages)))
 	} else {
 		req.Messages = SanitizeMessagesToolCalls(compactMessageContentForAPI(req.Messages))
 	}
@@ -714,11 +750,16 @@ func (c *Client) buildHTTPChatRequest(ctx context.Context, req ChatRequest, tool
 }
 
 // chat 发送 HTTP 请求到 LLM API（内部统一入口）。skipAppendLog 为 true 时不写 llm.log（由调用方统一写）。
-func (c *Client) chat(req ChatRequest, tools []Tool, toolChoice string, skipAppendLog bool) (*ChatResponse, []ToolCall, error) {
-	httpReq, err := c.buildHTTPChatRequest(context.Background(), req, tools, toolChoice, false, true)
+func (c *Client) chat(ctx context.Context, req ChatRequest, tools []Tool, toolChoice string, skipAppendLog bool) (*ChatResponse, []ToolCall, error) {
+	httpReq, err := c.buildHTTPChatRequest(ctx, req, tools, toolChoice, false, true)
 	if err != nil {
 		return nil, nil, err
 	}
+	slot, err := c.acquire(ctx, req.Messages, tools)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer slot.release(Usage{})
 
 	// 调试：检查 header 是否设置（仅在开发时启用）
 	if os.Getenv("DEBUG_LLM") == "true" {
@@ -778,6 +819,9 @@ func (c *Client) chat(req ChatRequest, tools []Tool, toolChoice string, skipAppe
 			errorMsg = errorMsg[:500] + "..."
 		}
 		log.Printf("API returned non-200 status: %d, URL=%s, Body: %s", resp.StatusCode, c.apiURL, errorMsg)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, nil, c.rateLimited(resp.Header, errorMsg)
+		}
 		
 		// 对于 404 错误，提供更具体的提示
 		if resp.StatusCode == http.StatusNotFound {
@@ -793,9 +837,20 @@ func (c *Client) chat(req ChatRequest, tools []Tool, toolChoice string, skipAppe
 		return nil, nil, err
 	}
 
+	var wrap struct {
+		Usage Usage `json:"usage"`
+	}
+	_ = json.Unmarshal(body, &wrap)
+	u := wrap.Usage
+	if u.TotalTokens == 0 {
+		u = estimateRoundUsage(ctx, req.Messages, tools, content, "", toolCalls)
+	}
+	c.recordUsage(ctx, req.Messages, tools, u)
+	slot.release(u)
+
 	// 将本次 LLM 交互写入可选的日志文件（通过 LLM_LOG_FILE 控制，避免影响正常 stdout 日志）。
 	if !skipAppendLog {
-		c.appendLLMLog(req, tools, toolChoice, content, toolCalls, body)
+		c.appendLLMLog(ctx, req, tools, toolChoice, content, toolCalls, body)
 	}
 
 	// 转换为 ChatResponse 格式（向后兼容）
@@ -814,6 +869,7 @@ func (c *Client) chat(req ChatRequest, tools []Tool, toolChoice string, skipAppe
 				FinishReason: "stop",
 			},
 		},
+		Usage: u,
 	}
 
 	return chatResp, toolCalls, nil
@@ -843,11 +899,11 @@ func inferPromptSources(msgs []Message) []string {
 // 默认写入 prompt 组件清单（static 仅 chars/preview，conversation 仅末尾几条全文），避免每轮重复刷 boot-leader 全文。
 // 设置 LLM_LOG_VERBOSE=1 可恢复完整 messages/tools/raw_body。
 // 日志路径由环境变量 LLM_LOG_FILE 控制，默认 llm.log。
-func (c *Client) appendLLMLog(req ChatRequest, tools []Tool, toolChoice string, content string, toolCalls []ToolCall, rawBody []byte) {
+func (c *Client) appendLLMLog(ctx context.Context, req ChatRequest, tools []Tool, toolChoice string, content string, toolCalls []ToolCall, rawBody []byte) {
 	logPath := brain.LLMLogPath()
 
 	msgsCopy := append([]Message(nil), req.Messages...)
-	effectiveMessages := withBootLeaderSystemMessage(msgsCopy)
+	effectiveMessages := withBootLeaderSystemMessage(ctx, msgsCopy)
 
 	respLog := map[string]interface{}{
 		"content": content,
@@ -20,14 +20,15 @@ var (
 
 // ParseEmbeddedToolCalls 从 assistant 正文解析嵌入式 tool_call（API 未给 tool_calls 或 arguments 截断时）。
 // 支持：[tool_call name] {json}、<tool_call>...</tool_call>、<tool name="...">...</tool>
-func ParseEmbeddedToolCalls(content string) (calls []ToolCall, stripped string) {
+// env 为会话运行环境，用于把 <param name="command"> 转为 argv。
+func ParseEmbeddedToolCalls(content string, env *brain.RuntimeEnv) (calls []ToolCall, stripped string) {
 	if strings.Contains(content, "[tool_call") {
 		if calls, stripped := parseBracketToolCalls(content); len(calls) > 0 {
 			return calls, stripped
 		}
 	}
 	if strings.Contains(strings.ToLower(content), "<tool") {
-		return parseXMLToolCalls(content)
+		return parseXMLToolCalls(content, env)
 	}
 	return nil, content
 }
@@ -75,7 +76,7 @@ func parseBracketToolCalls(content string) ([]ToolCall, string) {
 	return calls, strings.TrimSpace(kept.String())
 }
 
-func parseXMLToolCalls(content string) ([]ToolCall, string) {
+func parseXMLToolCalls(content string, env *brain.RuntimeEnv) ([]ToolCall, string) {
 	var kept strings.Builder
 	last := 0
 	idx := 0
@@ -83,21 +84,21 @@ func parseXMLToolCalls(content string) ([]ToolCall, string) {
 	for _, loc := range reToolCallBlock.FindAllStringSubmatchIndex(content, -1) {
 		kept.WriteString(content[last:loc[0]])
 		inner := content[loc[2]:loc[3]]
-		if tc, ok := parseToolCallInner(inner, idx, ""); ok {
+		if tc, ok := parseToolCallInner(inner, idx, "", env); ok {
 			calls = append(calls, tc)
 			idx++
 		}
 		last = loc[1]
 	}
 	if len(calls) == 0 {
-		return parseLooseToolBlocks(content)
+		return parseLooseToolBlocks(content, env)
 	}
 	kept.WriteString(content[last:])
 	stripped := strings.TrimSpace(kept.String())
 	return calls, stripped
 }
 
-func parseLooseToolBlocks(content string) ([]ToolCall, string) {
+func parseLooseToolBlocks(content string, env *brain.RuntimeEnv) ([]ToolCall, string) {
 	var calls []ToolCall
 	var kept strings.Builder
 	last := 0
@@ -106,7 +107,7 @@ func parseLooseToolBlocks(content string) ([]ToolCall, string) {
 		kept.WriteString(content[last:loc[0]])
 		name := content[loc[2]:loc[3]]
 		inner := content[loc[4]:loc[5]]
-		if tc, ok := parseToolCallInner(inner, idx, name); ok {
+		if tc, ok := parseToolCallInner(inner, idx, name, env); ok {
 			calls = append(calls, tc)
 			idx++
 		}
@@ -119,7 +120,7 @@ func parseLooseToolBlocks(content string) ([]ToolCall, string) {
 	return calls, strings.TrimSpace(kept.String())
 }
 
-func parseToolCallInner(inner string, idx int, toolName string) (ToolCall, bool) {
+func parseToolCallInner(inner string, idx int, toolName string, env *brain.RuntimeEnv) (ToolCall, bool) {
 	name := strings.TrimSpace(toolName)
 	if name == "" {
 		nm := reToolName.FindStringSubmatch(inner)
@@ -138,7 +139,7 @@ func parseToolCallInner(inner string, idx int, toolName string) (ToolCall, bool)
 			}
 		}
 	} else if m := reParamCommand.FindStringSubmatch(inner); len(m) >= 2 {
-		argv = shellLineToArgv(strings.TrimSpace(decodeXMLEntities(m[1])))
+		argv = env.ShellLineToArgv(strings.TrimSpace(decodeXMLEntities(m[1])))
 	}
 	if len(argv) > 0 {
 		args, _ := json.Marshal(map[string][]string{"argv": argv})
@@ -183,10 +184,6 @@ func parseXMLToolParams(inner string) map[string]interface{} {
 	return out
 }
 
-func shellLineToArgv(line string) []string {
-	return brain.ShellLineToArgv(line)
-}
-
 func decodeXMLEntities(s string) string {
 	s = strings.ReplaceAll(s, "&amp;", "&")
 	s = strings.ReplaceAll(s, "&lt;", "<")
@@ -0,0 +1,280 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cata/internal/config"
+)
+
+// Priority LLM 请求优先级：排队时交互请求先于后台请求放行。
+type Priority int
+
+const (
+	// PriorityBackground 演进、定时任务、后台 task 等无人等待的请求
+	PriorityBackground Priority = iota
+	// PriorityInteractive 有用户在等的 chat 回合（含回合内的会话压缩）
+	PriorityInteractive
+)
+
+type priorityKey struct{}
+type queueNoticeKey struct{}
+
+// WithPriority ctx 内的 LLM 请求按 p 排队；未设置时演进角色为后台，其余为交互。
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// WithQueueNotice 请求因限流排队时以 fn 报告原因（如转为 progress 事件发给客户端）。
+func WithQueueNotice(ctx context.Context, fn func(msg string)) context.Context {
+	return context.WithValue(ctx, queueNoticeKey{}, fn)
+}
+
+func (c *Client) priority(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	if c.role == RoleEvolution {
+		return PriorityBackground
+	}
+	return PriorityInteractive
+}
+
+// limiter 一个 provider 的全局预算：在途请求数、每分钟请求数与 token 数（滑动一分钟窗口），以及 429 后的退避。
+// 预算取自当前配置的 llm.limits（reload 后即生效）。
+type limiter struct {
+	mu       sync.Mutex
+	inFlight int
+	requests []time.Time
+	tokens   []*tokenMark
+	// waiting 各优先级排队中的请求数；有交互请求排队时后台请求不放行
+	waiting [2]int
+	// backoff 429 后在此之前不发新请求
+	backoff time.Time
+	// wake 状态变化时关闭并替换，唤醒所有排队者
+	wake chan struct{}
+}
+
+type tokenMark struct {
+	at time.Time
+	n  int
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*limiter{}
+)
+
+// limiterFor 按 api_url 主机取共享的 limiter。
+func limiterFor(apiURL string) *limiter {
+	key := apiURL
+	if u, err := url.Parse(apiURL); err == nil && u.Host != "" {
+		key = u.Host
+	}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l := limiters[key]
+	if l == nil {
+		l = &limiter{wake: make(chan struct{})}
+		limiters[key] = l
+	}
+	return l
+}
+
+func currentLimits() config.LLMLimits {
+	cfg := config.Current()
+	if cfg == nil {
+		return config.LLMLimits{}
+	}
+	return cfg.LLM.Limits
+}
+
+// llmSlot 一次已放行的请求；release 归还在途名额并以实际用量修正 token 窗口（可重复调用）。
+type llmSlot struct {
+	l    *limiter
+	mark *tokenMark
+	once sync.Once
+}
+
+func (s *llmSlot) release(u Usage) {
+	s.once.Do(func() {
+		s.l.mu.Lock()
+		defer s.l.mu.Unlock()
+		s.l.inFlight--
+		if u.TotalTokens > 0 {
+			s.mark.n = u.TotalTokens
+		}
+		s.l.broadcast()
+	})
+}
+
+func (l *limiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// acquire 等到预算允许后放行一个请求；输入 token 估算先计入每分钟 token 预算，release 时按实际用量修正。
+func (c *Client) acquire(ctx context.Context, messages []Message, tools []Tool) (*llmSlot, error) {
+	l := limiterFor(c.apiURL)
+	p := c.priority(ctx)
+	est := c.EstimatedChatInputTokens(ctx, messages, tools)
+	notice, _ := ctx.Value(queueNoticeKey{}).(func(string))
+
+	queued, lastReason := false, ""
+	defer func() {
+		if queued {
+			l.mu.Lock()
+			l.waiting[p]--
+			l.broadcast()
+			l.mu.Unlock()
+		}
+	}()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		reason, retry := l.blocked(now, p, est, currentLimits())
+		if reason == "" {
+			l.inFlight++
+			l.requests = append(l.requests, now)
+			mark := &tokenMark{at: now, n: est}
+			l.tokens = append(l.tokens, mark)
+			l.mu.Unlock()
+			return &llmSlot{l: l, mark: mark}, nil
+		}
+		if !queued {
+			queued = true
+			l.waiting[p]++
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		if reason != lastReason {
+			lastReason = reason
+			msg := "waiting for LLM: " + reason
+			if notice != nil {
+				notice(msg)
+			} else {
+				log.Printf("LLM limiter (%s): %s", c.role, msg)
+			}
+		}
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if retry > 0 {
+			timer = time.NewTimer(retry)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// blocked 返回不能放行的原因与建议的重查间隔（0 表示等状态变化）；可放行时 reason 为空。持 l.mu 调用。
+func (l *limiter) blocked(now time.Time, p Priority, est int, lim config.LLMLimits) (reason string, retry time.Duration) {
+	window := now.Add(-time.Minute)
+	for len(l.requests) > 0 && !l.requests[0].After(window) {
+		l.requests = l.requests[1:]
+	}
+	used := 0
+	for len(l.tokens) > 0 && !l.tokens[0].at.After(window) {
+		l.tokens = l.tokens[1:]
+	}
+	for _, m := range l.tokens {
+		used += m.n
+	}
+
+	if now.Before(l.backoff) {
+		d := l.backoff.Sub(now)
+		return fmt.Sprintf("provider rate limited (429), retrying in %s", d.Round(time.Second)), d
+	}
+	if p == PriorityBackground && l.waiting[PriorityInteractive] > 0 {
+		return "yielding to interactive chat", 0
+	}
+	if max := lim.MaxInFlight; max > 0 {
+		// 后台请求给交互请求留一个名额
+		if p == PriorityBackground && max > 1 {
+			max--
+		}
+		if l.inFlight >= max {
+			return fmt.Sprintf("%d request(s) in flight (llm.limits.max_in_flight %d)", l.inFlight, lim.MaxInFlight), 0
+		}
+	}
+	if rpm := lim.RequestsPerMinute; rpm > 0 && len(l.requests) >= rpm {
+		d := l.requests[len(l.requests)-rpm].Add(time.Minute).Sub(now)
+		return fmt.Sprintf("requests_per_minute %d reached, next slot in %s", rpm, d.Round(time.Second)), d
+	}
+	// 单个请求超过整分钟预算时等窗口清空后放行，避免永远排不上
+	if tpm := lim.TokensPerMinute; tpm > 0 && used > 0 && used+est > tpm {
+		need := used + min(est, tpm) - tpm
+		d := time.Minute
+		for _, m := range l.tokens {
+			need -= m.n
+			if need <= 0 {
+				d = m.at.Add(time.Minute).Sub(now)
+				break
+			}
+		}
+		return fmt.Sprintf("tokens_per_minute %d: %d used in the last minute, next slot in %s", tpm, used, d.Round(time.Second)), d
+	}
+	return "", 0
+}
+
+// defaultRateLimitBackoff 429 未带 Retry-After 时的退避。
+const defaultRateLimitBackoff = 5 * time.Second
+
+// RateLimitError provider 返回 429；同一 provider 的新请求在 RetryAfter 内暂停。
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("API rate limited (429, retry after %s): %s", e.RetryAfter.Round(time.Second), e.Message)
+}
+
+// rateLimited 记录 429：解析 Retry-After，推迟该 provider 的后续请求，返回可重试的错误。
+func (c *Client) rateLimited(h http.Header, body string) error {
+	d := parseRetryAfter(h.Get("Retry-After"), time.Now())
+	if d <= 0 {
+		d = defaultRateLimitBackoff
+	}
+	l := limiterFor(c.apiURL)
+	l.mu.Lock()
+	if until := time.Now().Add(d); until.After(l.backoff) {
+		l.backoff = until
+	}
+	l.broadcast()
+	l.mu.Unlock()
+	log.Printf("LLM rate limited (429) by %s, backing off %s", c.apiURL, d)
+	return &RateLimitError{RetryAfter: d, Message: strings.TrimSpace(body)}
+}
+
+// parseRetryAfter 秒数或 HTTP 日期。
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
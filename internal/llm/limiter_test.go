@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"cata/internal/config"
+)
+
+func TestLimiterBlocked(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		inFlight int
+		// waiting 排队中的交互请求数
+		waiting int
+		// used 30 秒前已计入的 token
+		used  int
+		p     Priority
+		est   int
+		lim   config.LLMLimits
+		want  string // reason 子串；空为放行
+		retry time.Duration
+	}{
+		{name: "idle", p: PriorityBackground, est: 100},
+		{name: "background yields to queued interactive", waiting: 1, p: PriorityBackground, est: 100, want: "yielding"},
+		{name: "interactive ignores queued interactive", waiting: 1, p: PriorityInteractive, est: 100},
+		{name: "background keeps one slot for interactive", inFlight: 1, p: PriorityBackground, lim: config.LLMLimits{MaxInFlight: 2}, want: "in flight"},
+		{name: "interactive uses the reserved slot", inFlight: 1, p: PriorityInteractive, lim: config.LLMLimits{MaxInFlight: 2}},
+		{name: "no reserve when max_in_flight is 1", p: PriorityBackground, lim: config.LLMLimits{MaxInFlight: 1}},
+		{name: "max_in_flight reached", inFlight: 2, p: PriorityInteractive, lim: config.LLMLimits{MaxInFlight: 2}, want: "in flight"},
+		{name: "tpm within budget", used: 400, p: PriorityInteractive, est: 500, lim: config.LLMLimits{TokensPerMinute: 1000}},
+		{name: "tpm over budget waits for window", used: 600, p: PriorityInteractive, est: 500, lim: config.LLMLimits{TokensPerMinute: 1000}, want: "tokens_per_minute", retry: 30 * time.Second},
+		{name: "oversized request passes on empty window", p: PriorityInteractive, est: 5000, lim: config.LLMLimits{TokensPerMinute: 1000}},
+		{name: "oversized request waits for window to clear", used: 100, p: PriorityInteractive, est: 5000, lim: config.LLMLimits{TokensPerMinute: 1000}, want: "tokens_per_minute", retry: 30 * time.Second},
+	}
+	for _, c := range cases {
+		l := &limiter{inFlight: c.inFlight, wake: make(chan struct{})}
+		l.waiting[PriorityInteractive] = c.waiting
+		if c.used > 0 {
+			l.tokens = []*tokenMark{{at: now.Add(-30 * time.Second), n: c.used}}
+		}
+		reason, retry := l.blocked(now, c.p, c.est, c.lim)
+		if c.want == "" && reason != "" || !strings.Contains(reason, c.want) {
+			t.Errorf("%s: reason = %q, want %q", c.name, reason, c.want)
+		}
+		if retry != c.retry {
+			t.Errorf("%s: retry = %v, want %v", c.name, retry, c.retry)
+		}
+	}
+}
+
+func TestLimiterBlockedBackoffAndRPM(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	l := &limiter{wake: make(chan struct{}), backoff: now.Add(5 * time.Second)}
+	if reason, retry := l.blocked(now, PriorityInteractive, 1, config.LLMLimits{}); !strings.Contains(reason, "429") || retry != 5*time.Second {
+		t.Fatalf("backoff: %q %v", reason, retry)
+	}
+
+	// 70 秒前的请求已滑出窗口，只有 20 秒前那个计数
+	l = &limiter{wake: make(chan struct{}), requests: []time.Time{now.Add(-70 * time.Second), now.Add(-20 * time.Second)}}
+	if reason, retry := l.blocked(now, PriorityInteractive, 1, config.LLMLimits{RequestsPerMinute: 1}); !strings.Contains(reason, "requests_per_minute") || retry != 40*time.Second {
+		t.Fatalf("rpm: %q %v", reason, retry)
+	}
+	if len(l.requests) != 1 {
+		t.Fatalf("expired requests not pruned: %v", l.requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{" 30 ", 30 * time.Second},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{"Sat, 17 Oct 2026 12:00:10 GMT", 10 * time.Second},
+		{"soon", 0},
+	}
+	for _, c := range cases {
+		if got := parseRetryAfter(c.v, now); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.v, got, c.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"cata/internal/config"
 )
@@ -70,6 +71,24 @@ type wireChatRequest struct {
 	ToolChoice    interface{}              `json:"tool_choice,omitempty"`
 	Stream        bool                     `json:"stream,omitempty"`
 	Thinking      *wireThinking            `json:"thinking,omitempty"`
+	StreamOptions *wireStreamOptions       `json:"stream_options,omitempty"`
+}
+
+// wireStreamOptions 流式时请求末帧附带 usage（OpenAI / DeepSeek / DashScope 兼容）。
+type wireStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// streamUsageRejected 不接受 stream_options 的 api_url（回过 400、去掉后成功），本进程内不再发送。
+var streamUsageRejected sync.Map
+
+// streamUsageEnabled 流式请求是否带 stream_options.include_usage（llm.stream_usage 为 disabled 或端点拒绝过时不带）。
+func streamUsageEnabled(apiURL string) bool {
+	if cfg := config.Current(); cfg != nil && strings.EqualFold(strings.TrimSpace(cfg.LLM.StreamUsage), "disabled") {
+		return false
+	}
+	_, rejected := streamUsageRejected.Load(apiURL)
+	return !rejected
 }
 
 func isDeepSeekAPIURL(apiURL string) bool {
@@ -82,10 +101,10 @@ func resolveDeepSeekThinking(apiURL string, tools []Tool) *wireThinking {
 		return nil
 	}
 	mode := "auto"
-	if config.Config != nil {
-		switch strings.ToLower(strings.TrimSpace(config.Config.LLM.Thinking)) {
+	if cfg := config.Current(); cfg != nil {
+		switch strings.ToLower(strings.TrimSpace(cfg.LLM.Thinking)) {
 		case "enabled", "disabled":
-			mode = strings.ToLower(strings.TrimSpace(config.Config.LLM.Thinking))
+			mode = strings.ToLower(strings.TrimSpace(cfg.LLM.Thinking))
 		}
 	}
 	switch mode {
@@ -139,6 +158,9 @@ func marshalChatCompletionsBody(apiURL, model string, messages []Message, maxTok
 		Stream:      stream,
 		Thinking:    resolveDeepSeekThinking(apiURL, tools),
 	}
+	if stream && streamUsageEnabled(apiURL) {
+		req.StreamOptions = &wireStreamOptions{IncludeUsage: true}
+	}
 	if len(tools) > 0 {
 		req.Tools = tools
 		if toolChoice != "" {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"time"
 )
 
 // IsRetryableChatError 是否为可重试的 LLM 错误（超时、临时网络问题等）。
@@ -15,6 +16,10 @@ func IsRetryableChatError(err error) bool {
 	if errors.Is(err, context.DeadlineExceeded) {
 		return true
 	}
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return true
+	}
 	var netErr net.Error
 	if errors.As(err, &netErr) && netErr.Timeout() {
 		return true
@@ -27,3 +32,12 @@ func IsRetryableChatError(err error) bool {
 		strings.Contains(s, "eof") ||
 		strings.Contains(s, "temporary failure")
 }
+
+// RetryDelay 第 attempt 次重试前的等待：429 由 limiter 按 Retry-After 统一退避（此处不再等），其余按次数递增。
+func RetryDelay(err error, attempt int) time.Duration {
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return 0
+	}
+	return time.Duration(attempt) * time.Second
+}
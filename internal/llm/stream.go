@@ -13,8 +13,8 @@ import (
 )
 
 // ReadOpenAIChatStream 读取 OpenAI 兼容的 text/event-stream（data: JSON 行），
-// 将 assistant 文本增量交给 onDelta，并返回合并正文、工具调用与 finish_reason。
-func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content string, reasoning string, toolCalls []ToolCall, finishReason string, err error) {
+// 将 assistant 文本增量交给 onDelta，并返回合并正文、工具调用、finish_reason 与末帧 usage（未返回时为零值）。
+func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content string, reasoning string, toolCalls []ToolCall, finishReason string, usage Usage, err error) {
 	br := bufio.NewReader(r)
 	aggs := make(map[int]*streamToolAgg)
 	var contentBuf strings.Builder
@@ -25,7 +25,7 @@ func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content stri
 	for {
 		rawLine, readErr := br.ReadString('\n')
 		if readErr != nil && readErr != io.EOF {
-			return "", "", nil, "", readErr
+			return "", "", nil, "", Usage{}, readErr
 		}
 		line := strings.TrimSpace(strings.TrimSuffix(rawLine, "\r"))
 		if line == "" {
@@ -48,13 +48,16 @@ func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content stri
 			} `json:"error"`
 		}
 		if e := json.Unmarshal([]byte(payload), &wrap); e == nil && wrap.Error != nil {
-			return "", "", nil, "", fmt.Errorf("stream API error: %s", wrap.Error.Message)
+			return "", "", nil, "", Usage{}, fmt.Errorf("stream API error: %s", wrap.Error.Message)
 		}
 
 		var chunk streamChunk
 		if e := json.Unmarshal([]byte(payload), &chunk); e != nil {
 			continue
 		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
 		if len(chunk.Choices) == 0 {
 			if readErr == io.EOF {
 				break
@@ -75,7 +78,7 @@ func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content stri
 			contentBuf.WriteString(d.Content)
 			if onDelta != nil {
 				if e := onDelta(d.Content); e != nil {
-					return "", "", nil, "", e
+					return "", "", nil, "", Usage{}, e
 				}
 			}
 		}
@@ -95,7 +98,7 @@ func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content stri
 				contentBuf.WriteString(ch.Message.Content)
 				if onDelta != nil {
 				if e := onDelta(ch.Message.Content); e != nil {
-					return "", "", nil, "", e
+					return "", "", nil, "", Usage{}, e
 				}
 			}
 		}
@@ -115,10 +118,11 @@ func ReadOpenAIChatStream(r io.Reader, onDelta func(string) error) (content stri
 	if reasoning == "" {
 		reasoning = lastChoiceReasoning
 	}
-	return contentBuf.String(), reasoning, toolCalls, finishReason, nil
+	return contentBuf.String(), reasoning, toolCalls, finishReason, usage, nil
 }
 
 type streamChunk struct {
+	Usage   *Usage `json:"usage"`
 	Choices []struct {
 		Delta        streamDelta `json:"delta"`
 		FinishReason *string     `json:"finish_reason"`
@@ -198,8 +202,8 @@ func finalizeStreamToolCalls(aggs map[int]*streamToolAgg) []ToolCall {
 	return NormalizeToolCalls(out)
 }
 
-// ChatStreamRound 单次流式 chat/completions 请求。
-func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools []Tool, toolChoice string, maxTokens int, temperature float64, onDelta func(string) error) (assistant string, reasoning string, toolCalls []ToolCall, finishReason string, err error) {
+// ChatStreamRound 单次流式 chat/completions 请求；usage 在端点未返回时为估算值。
+func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools []Tool, toolChoice string, maxTokens int, temperature float64, onDelta func(string) error) (assistant string, reasoning string, toolCalls []ToolCall, finishReason string, usage Usage, err error) {
 	if maxTokens <= 0 {
 		maxTokens = c.maxTokens
 	}
@@ -214,16 +218,17 @@ func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools
 	}
 	httpReq, err := c.buildHTTPChatRequest(ctx, req, tools, toolChoice, true, true)
 	if err != nil {
-		return "", "", nil, "", err
+		return "", "", nil, "", Usage{}, err
 	}
-
-	hc := c.streamHTTPClient
-	if hc == nil {
-		hc = c.httpClient
+	slot, err := c.acquire(ctx, req.Messages, tools)
+	if err != nil {
+		return "", "", nil, "", Usage{}, err
 	}
-	resp, err := hc.Do(httpReq)
+	defer slot.release(Usage{})
+
+	resp, err := c.doStreamRequest(ctx, httpReq, req, tools, toolChoice)
 	if err != nil {
-		return "", "", nil, "", fmt.Errorf("stream request: %w", err)
+		return "", "", nil, "", Usage{}, fmt.Errorf("stream request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -233,7 +238,10 @@ func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools
 		if len(msg) > 800 {
 			msg = msg[:800] + "..."
 		}
-		return "", "", nil, "", fmt.Errorf("stream API status %d: %s", resp.StatusCode, msg)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return "", "", nil, "", Usage{}, c.rateLimited(resp.Header, msg)
+		}
+		return "", "", nil, "", Usage{}, fmt.Errorf("stream API status %d: %s", resp.StatusCode, msg)
 	}
 
 	ct := resp.Header.Get("Content-Type")
@@ -241,19 +249,35 @@ func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools
 		body, _ := io.ReadAll(resp.Body)
 		content, toolCalls2, perr := c.provider.ParseResponse(body)
 		if perr != nil {
-			return "", "", nil, "", fmt.Errorf("expected SSE stream (Content-Type=%s), got parse error: %v", ct, perr)
+			return "", "", nil, "", Usage{}, fmt.Errorf("expected SSE stream (Content-Type=%s), got parse error: %v", ct, perr)
 		}
 		if onDelta != nil && content != "" {
 			_ = onDelta(content)
 		}
-		c.appendLLMLog(req, tools, toolChoice, content, toolCalls2, body)
-		return content, "", toolCalls2, "stop", nil
+		c.appendLLMLog(ctx, req, tools, toolChoice, content, toolCalls2, body)
+		var wrap struct {
+			Usage Usage `json:"usage"`
+		}
+		_ = json.Unmarshal(body, &wrap)
+		usage = wrap.Usage
+		if usage.TotalTokens == 0 {
+			usage = estimateRoundUsage(ctx, messages, tools, content, "", toolCalls2)
+		}
+		c.recordUsage(ctx, messages, tools, usage)
+		slot.release(usage)
+		return content, "", toolCalls2, "stop", usage, nil
 	}
 
-	assistant, reasoning, toolCalls, finishReason, err = ReadOpenAIChatStream(resp.Body, onDelta)
+	assistant, reasoning, toolCalls, finishReason, usage, err = ReadOpenAIChatStream(resp.Body, onDelta)
 	if err != nil {
-		return "", "", nil, "", err
+		return "", "", nil, "", Usage{}, err
+	}
+	if usage.TotalTokens == 0 {
+		usage = estimateRoundUsage(ctx, messages, tools, assistant, reasoning, toolCalls)
 	}
+	c.recordUsage(ctx, messages, tools, usage)
+	// 非流式补发前先归还名额（max_in_flight 为 1 时不会自锁）
+	slot.release(usage)
 
 	// 若干 OpenAI 兼容端在 SSE 下 finish_reason=tool_calls 但 delta 未携带可合并的 tool_calls；
 	// 再发一次非流式请求拿到完整 tool_calls，才能进入服务端多轮工具循环。
@@ -265,14 +289,17 @@ func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools
 			MaxTokens:     maxTokens,
 			Temperature:   temperature,
 		}
-		cr, tc2, err2 := c.chat(nreq, tools, toolChoice, true)
+		cr, tc2, err2 := c.chat(ctx, nreq, tools, toolChoice, true)
 		if err2 != nil {
-			return assistant, reasoning, toolCalls, finishReason, fmt.Errorf("stream tool_calls empty, non-stream fallback failed: %w", err2)
+			return assistant, reasoning, toolCalls, finishReason, usage, fmt.Errorf("stream tool_calls empty, non-stream fallback failed: %w", err2)
 		}
 		if len(tc2) == 0 {
-			return assistant, reasoning, toolCalls, finishReason, fmt.Errorf("stream and non-stream both returned no tool_calls while finish_reason implies tools")
+			return assistant, reasoning, toolCalls, finishReason, usage, fmt.Errorf("stream and non-stream both returned no tool_calls while finish_reason implies tools")
 		}
 		toolCalls = tc2
+		if cr != nil {
+			usage.Add(cr.Usage)
+		}
 		if cr != nil && len(cr.Choices) > 0 {
 			fb := strings.TrimSpace(cr.Choices[0].Message.Content)
 			if fb != "" {
@@ -288,6 +315,38 @@ func (c *Client) ChatStreamRound(ctx context.Context, messages []Message, tools
 		finishReason = "tool_calls"
 	}
 
-	c.appendLLMLog(req, tools, toolChoice, assistant, toolCalls, nil)
-	return assistant, reasoning, toolCalls, finishReason, nil
+	c.appendLLMLog(ctx, req, tools, toolChoice, assistant, toolCalls, nil)
+	return assistant, reasoning, toolCalls, finishReason, usage, nil
+}
+
+// doStreamRequest 发送流式请求。带 stream_options 时端点回 400（部分 OpenAI 兼容网关不认识该字段）则去掉重试一次；
+// 重试成功即记住该 api_url，以后不再带（usage 改为估算）。
+func (c *Client) doStreamRequest(ctx context.Context, httpReq *http.Request, req ChatRequest, tools []Tool, toolChoice string) (*http.Response, error) {
+	hc := c.streamHTTPClient
+	if hc == nil {
+		hc = c.httpClient
+	}
+	withUsage := streamUsageEnabled(c.apiURL)
+	resp, err := hc.Do(httpReq)
+	if err != nil || resp.StatusCode != http.StatusBadRequest || !withUsage {
+		return resp, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	streamUsageRejected.Store(c.apiURL, true)
+	httpReq, err = c.buildHTTPChatRequest(ctx, req, tools, toolChoice, true, true)
+	if err == nil {
+		resp, err = hc.Do(httpReq)
+	}
+	if err != nil || resp.StatusCode != http.StatusOK {
+		// 去掉后仍失败：400 与 stream_options 无关，不记住
+		streamUsageRejected.Delete(c.apiURL)
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	log.Printf("LLM: %s rejected stream_options (400); streaming without include_usage from now on", c.apiURL)
+	return resp, nil
 }
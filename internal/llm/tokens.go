@@ -1,8 +1,10 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"cata/internal/config"
@@ -42,17 +44,17 @@ func DefaultContextWindow(model string) int {
 
 // ContextWindowTokens 返回当前客户端使用的上下文上限。
 func (c *Client) ContextWindowTokens() int {
-	if config.Config != nil && config.Config.LLM.ContextWindow > 0 {
-		return config.Config.LLM.ContextWindow
+	if cfg := config.Current(); cfg != nil && cfg.LLM.ContextWindow > 0 {
+		return cfg.LLM.ContextWindow
 	}
 	return DefaultContextWindow(c.model)
 }
 
 // ContextCompressRatioValue 会话压缩触发比例（默认 0.85）。
 func ContextCompressRatioValue() float64 {
-	if config.Config != nil && config.Config.Evolution.ContextCompressRatio > 0 &&
-		config.Config.Evolution.ContextCompressRatio <= 1 {
-		return config.Config.Evolution.ContextCompressRatio
+	if cfg := config.Current(); cfg != nil && cfg.Evolution.ContextCompressRatio > 0 &&
+		cfg.Evolution.ContextCompressRatio <= 1 {
+		return cfg.Evolution.ContextCompressRatio
 	}
 	return 0.85
 }
@@ -65,20 +67,129 @@ func ContextCompressThreshold(window int) int {
 	return int(float64(window) * ContextCompressRatioValue())
 }
 
-// EstimatedChatInputTokens 估算发往 API 前的输入 token（含 boot-leader + brain 节选注入）。
-func (c *Client) EstimatedChatInputTokens(messages []Message, tools []Tool) int {
-	wired := withBootLeaderSystemMessage(messages)
+// EstimatedChatInputTokens 估算发往 API 前的输入 token（含 boot-leader + ctx 会话的 brain 节选注入）。
+// 端点返回过真实 prompt_tokens 后按该模型的实测比例校准字符估算。
+func (c *Client) EstimatedChatInputTokens(ctx context.Context, messages []Message, tools []Tool) int {
+	wired := withBootLeaderSystemMessage(ctx, messages)
 	n := estimateMessagesTokens(wired)
 	n += estimateToolsTokens(tools)
+	n = int(float64(n) * estimateScale(c.model))
 	// 预留生成空间（与 max_tokens 无关，只避免把窗口算满）
-	if config.Config != nil && config.Config.LLM.MaxTokens > 0 {
-		n += config.Config.LLM.MaxTokens / 4
+	if cfg := config.Current(); cfg != nil && cfg.LLM.MaxTokens > 0 {
+		n += cfg.LLM.MaxTokens / 4
 	} else {
 		n += 500
 	}
 	return n
 }
 
+// Usage 一次模型调用的 token 用量（API 返回；不返回时为估算，Estimated=true）。
+// ReasoningTokens 含在 CompletionTokens 内；CachedTokens 为 PromptTokens 中命中缓存的部分。
+type Usage struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	TotalTokens      int  `json:"total_tokens"`
+	ReasoningTokens  int  `json:"reasoning_tokens,omitempty"`
+	CachedTokens     int  `json:"cached_tokens,omitempty"`
+	Estimated        bool `json:"estimated,omitempty"`
+}
+
+// UnmarshalJSON 兼容各家 usage 细分字段：OpenAI 的 *_tokens_details、DeepSeek 的 prompt_cache_hit_tokens、
+// DashScope 的 prompt_tokens_details.cached_tokens。
+func (u *Usage) UnmarshalJSON(b []byte) error {
+	var w struct {
+		PromptTokens         int  `json:"prompt_tokens"`
+		CompletionTokens     int  `json:"completion_tokens"`
+		TotalTokens          int  `json:"total_tokens"`
+		ReasoningTokens      int  `json:"reasoning_tokens"`
+		CachedTokens         int  `json:"cached_tokens"`
+		Estimated            bool `json:"estimated"`
+		PromptCacheHitTokens int  `json:"prompt_cache_hit_tokens"`
+		PromptTokensDetails  *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+		CompletionTokensDetails *struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+	}
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	*u = Usage{
+		PromptTokens:     w.PromptTokens,
+		CompletionTokens: w.CompletionTokens,
+		TotalTokens:      w.TotalTokens,
+		ReasoningTokens:  w.ReasoningTokens,
+		CachedTokens:     w.CachedTokens,
+		Estimated:        w.Estimated,
+	}
+	if w.PromptCacheHitTokens > 0 {
+		u.CachedTokens = w.PromptCacheHitTokens
+	}
+	if w.PromptTokensDetails != nil && w.PromptTokensDetails.CachedTokens > 0 {
+		u.CachedTokens = w.PromptTokensDetails.CachedTokens
+	}
+	if w.CompletionTokensDetails != nil && w.CompletionTokensDetails.ReasoningTokens > 0 {
+		u.ReasoningTokens = w.CompletionTokensDetails.ReasoningTokens
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return nil
+}
+
+// Add 累加另一份用量（任一份为估算则结果为估算）。
+func (u *Usage) Add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	u.ReasoningTokens += o.ReasoningTokens
+	u.CachedTokens += o.CachedTokens
+	u.Estimated = u.Estimated || o.Estimated
+}
+
+// estimateRoundUsage 端点未返回 usage 时按字符数粗算本轮用量。
+func estimateRoundUsage(ctx context.Context, messages []Message, tools []Tool, assistant, reasoning string, toolCalls []ToolCall) Usage {
+	in := estimateMessagesTokens(withBootLeaderSystemMessage(ctx, messages)) + estimateToolsTokens(tools)
+	out := estimateMessagesTokens([]Message{{Content: assistant + reasoning, ToolCalls: toolCalls}})
+	return Usage{PromptTokens: in, CompletionTokens: out, TotalTokens: in + out, Estimated: true}
+}
+
+// 按模型记录「真实 prompt_tokens / 字符估算」的比例，校准后续估算（指数平滑，限制在 [0.3, 3]）。
+var (
+	estimateScalesMu sync.Mutex
+	estimateScales   = map[string]float64{}
+)
+
+func estimateScale(model string) float64 {
+	estimateScalesMu.Lock()
+	defer estimateScalesMu.Unlock()
+	if f, ok := estimateScales[model]; ok {
+		return f
+	}
+	return 1
+}
+
+// calibrateEstimate 用一次真实 usage 更新 model 的估算比例。
+func calibrateEstimate(ctx context.Context, model string, messages []Message, tools []Tool, actualPrompt int) {
+	est := estimateMessagesTokens(withBootLeaderSystemMessage(ctx, messages)) + estimateToolsTokens(tools)
+	if est <= 0 || actualPrompt <= 0 {
+		return
+	}
+	r := float64(actualPrompt) / float64(est)
+	if r < 0.3 {
+		r = 0.3
+	} else if r > 3 {
+		r = 3
+	}
+	estimateScalesMu.Lock()
+	defer estimateScalesMu.Unlock()
+	if f, ok := estimateScales[model]; ok {
+		r = f*0.7 + r*0.3
+	}
+	estimateScales[model] = r
+}
+
 func estimateMessagesTokens(msgs []Message) int {
 	var chars int
 	for _, m := range msgs {
@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -18,6 +19,7 @@ import (
 type toolRoute struct {
 	serverName string
 	toolName   string
+	readOnly   bool
 }
 
 // Manager 管理已连接的 MCP server 与工具路由。
@@ -31,12 +33,27 @@ type Manager struct {
 
 	// server configs for reconnect
 	serverCfgs map[string]config.MCPServerEntry
+	// reconnectMu 串行化重连，避免并发调用各自拉起一个子进程
+	reconnectMu sync.Mutex
+}
+
+// managerIdleTTL 无回合使用的 Manager 保留多久（避免同一 mode 的下一轮重启浏览器）。
+const managerIdleTTL = 10 * time.Minute
+
+// pooled 池中一个 Manager：refs 为正在使用它的回合数。
+type pooled struct {
+	key  string
+	refs int
+	// idleSince refs 归零的时间
+	idleSince time.Time
+	// stale 配置 reload 后不再分配；refs 归零时关闭
+	stale bool
 }
 
 var (
-	global     *Manager
-	initMu     sync.Mutex
-	lastMCPKey string
+	// pool 每组 capabilities（mcpCapsKey）一个 Manager：不同 mode 的会话各用各的子进程，互不重建。
+	poolMu sync.Mutex
+	pool   = make(map[*Manager]*pooled)
 )
 
 // 终端 chat 仅暴露高频 browser 工具，避免 20+ 工具撑爆上下文导致网关/进程异常。
@@ -48,7 +65,7 @@ var preferredBrowserTools = []string{
 
 const maxExportedMCPTools = 14
 
-// Init 按配置与 capabilities 启动 MCP；失败的服务器仅记日志。
+// Init 按配置与 capabilities 启动一组 MCP server；失败的服务器仅记日志。
 func Init(cfg config.MCPConfig, caps brain.Capabilities) *Manager {
 	mgr := &Manager{
 		clients:    make(map[string]*stdioClient),
@@ -58,7 +75,6 @@ func Init(cfg config.MCPConfig, caps brain.Capabilities) *Manager {
 		maxOutput:  cfg.MaxOutputBytes,
 	}
 	if !cfg.Enabled {
-		global = mgr
 		return mgr
 	}
 	for _, s := range cfg.Servers {
@@ -77,7 +93,6 @@ func Init(cfg config.MCPConfig, caps brain.Capabilities) *Manager {
 			log.Printf("MCP server %q: %v", s.Name, err)
 		}
 	}
-	global = mgr
 	if n := len(mgr.llmTools); n > 0 {
 		log.Printf("MCP: %d tool(s) from %d server(s)", n, len(mgr.clients))
 	}
@@ -114,7 +129,7 @@ func connectServer(mgr *Manager, ctx context.Context, s config.MCPServerEntry) e
 		if !ok {
 			continue
 		}
-		mgr.routes[name] = &toolRoute{serverName: s.Name, toolName: name}
+		mgr.routes[name] = &toolRoute{serverName: s.Name, toolName: name, readOnly: t.Annotations.ReadOnlyHint}
 		mgr.llmTools = append(mgr.llmTools, toLLMTool(t))
 		exported++
 	}
@@ -130,44 +145,80 @@ func mcpCapsKey(caps brain.Capabilities) string {
 	return strings.Join(parts, ",")
 }
 
-// EnsureInit 按 capabilities 延迟初始化 MCP；mcp 列表变化时重建。
-func EnsureInit() {
-	initMu.Lock()
-	defer initMu.Unlock()
-	if config.Config == nil || !config.Config.MCP.Enabled {
-		global = &Manager{clients: make(map[string]*stdioClient), routes: make(map[string]*toolRoute)}
-		lastMCPKey = ""
-		return
+// Acquire 返回 caps 对应的 Manager（没有则启动），回合结束时须 Release。
+// 同一组 capabilities 的会话共享子进程；其他 mode 的会话用各自的 Manager，不会被重建打断。
+func Acquire(caps brain.Capabilities) *Manager {
+	cfg := config.Current()
+	if cfg == nil || !cfg.MCP.Enabled {
+		return &Manager{clients: make(map[string]*stdioClient), routes: make(map[string]*toolRoute)}
 	}
-	caps := brain.LoadActiveCapabilities()
 	key := mcpCapsKey(caps)
-	if global != nil && key == lastMCPKey {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	reapLocked(time.Now())
+	for mgr, p := range pool {
+		if p.key == key && !p.stale {
+			p.refs++
+			return mgr
+		}
+	}
+	mgr := Init(cfg.MCP, caps)
+	pool[mgr] = &pooled{key: key, refs: 1}
+	return mgr
+}
+
+// Release 回合不再使用 mgr。
+func Release(mgr *Manager) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	p := pool[mgr]
+	if p == nil {
 		return
 	}
-	shutdownLocked()
-	caps = brain.LoadActiveCapabilities()
-	Init(config.Config.MCP, caps)
-	lastMCPKey = mcpCapsKey(caps)
+	p.refs--
+	now := time.Now()
+	if p.refs == 0 {
+		p.idleSince = now
+	}
+	reapLocked(now)
 }
 
-// ReinitIfNeeded 在 capabilities.yaml 的 mcp 段变化后重建（新 chat 连接时调用）。
-func ReinitIfNeeded() {
-	EnsureInit()
+// reapLocked 关闭无人使用且已过期（reload 后或空闲超过 managerIdleTTL）的 Manager。
+func reapLocked(now time.Time) {
+	for mgr, p := range pool {
+		if p.refs > 0 || !p.stale && now.Sub(p.idleSince) < managerIdleTTL {
+			continue
+		}
+		mgr.close()
+		delete(pool, mgr)
+	}
 }
 
-func shutdownLocked() {
-	if global == nil {
-		return
+// Restart 配置中的 MCP 段变化后（reload）废弃现有 Manager：空闲的立即关闭，
+// 使用中的在其回合结束后关闭；之后的回合按新配置重建。返回是否有需要重建的 Manager。
+func Restart() bool {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	had := len(pool) > 0
+	for _, p := range pool {
+		p.stale = true
 	}
-	for name, c := range global.clients {
+	reapLocked(time.Now())
+	return had
+}
+
+// close 关闭 mgr 的全部子进程。
+func (mgr *Manager) close() {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for name, c := range mgr.clients {
 		if err := c.Close(); err != nil {
 			log.Printf("MCP close %q: %v", name, err)
 		}
 	}
-	global.clients = nil
-	global.routes = nil
-	global.llmTools = nil
-	global = nil
+	mgr.clients = nil
+	mgr.routes = nil
+	mgr.llmTools = nil
 }
 
 func (mgr *Manager) connectServer(ctx context.Context, s config.MCPServerEntry) error {
@@ -193,10 +244,17 @@ func toLLMTool(t listedTool) llm.Tool {
 	}
 }
 
-// Global 返回已初始化的 MCP 管理器（可能为 nil 或无工具）。
-func Global() *Manager {
-	EnsureInit()
-	return global
+type managerKey struct{}
+
+// WithManager 回合 ctx 携带本回合会话的 MCP Manager。
+func WithManager(ctx context.Context, mgr *Manager) context.Context {
+	return context.WithValue(ctx, managerKey{}, mgr)
+}
+
+// ManagerFrom 返回 ctx 中的 Manager；没有时为 nil（其方法均可在 nil 上调用）。
+func ManagerFrom(ctx context.Context) *Manager {
+	mgr, _ := ctx.Value(managerKey{}).(*Manager)
+	return mgr
 }
 
 // Tools 供 LLM API 注册的 MCP 工具列表。
@@ -211,6 +269,17 @@ func (mgr *Manager) Tools() []llm.Tool {
 	return out
 }
 
+// ReadOnly name 是否为 server 声明只读（readOnlyHint）的 MCP 工具。
+func (mgr *Manager) ReadOnly(name string) bool {
+	if mgr == nil {
+		return false
+	}
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+	route := mgr.routes[name]
+	return route != nil && route.readOnly
+}
+
 // TryCall 若 name 为 MCP 工具则执行并返回 ok=true。
 // 永远不向调用者返回 Go error — 浏览器错误作为文本输出，让 LLM 可见。
 func (mgr *Manager) TryCall(ctx context.Context, name, argsJSON string) (out string, err error, ok bool) {
@@ -233,6 +302,14 @@ func (mgr *Manager) TryCall(ctx context.Context, name, argsJSON string) (out str
 	} else if err := llm.ParseToolArguments(argsJSON, &args); err != nil {
 		return "", fmt.Errorf("mcp args: %w", err), true
 	}
+	if !client.alive() {
+		// 上次取消后 server 无响应被结束，或子进程自行退出
+		if c, err := mgr.reconnectServer(context.Background(), route.serverName, client); err == nil {
+			client = c
+		} else {
+			log.Printf("MCP reconnect failed: %v", err)
+		}
+	}
 	callCtx := ctx
 	if mgr.timeout > 0 {
 		var cancel context.CancelFunc
@@ -240,11 +317,16 @@ func (mgr *Manager) TryCall(ctx context.Context, name, argsJSON string) (out str
 		defer cancel()
 	}
 	text, callErr := client.callTool(callCtx, route.toolName, args)
+	if errors.Is(callErr, context.Canceled) {
+		// 只放弃了本请求，共享的子进程照常服务其他会话
+		return "[mcp] cancelled by user", nil, true
+	}
 
 	// Retry once on transient errors: reconnect browser and try again.
-	if callErr != nil && isTransientMCPError(callErr) {
+	// 超时不重试：callCtx 已到期，卡死的 server 由 cancel 的 ping 检查处理。
+	if callErr != nil && callCtx.Err() == nil && isTransientMCPError(callErr) {
 		log.Printf("MCP transient error on %s/%s: %v — reconnecting browser", route.serverName, route.toolName, callErr)
-		if newClient, reconnErr := mgr.reconnectServer(callCtx, route.serverName, client); reconnErr == nil {
+		if newClient, reconnErr := mgr.reconnectServer(context.Background(), route.serverName, client); reconnErr == nil {
 			text, callErr = newClient.callTool(callCtx, route.toolName, args)
 		} else {
 			log.Printf("MCP reconnect failed: %v", reconnErr)
@@ -263,12 +345,18 @@ func (mgr *Manager) TryCall(ctx context.Context, name, argsJSON string) (out str
 }
 
 // reconnectServer closes the old client and starts a new one for the same server name.
+// 若另一调用已完成重连，直接返回新 client。
 func (mgr *Manager) reconnectServer(ctx context.Context, name string, old *stdioClient) (*stdioClient, error) {
-	_ = old.Close()
-
+	mgr.reconnectMu.Lock()
+	defer mgr.reconnectMu.Unlock()
 	mgr.mu.RLock()
+	cur := mgr.clients[name]
 	cfg, ok := mgr.serverCfgs[name]
 	mgr.mu.RUnlock()
+	if cur != nil && cur != old {
+		return cur, nil
+	}
+	_ = old.Close()
 	if !ok {
 		return nil, fmt.Errorf("no config for server %q", name)
 	}
@@ -311,10 +399,45 @@ func IsBrowserTool(name string) bool {
 	return strings.HasPrefix(name, "browser_")
 }
 
+// ServerTools 已连接的 MCP server 及各自导出的工具数（不触发初始化）；多个 Manager 连同一 server 时取较大者。
+func ServerTools() map[string]int {
+	poolMu.Lock()
+	mgrs := make([]*Manager, 0, len(pool))
+	for mgr, p := range pool {
+		if !p.stale {
+			mgrs = append(mgrs, mgr)
+		}
+	}
+	poolMu.Unlock()
+	if len(mgrs) == 0 {
+		return nil
+	}
+	out := make(map[string]int)
+	for _, mgr := range mgrs {
+		mgr.mu.RLock()
+		n := make(map[string]int, len(mgr.clients))
+		for name := range mgr.clients {
+			n[name] = 0
+		}
+		for _, r := range mgr.routes {
+			n[r.serverName]++
+		}
+		mgr.mu.RUnlock()
+		for name, c := range n {
+			if c >= out[name] {
+				out[name] = c
+			}
+		}
+	}
+	return out
+}
+
 // Shutdown 关闭所有 MCP 子进程。
 func Shutdown() {
-	initMu.Lock()
-	defer initMu.Unlock()
-	shutdownLocked()
-	lastMCPKey = ""
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	for mgr := range pool {
+		mgr.close()
+		delete(pool, mgr)
+	}
 }
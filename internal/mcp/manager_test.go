@@ -0,0 +1,41 @@
+package mcp
+
+import (
+	"testing"
+
+	"cata/internal/brain"
+	"cata/internal/config"
+)
+
+func TestAcquirePerCaps(t *testing.T) {
+	config.Set(&config.AppConfig{MCP: config.MCPConfig{Enabled: true}})
+	defer Shutdown()
+
+	browser := brain.Capabilities{MCP: []string{"browser"}}
+	a := Acquire(browser)
+	b := Acquire(brain.Capabilities{})
+	if a == b {
+		t.Fatal("sessions with different mcp lists share a manager")
+	}
+	if again := Acquire(browser); again != a {
+		t.Fatal("same capabilities got a second manager")
+	}
+	Release(a)
+
+	if !Restart() {
+		t.Fatal("Restart reported nothing to rebuild")
+	}
+	if _, ok := pool[a]; !ok {
+		t.Fatal("manager still in use was closed by reload")
+	}
+	if fresh := Acquire(browser); fresh == a {
+		t.Fatal("stale manager handed out after reload")
+	} else {
+		Release(fresh)
+	}
+	Release(a)
+	Release(b)
+	if _, ok := pool[a]; ok {
+		t.Fatal("stale manager kept after its last turn released it")
+	}
+}
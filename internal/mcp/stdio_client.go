@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,17 +17,31 @@ import (
 
 const mcpProtocolVersion = "2024-11-05"
 
+// cancelGrace 取消请求后 server 仍须在此时间内响应 ping，否则视为卡死。
+var cancelGrace = 5 * time.Second
+
 type stdioClient struct {
-	name     string
-	cmd      *exec.Cmd
-	stdin    io.WriteCloser
-	reader   *bufio.Reader
-	mu       sync.Mutex
-	nextID   int
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	reader *bufio.Reader
+	// mu 保护 nextID、pending 与 stdin 写入
+	mu     sync.Mutex
+	nextID int
+	// pending 进行中的请求 id → 响应；取消的请求从表中删除，迟到的响应由 readLoop 丢弃
+	pending map[int]chan rpcResponse
+	// done 在 readLoop 退出（stdout 关闭、子进程结束）时关闭，readErr 为原因
+	done     chan struct{}
+	readErr  error
 	stderrMu sync.Mutex
 	stderrRB *ringBuffer
 }
 
+type rpcResponse struct {
+	result interface{}
+	err    interface{}
+}
+
 // ringBuffer holds the last N lines of stderr for diagnostics.
 type ringBuffer struct {
 	buf  []string
@@ -73,7 +88,8 @@ func startStdioClient(ctx context.Context, name, command string, args []string,
 	if strings.TrimSpace(command) == "" {
 		return nil, fmt.Errorf("mcp server %q: empty command", name)
 	}
-	cmd := exec.CommandContext(ctx, command, args...)
+	// 子进程由所有会话共享，生命周期不随启动时的 ctx 结束；ctx 只限制初始化握手
+	cmd := exec.Command(command, args...)
 	if len(env) > 0 {
 		cmd.Env = append(os.Environ(), flattenEnv(env)...)
 	}
@@ -97,9 +113,12 @@ func startStdioClient(ctx context.Context, name, command string, args []string,
 		cmd:      cmd,
 		stdin:    stdin,
 		reader:   bufio.NewReader(stdout),
+		pending:  make(map[int]chan rpcResponse),
+		done:     make(chan struct{}),
 		stderrRB: newRingBuffer(128), // keep last 128 stderr lines for diagnostics
 	}
 	go c.drainStderr(stderr)
+	go c.readLoop()
 	initCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
 	defer cancel()
 	if err := c.initialize(initCtx); err != nil {
@@ -163,6 +182,10 @@ type listedTool struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description"`
 	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations struct {
+		// ReadOnlyHint server 声明该工具不修改环境（可与其他只读工具并行）
+		ReadOnlyHint bool `json:"readOnlyHint"`
+	} `json:"annotations"`
 }
 
 func (c *stdioClient) listTools(ctx context.Context) ([]listedTool, error) {
@@ -239,6 +262,61 @@ func (c *stdioClient) Close() error {
 	return nil
 }
 
+// alive 子进程的 stdout 仍可读（readLoop 未退出）。
+func (c *stdioClient) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// cancel 放弃请求 id：通知 server 取消，之后到达的响应被丢弃。
+// 子进程由所有会话共享：只有 server 在 cancelGrace 内连 ping 都不回、且没有其他进行中的请求时才结束它，
+// 之后由 Manager 在下次调用时重连。
+func (c *stdioClient) cancel(id int, cause error) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+	reason := "cancelled by user"
+	if errors.Is(cause, context.DeadlineExceeded) {
+		reason = "timed out"
+	}
+	_ = c.notify("notifications/cancelled", map[string]interface{}{
+		"requestId": id,
+		"reason":    reason,
+	})
+	grace := cancelGrace
+	go func() {
+		ch, pingID, err := c.send("ping", nil)
+		if err != nil {
+			return
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-ch:
+			return
+		case <-c.done:
+			return
+		case <-timer.C:
+		}
+		c.mu.Lock()
+		delete(c.pending, pingID)
+		busy := len(c.pending)
+		c.mu.Unlock()
+		if busy > 0 {
+			log.Printf("MCP %s: unresponsive after cancelling request %d; %d other call(s) in flight, not restarting", c.name, id, busy)
+			return
+		}
+		log.Printf("MCP %s: unresponsive after cancelling request %d; killing server", c.name, id)
+		if c.cmd != nil && c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+		}
+	}()
+}
+
 func (c *stdioClient) notify(method string, params interface{}) error {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -252,11 +330,14 @@ func (c *stdioClient) notify(method string, params interface{}) error {
 		return err
 	}
 	data = append(data, '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	_, err = c.stdin.Write(data)
 	return err
 }
 
-func (c *stdioClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+// send 写出请求并登记等待其响应的通道。
+func (c *stdioClient) send(method string, params interface{}) (chan rpcResponse, int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	id := c.nextID
@@ -271,19 +352,50 @@ func (c *stdioClient) call(ctx context.Context, method string, params interface{
 	}
 	data, err := json.Marshal(req)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 	data = append(data, '\n')
+	ch := make(chan rpcResponse, 1)
+	c.pending[id] = ch
 	if _, err := c.stdin.Write(data); err != nil {
+		delete(c.pending, id)
+		return nil, 0, err
+	}
+	return ch, id, nil
+}
+
+func (c *stdioClient) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ch, id, err := c.send(method, params)
+	if err != nil {
 		return err
 	}
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
+	select {
+	case resp := <-ch:
+		if resp.err != nil {
+			return fmt.Errorf("mcp %q %s: %v", c.name, method, resp.err)
 		}
+		if result == nil {
+			return nil
+		}
+		resBytes, _ := json.Marshal(resp.result)
+		return json.Unmarshal(resBytes, result)
+	case <-c.done:
+		return fmt.Errorf("mcp %q read: %w", c.name, c.readErr)
+	case <-ctx.Done():
+		// 取消（chat_cancel）或超时只放弃本请求，不影响同一 server 上其他会话的调用
+		c.cancel(id, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// readLoop 是唯一读 stdout 的协程：按 id 把响应交给等待中的请求。
+func (c *stdioClient) readLoop() {
+	for {
 		line, err := c.reader.ReadBytes('\n')
 		if err != nil {
-			return fmt.Errorf("mcp %q read: %w", c.name, err)
+			c.readErr = err
+			close(c.done)
+			return
 		}
 		line = bytesTrimSpace(line)
 		if len(line) == 0 {
@@ -296,32 +408,28 @@ func (c *stdioClient) call(ctx context.Context, method string, params interface{
 		if _, isMethod := raw["method"]; isMethod {
 			continue // notification from server
 		}
-		if rawID, ok := raw["id"]; ok {
-			if !jsonIDEqual(rawID, id) {
-				continue
-			}
-		} else {
+		id, ok := jsonID(raw["id"])
+		if !ok {
 			continue
 		}
-		if errObj, ok := raw["error"]; ok && errObj != nil {
-			return fmt.Errorf("mcp %q %s: %v", c.name, method, errObj)
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- rpcResponse{result: raw["result"], err: raw["error"]}
 		}
-		if result == nil {
-			return nil
-		}
-		resBytes, _ := json.Marshal(raw["result"])
-		return json.Unmarshal(resBytes, result)
 	}
 }
 
-func jsonIDEqual(a interface{}, b int) bool {
-	switch v := a.(type) {
+func jsonID(v interface{}) (int, bool) {
+	switch v := v.(type) {
 	case float64:
-		return int(v) == b
+		return int(v), true
 	case int:
-		return v == b
+		return v, true
 	default:
-		return false
+		return 0, false
 	}
 }
 
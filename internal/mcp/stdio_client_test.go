@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess 充当 MCP server：tools/call "slow" 永不响应；
+// MCP_HELPER_STUCK=1 时收到 "slow" 后不再读 stdin（连 ping 也不回）。
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("MCP_HELPER") != "1" {
+		return
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var req struct {
+			ID     *int   `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name string `json:"name"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(sc.Bytes(), &req) != nil || req.ID == nil {
+			continue
+		}
+		if req.Method == "tools/call" && req.Params.Name == "slow" {
+			if os.Getenv("MCP_HELPER_STUCK") == "1" {
+				select {}
+			}
+			continue
+		}
+		fmt.Printf(`{"jsonrpc":"2.0","id":%d,"result":{"content":[{"type":"text","text":"%s"}]}}`+"\n", *req.ID, req.Method)
+	}
+	os.Exit(0)
+}
+
+func startHelper(t *testing.T, stuck bool) *stdioClient {
+	t.Helper()
+	env := map[string]string{"MCP_HELPER": "1"}
+	if stuck {
+		env["MCP_HELPER_STUCK"] = "1"
+	}
+	c, err := startStdioClient(context.Background(), "helper", os.Args[0], []string{"-test.run=TestHelperProcess"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestCancelKeepsResponsiveServer(t *testing.T) {
+	defer func(d time.Duration) { cancelGrace = d }(cancelGrace)
+	cancelGrace = 200 * time.Millisecond
+	c := startHelper(t, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.callTool(ctx, "slow", nil)
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("cancelled call: %v", err)
+	}
+	time.Sleep(2 * cancelGrace)
+	if !c.alive() {
+		t.Fatal("server killed although it still answers ping")
+	}
+	if out, err := c.callTool(context.Background(), "fast", nil); err != nil || out != "tools/call" {
+		t.Fatalf("call after cancel: %q %v", out, err)
+	}
+}
+
+func TestCancelKillsStuckServer(t *testing.T) {
+	defer func(d time.Duration) { cancelGrace = d }(cancelGrace)
+	cancelGrace = 200 * time.Millisecond
+	c := startHelper(t, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.callTool(ctx, "slow", nil); err != context.DeadlineExceeded {
+		t.Fatalf("timed out call: %v", err)
+	}
+	select {
+	case <-c.done:
+	case <-time.After(10 * cancelGrace):
+		t.Fatal("stuck server not killed after cancel grace")
+	}
+}
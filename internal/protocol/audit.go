@@ -0,0 +1,35 @@
+package protocol
+
+// AuditEntry 审计日志的一行：一次工具执行。
+type AuditEntry struct {
+	At      string `json:"at"`
+	Session string `json:"session,omitempty"`
+	Tool    string `json:"tool"`
+	// Args 规范化后的参数（键排序，长字符串只留长度与哈希）
+	Args string `json:"args"`
+	Cwd  string `json:"cwd,omitempty"`
+	// Path 文件工具操作的绝对路径；一次改多个文件（apply_patch）时其余路径在 Paths
+	Path  string   `json:"path,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+	// ExitCode run_command 的退出码（超时为 -1）
+	ExitCode   *int  `json:"exit_code,omitempty"`
+	DurationMS int64 `json:"duration_ms"`
+	// BytesChanged 写文件前后的字节差（绝对值）；Added / Removed 为 diff 行数
+	BytesChanged int `json:"bytes_changed,omitempty"`
+	Added        int `json:"added,omitempty"`
+	Removed      int `json:"removed,omitempty"`
+	// Approval 需确认的操作：approved / denied / auto（无需确认）
+	Approval string `json:"approval,omitempty"`
+	// OutputBytes / OutputHash 工具结果的长度与 sha256 前 16 位十六进制
+	OutputBytes int    `json:"output_bytes"`
+	OutputHash  string `json:"output_hash"`
+	Error       string `json:"error,omitempty"`
+}
+
+// AuditReport audit 应答的 Data：按条件筛出的最近 Entries（时间升序），Matched 为截断前的条数。
+type AuditReport struct {
+	Since      string       `json:"since,omitempty"`
+	Workspaces []string     `json:"workspaces"`
+	Matched    int          `json:"matched"`
+	Entries    []AuditEntry `json:"entries"`
+}
@@ -0,0 +1,28 @@
+package protocol
+
+// CheckpointFile 检查点里的一个文件：Path 为绝对路径，Bytes / Mode 为回合修改前的大小与权限；
+// Created 表示该文件在回合中新建（恢复时删除）。
+type CheckpointFile struct {
+	Path    string `json:"path"`
+	Created bool   `json:"created,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	Mode    uint32 `json:"mode,omitempty"`
+}
+
+// CheckpointInfo 一个 chat 回合的检查点：该回合首次修改各文件前的状态。ID 在会话内递增。
+type CheckpointInfo struct {
+	ID        string           `json:"id"`
+	Session   string           `json:"session"`
+	Prompt    string           `json:"prompt"`
+	CreatedAt string           `json:"created_at"`
+	Files     []CheckpointFile `json:"files"`
+}
+
+// CheckpointRestore checkpoint_restore 应答的 Data：按从新到旧撤销的检查点与恢复的文件。
+type CheckpointRestore struct {
+	Checkpoints []string `json:"checkpoints"`
+	// Restored 恢复了内容的文件；Removed 回合中新建、已删除的文件；Failed 无法恢复的文件及原因
+	Restored []string `json:"restored,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Failed   []string `json:"failed,omitempty"`
+}
@@ -0,0 +1,317 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 流式 chat 事件类型（每行 JSON 的 type 字段）。
+const (
+	EventProgress            = "progress"
+	EventToken               = "token"
+	EventUsage               = "usage"
+	EventToolStart           = "tool_start"
+	EventToolResult          = "tool_result"
+	EventToolOutput          = "tool_output"
+	EventExecConfirmRequired = "exec_confirm_required"
+	EventExecDenied          = "exec_denied"
+	EventExecDone            = "exec_done"
+	EventFileConfirmRequired = "file_confirm_required"
+	EventUserChoice          = "user_choice"
+	EventDiff                = "diff"
+	EventFileWritten         = "file_written"
+	EventLimitReached        = "limit_reached"
+	EventError               = "error"
+	EventDone                = "done"
+)
+
+// 显示级别（display 字段）：客户端据此决定展示多少，可被 --quiet / --verbose 覆盖。
+const (
+	// DisplaySilent 不展示内容（如 read_file 成功）
+	DisplaySilent = "silent"
+	// DisplayNormal 展示摘要 / 截断内容（如文件 diff）
+	DisplayNormal = "normal"
+	// DisplayVerbose 展示完整内容（run_command 结果、工具出错）
+	DisplayVerbose = "verbose"
+)
+
+// Event 一条流式事件；结构体不含 type 字段，由 Encode 按 EventType 写入。
+type Event interface {
+	EventType() string
+}
+
+// Progress 状态提示（模型轮次、压缩、重试等）。
+type Progress struct {
+	Message string `json:"message"`
+}
+
+// Token 回复正文增量。
+type Token struct {
+	Content string `json:"content"`
+}
+
+// Usage 一轮模型调用的 token 用量（Estimated 为端点未返回时的估算）。
+// ReasoningTokens 含在 CompletionTokens 内，CachedTokens 为 PromptTokens 中命中缓存的部分；Cost 仅在价格表有该模型时给出。
+type Usage struct {
+	Round            int     `json:"round"`
+	Model            string  `json:"model,omitempty"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	TotalTokens      int     `json:"total_tokens"`
+	Estimated        bool    `json:"estimated"`
+	Cost             float64 `json:"cost,omitempty"`
+}
+
+// ToolStart 开始执行一个工具调用。
+type ToolStart struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Display string `json:"display,omitempty"`
+}
+
+// ToolResult 工具调用结果（即写入 history 的 tool 消息）。
+type ToolResult struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Output  string `json:"output"`
+	Display string `json:"display,omitempty"`
+}
+
+// ToolOutput run_command 运行中的输出（限速合并后推送）：Lines 为新的完整行（同一 Stream，stdout / stderr）；
+// Skipped 为限速丢弃的行数；没有新输出时也定期推送（Lines 为空）以更新 ElapsedMS。完整结果仍以 tool_result 为准。
+type ToolOutput struct {
+	ToolID    string   `json:"tool_id"`
+	Stream    string   `json:"stream,omitempty"`
+	Lines     []string `json:"lines,omitempty"`
+	Skipped   int      `json:"skipped,omitempty"`
+	ElapsedMS int64    `json:"elapsed_ms"`
+}
+
+// Diff 文件工具写入前后的 unified diff（紧随其后是同一文件的 file_written）。
+type Diff struct {
+	ToolID  string `json:"tool_id,omitempty"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Display string `json:"display,omitempty"`
+}
+
+// FileWritten 文件工具已写盘；Path 为解析后的绝对路径，Created 表示新建文件，Deleted 表示已删除，
+// From 非空时文件由该路径改名而来。
+type FileWritten struct {
+	ToolID  string `json:"tool_id,omitempty"`
+	Path    string `json:"path"`
+	Bytes   int    `json:"bytes"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Created bool   `json:"created,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+	From    string `json:"from,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// ChoiceOption exec_confirm_required / user_choice 的一个选项。
+type ChoiceOption struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Desc  string `json:"desc,omitempty"`
+}
+
+// AskChoice 无人值守时按 choice 从 user_choice 选项中选一个：id、1 起序号或 first；不匹配或为空时取消（空选择）。
+// cata ask --choice 与 server 的定时任务 / 后台任务共用此规则。
+func AskChoice(choice string, options []ChoiceOption) []string {
+	choice = strings.TrimSpace(choice)
+	if choice == "" {
+		return nil
+	}
+	var ids []string
+	for _, o := range options {
+		ids = append(ids, o.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if choice == "first" {
+		return []string{ids[0]}
+	}
+	for _, id := range ids {
+		if id == choice {
+			return []string{id}
+		}
+	}
+	if n, err := strconv.Atoi(choice); err == nil && n >= 1 && n <= len(ids) {
+		return []string{ids[n-1]}
+	}
+	return nil
+}
+
+// ExecConfirmRequired run_command 需用户确认；客户端回 exec_confirm。
+type ExecConfirmRequired struct {
+	ConfirmID   string         `json:"confirm_id"`
+	Argv        []string       `json:"argv"`
+	CommandLine string         `json:"command_line"`
+	Cwd         string         `json:"cwd"`
+	Options     []ChoiceOption `json:"options,omitempty"`
+}
+
+// FileConfirmRequired 文件工具的修改命中 workspace_files 的确认规则，写盘前需用户确认；客户端回 exec_confirm
+// （approved，拒绝时可带 reason，编辑后批准时带 edited_content）。Path / From 为绝对路径；Content 为拟写入的完整内容（删除时为空）。
+type FileConfirmRequired struct {
+	ConfirmID string         `json:"confirm_id"`
+	Tool      string         `json:"tool"`
+	Path      string         `json:"path"`
+	From      string         `json:"from,omitempty"`
+	Diff      string         `json:"diff"`
+	Added     int            `json:"added"`
+	Removed   int            `json:"removed"`
+	Created   bool           `json:"created,omitempty"`
+	Deleted   bool           `json:"deleted,omitempty"`
+	Content   string         `json:"content,omitempty"`
+	Options   []ChoiceOption `json:"options,omitempty"`
+}
+
+// ExecDenied 用户拒绝了 run_command。
+type ExecDenied struct {
+	ConfirmID   string `json:"confirm_id"`
+	CommandLine string `json:"command_line"`
+	Cwd         string `json:"cwd"`
+}
+
+// ExecDone run_command 结束。
+type ExecDone struct {
+	Argv        []string `json:"argv"`
+	CommandLine string   `json:"command_line"`
+	Cwd         string   `json:"cwd"`
+	ExitCode    int      `json:"exit_code"`
+	TimedOut    bool     `json:"timed_out"`
+	Truncated   bool     `json:"truncated"`
+}
+
+// UserChoice ask_user：请用户选择；客户端回 user_choice。
+type UserChoice struct {
+	ID      string         `json:"id"`
+	Prompt  string         `json:"prompt"`
+	Detail  string         `json:"detail"`
+	Multi   bool           `json:"multi"`
+	Options []ChoiceOption `json:"options"`
+}
+
+// 回合上限种类（LimitReached.Limit、Done.Limit）。
+const (
+	LimitRounds    = "rounds"
+	LimitToolCalls = "tool_calls"
+	// LimitTime Used / Max 为秒
+	LimitTime = "time"
+	// LimitLoop 检测到重复工具调用、用户选择停止（仅见于 Done.Limit）
+	LimitLoop = "loop"
+)
+
+// LimitReached 回合达到上限（见 config turn）。Options 非空时客户端回 user_choice（ChoiceID=ID，选 extend 或 stop）；
+// 为空（客户端不支持 turn_limits）或选 stop 时，模型不带工具做最后一轮总结后结束回合。
+type LimitReached struct {
+	ID      string         `json:"id"`
+	Limit   string         `json:"limit"`
+	Used    int            `json:"used"`
+	Max     int            `json:"max"`
+	Options []ChoiceOption `json:"options,omitempty"`
+}
+
+// Error 错误提示（回合可能继续；以 Done 为准）。
+type Error struct {
+	Message string `json:"message"`
+}
+
+// Done 回合结束（每个 chat 请求恰好一条）；Session 为本连接 history 的持久化会话 id（重连后可 session_resume）。
+type Done struct {
+	Success   bool   `json:"success"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+	Session   string `json:"session,omitempty"`
+	// Limit 回合因该上限提前总结结束（rounds / tool_calls / time）
+	Limit string `json:"limit,omitempty"`
+}
+
+func (Progress) EventType() string            { return EventProgress }
+func (Token) EventType() string               { return EventToken }
+func (Usage) EventType() string               { return EventUsage }
+func (ToolStart) EventType() string           { return EventToolStart }
+func (ToolResult) EventType() string          { return EventToolResult }
+func (ToolOutput) EventType() string          { return EventToolOutput }
+func (ExecConfirmRequired) EventType() string { return EventExecConfirmRequired }
+func (ExecDenied) EventType() string          { return EventExecDenied }
+func (ExecDone) EventType() string            { return EventExecDone }
+func (FileConfirmRequired) EventType() string { return EventFileConfirmRequired }
+func (UserChoice) EventType() string          { return EventUserChoice }
+func (Diff) EventType() string                { return EventDiff }
+func (FileWritten) EventType() string         { return EventFileWritten }
+func (LimitReached) EventType() string        { return EventLimitReached }
+func (Error) EventType() string               { return EventError }
+func (Done) EventType() string                { return EventDone }
+
+// Encode 序列化事件为一行 JSON（不含换行），type 字段在最前。
+func Encode(ev Event) ([]byte, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	head := []byte(`{"type":` + fmt.Sprintf("%q", ev.EventType()))
+	if len(body) <= 2 {
+		return append(head, '}'), nil
+	}
+	return append(append(head, ','), body[1:]...), nil
+}
+
+// Decode 解析一行事件；未知 type 返回 nil 事件与 nil 错误（新特性事件，旧客户端忽略）。
+func Decode(line []byte) (Event, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(line, &head); err != nil {
+		return nil, err
+	}
+	var ev Event
+	switch head.Type {
+	case EventProgress:
+		ev = &Progress{}
+	case EventToken:
+		ev = &Token{}
+	case EventUsage:
+		ev = &Usage{}
+	case EventToolStart:
+		ev = &ToolStart{}
+	case EventToolResult:
+		ev = &ToolResult{}
+	case EventToolOutput:
+		ev = &ToolOutput{}
+	case EventExecConfirmRequired:
+		ev = &ExecConfirmRequired{}
+	case EventExecDenied:
+		ev = &ExecDenied{}
+	case EventExecDone:
+		ev = &ExecDone{}
+	case EventFileConfirmRequired:
+		ev = &FileConfirmRequired{}
+	case EventUserChoice:
+		ev = &UserChoice{}
+	case EventDiff:
+		ev = &Diff{}
+	case EventFileWritten:
+		ev = &FileWritten{}
+	case EventLimitReached:
+		ev = &LimitReached{}
+	case EventError:
+		ev = &Error{}
+	case EventDone:
+		ev = &Done{}
+	default:
+		return nil, nil
+	}
+	if err := json.Unmarshal(line, ev); err != nil {
+		return nil, fmt.Errorf("decode %s event: %w", head.Type, err)
+	}
+	return ev, nil
+}
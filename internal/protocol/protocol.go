@@ -0,0 +1,187 @@
+// Package protocol cata chat 客户端与 server 之间的 Unix socket 协议：每行一条 JSON（NDJSON）。
+// 客户端发送 Request；非流式命令回一条 Response，流式 chat 回若干 Event，最后一条为 Done。
+// 连接建立后客户端先发 hello 协商版本与特性，版本不兼容时拒绝运行而不是在流中途失败。
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cata/internal/brain"
+)
+
+// Version 当前协议版本；MinVersion 本端仍可互通的最低版本。
+// 不兼容的改动（删除/改义字段或事件）须增加 Version 并提高 MinVersion；只新增字段、事件或命令时用 Feature 声明。
+const (
+	Version    = 1
+	MinVersion = 1
+)
+
+// 特性标志：hello 双方各自声明，协商结果取交集。
+const (
+	FeatureChatCancel = "chat_cancel"
+	FeatureSessions   = "sessions"
+	FeatureUsage      = "usage"
+	// FeatureServerControl status / stop / restart 命令
+	FeatureServerControl = "server_control"
+	// FeatureReload reload 命令（重新加载配置）
+	FeatureReload = "reload"
+	// FeatureFileEvents 文件工具写入时推送 diff / file_written 事件，工具事件带 display 提示
+	FeatureFileEvents = "file_events"
+	// FeatureUsageLedger usage 命令（用量台账汇总，/cost 与 cata usage）
+	FeatureUsageLedger = "usage_ledger"
+	// FeatureTurnLimits 客户端会应答 limit_reached（延长或收尾）；不支持的客户端到达上限即收尾
+	FeatureTurnLimits = "turn_limits"
+	// FeatureAuditLog audit 命令（工具执行审计日志查询，cata audit）
+	FeatureAuditLog = "audit_log"
+	// FeatureSchedule server 执行 $CATA_HOME/schedule 中的定时任务
+	FeatureSchedule = "schedule"
+	// FeatureTasks 后台 task 队列：task_submit / task_list / task_status / task_attach / task_cancel
+	FeatureTasks = "tasks"
+	// FeatureCheckpoints 文件修改检查点：checkpoint_list / checkpoint_restore（/checkpoints、/undo、/restore）
+	FeatureCheckpoints = "checkpoints"
+	// FeatureEditConfirm 客户端会应答 file_confirm_required（批准、拒绝或编辑后批准）；不支持的客户端上需确认的修改一律拒绝
+	FeatureEditConfirm = "edit_confirm"
+	// FeatureToolOutput run_command 运行中推送 tool_output（输出行与已用时间）
+	FeatureToolOutput = "tool_output"
+)
+
+// Features 本端支持的特性。
+var Features = []string{FeatureChatCancel, FeatureSessions, FeatureUsage, FeatureServerControl, FeatureReload, FeatureFileEvents, FeatureUsageLedger, FeatureTurnLimits, FeatureAuditLog, FeatureSchedule, FeatureTasks, FeatureCheckpoints, FeatureEditConfirm, FeatureToolOutput}
+
+// 命令（Request.Command）。
+const (
+	CmdHello         = "hello"
+	CmdPing          = "ping"
+	CmdChat          = "chat"
+	CmdChatReset     = "chat_reset"
+	CmdChatCancel    = "chat_cancel"
+	CmdExecConfirm   = "exec_confirm"
+	CmdUserChoice    = "user_choice"
+	CmdSessionList   = "session_list"
+	CmdSessionResume = "session_resume"
+	CmdStatus        = "status"
+	CmdStop          = "stop"
+	CmdRestart       = "restart"
+	CmdReload        = "reload"
+	CmdUsage         = "usage"
+	CmdAudit         = "audit"
+	CmdTaskSubmit    = "task_submit"
+	CmdTaskList      = "task_list"
+	CmdTaskStatus    = "task_status"
+	CmdTaskAttach    = "task_attach"
+	CmdTaskCancel    = "task_cancel"
+	// CmdCheckpointList / CmdCheckpointRestore 本连接会话的文件检查点
+	CmdCheckpointList    = "checkpoint_list"
+	CmdCheckpointRestore = "checkpoint_restore"
+)
+
+// Request 客户端请求。
+type Request struct {
+	Command string `json:"command"`
+	// Text 用于 chat 的完整用户输入
+	Text string `json:"text,omitempty"`
+	// Stream 为 true 时 chat 走 NDJSON 流式事件（token / tool_* / done 等）
+	Stream bool `json:"stream,omitempty"`
+	// ExecConfirm：流式 chat 中收到 exec_confirm_required / file_confirm_required 后由客户端发送（非 LLM）
+	ConfirmID string `json:"confirm_id,omitempty"`
+	Approved  bool   `json:"approved,omitempty"`
+	// Reason 拒绝文件修改的理由（交给模型）；EditedContent 非 nil 时按用户编辑后的内容写入
+	Reason        string  `json:"reason,omitempty"`
+	EditedContent *string `json:"edited_content,omitempty"`
+	// Cwd 产出区：当前工作目录（命令与交付物）；用于选脑子分区 + exec.cwd
+	Cwd string `json:"cwd,omitempty"`
+	// Dirs 多产出区（cata chat --dir 可重复）；Dirs[0] 为主产出区，与 Cwd 一致；旧客户端只发 Cwd
+	Dirs []string `json:"dirs,omitempty"`
+	// Runtime 客户端所在 OS/终端（注入 LLM，避免生成需多轮纠正的命令）
+	Runtime *brain.RuntimeEnv `json:"runtime,omitempty"`
+	// UserChoice：流式 chat 中收到 user_choice 后由客户端发送
+	ChoiceID string   `json:"choice_id,omitempty"`
+	Selected []string `json:"selected,omitempty"`
+	// Session session_resume 的会话 id；空为该产出区 workspace 最近的会话
+	Session string `json:"session,omitempty"`
+	// Since / All usage、audit：只看 Since（RFC3339）之后的记录；All 为全部脑子分区而非当前产出区
+	Since string `json:"since,omitempty"`
+	All   bool   `json:"all,omitempty"`
+	// Tool / Path / Limit audit：按工具名、路径（绝对路径或 glob）筛选，只返回最近 Limit 条（0 为全部）
+	Tool  string `json:"tool,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+	// Task task_status / task_attach / task_cancel 的 task id；Policy task_submit 的无人应答策略
+	Task   string      `json:"task,omitempty"`
+	Policy *TaskPolicy `json:"policy,omitempty"`
+	// Checkpoint checkpoint_restore 的检查点 id：撤销它及之后的所有回合；空为最近一个（/undo）
+	Checkpoint string `json:"checkpoint,omitempty"`
+	// Version / MinVersion / Features hello 时客户端的协议版本范围与特性
+	Version    int      `json:"version,omitempty"`
+	MinVersion int      `json:"min_version,omitempty"`
+	Features   []string `json:"features,omitempty"`
+}
+
+// Response 非流式命令的应答。
+type Response struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// DecodeData 将 Data 解到 v（客户端解码后 Data 为通用 JSON 值）。
+func (r Response) DecodeData(v interface{}) error {
+	if r.Data == nil {
+		return nil
+	}
+	b, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// HelloRequest 本端的 hello 请求。
+func HelloRequest() Request {
+	return Request{Command: CmdHello, Version: Version, MinVersion: MinVersion, Features: Features}
+}
+
+// Hello hello 应答的 Data：server 的版本范围与协商后的特性。
+type Hello struct {
+	Version    int      `json:"version"`
+	MinVersion int      `json:"min_version"`
+	Features   []string `json:"features"`
+}
+
+// Negotiate 对端（peerVersion, peerFeatures）与本端协商：返回共同版本与特性交集；无共同版本时返回错误。
+// peerMin 为对端可接受的最低版本（客户端请求里没有时传 peerVersion）。
+func Negotiate(peerVersion, peerMin int, peerFeatures []string) (version int, features []string, err error) {
+	if peerVersion < MinVersion {
+		return 0, nil, &VersionError{Local: Version, LocalMin: MinVersion, Peer: peerVersion}
+	}
+	if peerMin > Version {
+		return 0, nil, &VersionError{Local: Version, LocalMin: MinVersion, Peer: peerMin}
+	}
+	version = Version
+	if peerVersion < version {
+		version = peerVersion
+	}
+	have := make(map[string]bool, len(Features))
+	for _, f := range Features {
+		have[f] = true
+	}
+	for _, f := range peerFeatures {
+		if have[f] {
+			features = append(features, f)
+		}
+	}
+	return version, features, nil
+}
+
+// VersionError 协议版本无交集。
+type VersionError struct {
+	Local, LocalMin, Peer int
+}
+
+func (e *VersionError) Error() string {
+	if e.Peer < e.LocalMin {
+		return fmt.Sprintf("protocol version mismatch: peer speaks v%d, need ≥ v%d", e.Peer, e.LocalMin)
+	}
+	return fmt.Sprintf("protocol version mismatch: peer needs ≥ v%d, this build speaks v%d", e.Peer, e.Local)
+}
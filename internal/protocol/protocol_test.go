@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	b, err := Encode(Done{})
+	if err != nil || string(b) != `{"type":"done","success":false}` {
+		t.Fatalf("Encode(Done{}) = %s, %v", b, err)
+	}
+	b, err = Encode(ExecDone{CommandLine: "ls", ExitCode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := ev.(*ExecDone)
+	if !ok || got.CommandLine != "ls" || got.ExitCode != 2 {
+		t.Fatalf("Decode = %#v", ev)
+	}
+	if ev, err := Decode([]byte(`{"type":"future_event"}`)); ev != nil || err != nil {
+		t.Fatalf("unknown type: %#v, %v", ev, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	v, f, err := Negotiate(Version+1, MinVersion, []string{FeatureUsage, "unknown"})
+	if err != nil || v != Version || len(f) != 1 || f[0] != FeatureUsage {
+		t.Fatalf("newer peer: v=%d f=%v err=%v", v, f, err)
+	}
+	if _, _, err := Negotiate(Version+1, Version+1, nil); err == nil {
+		t.Fatal("peer requiring a newer version must fail")
+	}
+	if _, _, err := Negotiate(MinVersion-1, MinVersion-1, nil); err == nil {
+		t.Fatal("peer older than MinVersion must fail")
+	}
+}
+
+func TestAskChoice(t *testing.T) {
+	opts := []ChoiceOption{{ID: "a", Label: "A"}, {ID: "b", Label: "B"}}
+	cases := []struct {
+		choice string
+		want   string
+	}{
+		{"", ""},
+		{"first", "a"},
+		{"b", "b"},
+		{" 2 ", "b"},
+		{"3", ""},
+		{"c", ""},
+	}
+	for _, c := range cases {
+		got := strings.Join(AskChoice(c.choice, opts), ",")
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.choice, got, c.want)
+		}
+	}
+}
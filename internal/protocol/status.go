@@ -0,0 +1,66 @@
+package protocol
+
+// Status status 应答的 Data：server 进程、已连接的 chat 客户端、MCP 与后台演进概况。
+type Status struct {
+	PID       int    `json:"pid"`
+	StartedAt string `json:"started_at"`
+	// Managed 由 cata chat 自动拉起（最后一个 chat 断开后退出）
+	Managed    bool              `json:"managed"`
+	Socket     string            `json:"socket"`
+	Version    int               `json:"version"`
+	Clients    []ClientStatus    `json:"clients"`
+	Workspaces []WorkspaceStatus `json:"workspaces"`
+	MCP        []MCPServerStatus `json:"mcp"`
+	Evolution  EvolutionStatus   `json:"evolution"`
+}
+
+// ClientStatus 一条 chat 连接。
+type ClientStatus struct {
+	ConnectedAt string   `json:"connected_at"`
+	Dirs        []string `json:"dirs,omitempty"`
+	Workspace   string   `json:"workspace,omitempty"`
+	Session     string   `json:"session,omitempty"`
+	// InTurn 回合进行中
+	InTurn bool `json:"in_turn"`
+}
+
+// WorkspaceStatus 已连接客户端所用的脑子分区及其最近一次演进。
+type WorkspaceStatus struct {
+	ID                  string `json:"id"`
+	Root                string `json:"root"`
+	LastEvolutionAt     string `json:"last_evolution_at,omitempty"`
+	LastEvolutionAction string `json:"last_evolution_action,omitempty"`
+}
+
+// MCPServerStatus 已连接的 MCP server。
+type MCPServerStatus struct {
+	Name  string `json:"name"`
+	Tools int    `json:"tools"`
+}
+
+// EvolutionStatus 后台演进引擎；LastRun / NextRun 为空表示未启用或尚未运行。
+type EvolutionStatus struct {
+	Enabled         bool   `json:"enabled"`
+	IntervalSeconds int    `json:"interval_seconds,omitempty"`
+	LastRun         string `json:"last_run,omitempty"`
+	NextRun         string `json:"next_run,omitempty"`
+}
+
+// ConfigChange 配置中一个字段的变化（Key 为 JSON 路径，如 exec.enabled）。
+type ConfigChange struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+	// Restart 该项只在 server 启动时读取，需 cata restart 才生效
+	Restart bool `json:"restart,omitempty"`
+}
+
+// Reload reload 应答的 Data。
+type Reload struct {
+	Config  string         `json:"config"`
+	Changes []ConfigChange `json:"changes"`
+	// PendingTurns 进行中的回合数；大于 0 时新配置在这些回合结束后生效
+	PendingTurns int `json:"pending_turns,omitempty"`
+	// MCPRestarted MCP 段变化且已按新配置重建子进程
+	MCPRestarted bool `json:"mcp_restarted,omitempty"`
+}
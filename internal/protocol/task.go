@@ -0,0 +1,45 @@
+package protocol
+
+// 后台 task 的状态（TaskInfo.State）。
+const (
+	TaskQueued      = "queued"
+	TaskRunning     = "running"
+	TaskDone        = "done"
+	TaskFailed      = "failed"
+	TaskCancelled   = "cancelled"
+	TaskInterrupted = "interrupted" // server 停止时仍在运行
+)
+
+// TaskPolicy 无客户端 attach 时对确认与选择的应答策略；Exec 为空且 Choice 为空时等待 attach 的客户端。
+type TaskPolicy struct {
+	// Exec approve / deny：run_command 确认自动批准 / 拒绝
+	Exec string `json:"exec,omitempty"`
+	// Choice ask_user 的默认选择（同 cata ask --choice）
+	Choice string `json:"choice,omitempty"`
+	// Extend limit_reached 时延长（默认收尾）
+	Extend bool `json:"extend,omitempty"`
+}
+
+// Waits 是否等待 attach 的客户端应答（未给任何自动策略）。
+func (p TaskPolicy) Waits() bool {
+	return p.Exec == "" && p.Choice == "" && !p.Extend
+}
+
+// TaskInfo 一个后台 task（task_submit / task_list / task_status 的 Data）。
+type TaskInfo struct {
+	ID          string     `json:"id"`
+	Prompt      string     `json:"prompt"`
+	Dirs        []string   `json:"dirs"`
+	Policy      TaskPolicy `json:"policy"`
+	State       string     `json:"state"`
+	SubmittedAt string     `json:"submitted_at"`
+	StartedAt   string     `json:"started_at,omitempty"`
+	FinishedAt  string     `json:"finished_at,omitempty"`
+	// Session 回合的会话 id（可 cata chat --resume 续聊）
+	Session string `json:"session,omitempty"`
+	// Attached 当前 attach 的客户端数；Waiting 等待应答的请求摘要
+	Attached int    `json:"attached,omitempty"`
+	Waiting  string `json:"waiting,omitempty"`
+	Limit    string `json:"limit,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
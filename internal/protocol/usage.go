@@ -0,0 +1,29 @@
+package protocol
+
+// UsageTotals 一组模型调用的 token 与费用合计。
+type UsageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+	// Estimated 端点未返回 usage、按字符估算的调用数
+	Estimated int `json:"estimated"`
+	// Unpriced 价格表里找不到模型、未计费的调用数
+	Unpriced int `json:"unpriced"`
+}
+
+// UsageReport usage 应答的 Data：Since 之后的台账汇总（Workspaces 为空表示全部分区）。
+type UsageReport struct {
+	Since      string   `json:"since,omitempty"`
+	Workspaces []string `json:"workspaces"`
+	// Session 当前连接会话的合计（仅 /cost，且会话已有调用时）
+	SessionID string       `json:"session_id,omitempty"`
+	Session   *UsageTotals `json:"session,omitempty"`
+	Total     UsageTotals  `json:"total"`
+	// ByRole 按 LLM 角色（chat、evolution…）；ByModel 按模型名
+	ByRole  map[string]UsageTotals `json:"by_role"`
+	ByModel map[string]UsageTotals `json:"by_model"`
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	loc := time.UTC
+	// 2026-10-16 是周五
+	from := time.Date(2026, 10, 16, 9, 30, 0, 0, loc)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 9 * * 1-5", time.Date(2026, 10, 19, 9, 0, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 9, 45, 0, 0, loc)},
+		{"30 9 * * *", time.Date(2026, 10, 17, 9, 30, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, loc)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, loc)},
+		{"0 12 * jan sun", time.Date(2027, 1, 3, 12, 0, 0, 0, loc)},
+		{"0 8 13 * 5", time.Date(2026, 10, 23, 8, 0, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, loc)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cr, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", c.expr, err)
+		}
+		if got := cr.Next(from); !got.Equal(c.want) {
+			t.Errorf("%q: next = %v, want %v", c.expr, got, c.want)
+		}
+		if !c.want.IsZero() && !cr.Match(c.want) {
+			t.Errorf("%q: does not match its own next run %v", c.expr, c.want)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package schedule 定时任务：cron 表达式 + 产出区 + 提示词，存于 $CATA_HOME/schedule/jobs.json（由 cata schedule 增删）。
+// server 每分钟检查到期任务，经与 chat 相同的工具循环无人值守执行；每次运行的事件流写入
+// schedule/logs/<job>/<时间>.ndjson，运行记录追加到 schedule/runs.jsonl。
+package schedule
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cata/internal/clock"
+	"cata/internal/config"
+)
+
+// Job 一个定时任务。Approve / Choice 为无人值守时的应答策略（同 cata ask 的 --approve / --choice）。
+type Job struct {
+	ID        string   `json:"id"`
+	Cron      string   `json:"cron"`
+	Dirs      []string `json:"dirs"`
+	Prompt    string   `json:"prompt"`
+	Approve   bool     `json:"approve,omitempty"`
+	Choice    string   `json:"choice,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// Run 一次运行的记录（runs.jsonl 的一行）。
+type Run struct {
+	Job        string `json:"job"`
+	At         string `json:"at"`
+	Transcript string `json:"transcript"`
+	Session    string `json:"session,omitempty"`
+	Success    bool   `json:"success"`
+	Cancelled  bool   `json:"cancelled,omitempty"`
+	Limit      string `json:"limit,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Dir 定时任务状态目录。
+func Dir() string {
+	return filepath.Join(config.CataHome(), "schedule")
+}
+
+func jobsPath() string { return filepath.Join(Dir(), "jobs.json") }
+func runsPath() string { return filepath.Join(Dir(), "runs.jsonl") }
+
+// TranscriptPath 一次运行的事件流文件；name 为 Run.Transcript。
+func TranscriptPath(job, name string) string {
+	return filepath.Join(Dir(), "logs", job, name)
+}
+
+var mu sync.Mutex
+
+// Load 读取全部任务（文件不存在时为空）。
+func Load() ([]Job, error) {
+	data, err := os.ReadFile(jobsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("%s: %w", jobsPath(), err)
+	}
+	return jobs, nil
+}
+
+// save 原子写回任务列表。
+func save(jobs []Job) error {
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := jobsPath() + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, jobsPath())
+}
+
+// Add 校验并保存新任务，返回分配了 id 的任务。
+func Add(j Job) (Job, error) {
+	if _, err := ParseCron(j.Cron); err != nil {
+		return j, err
+	}
+	if strings.TrimSpace(j.Prompt) == "" {
+		return j, fmt.Errorf("empty prompt")
+	}
+	if len(j.Dirs) == 0 {
+		return j, fmt.Errorf("at least one --dir required")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	jobs, err := Load()
+	if err != nil {
+		return j, err
+	}
+	j.ID = newJobID()
+	j.CreatedAt = clock.RFC3339()
+	return j, save(append(jobs, j))
+}
+
+// Remove 删除任务（保留其运行记录与事件流）。
+func Remove(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	jobs, err := Load()
+	if err != nil {
+		return err
+	}
+	for i, j := range jobs {
+		if j.ID == id {
+			return save(append(jobs[:i], jobs[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no scheduled job %q", id)
+}
+
+func newJobID() string {
+	var b [3]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("j%d", time.Now().Unix()%100000)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NextRun 任务在 after 之后的下一次触发时间（表达式无效时为零值）。
+func (j Job) NextRun(after time.Time) time.Time {
+	c, err := ParseCron(j.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(after)
+}
+
+// AppendRun 追加一条运行记录。
+func AppendRun(r Run) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(runsPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Runs 读取运行记录（追加顺序即时间顺序）；job 非空时只取该任务。坏行跳过。
+func Runs(job string) ([]Run, error) {
+	data, err := os.ReadFile(runsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Run
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var r Run
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		if job == "" || r.Job == job {
+			out = append(out, r)
+		}
+	}
+	return out, sc.Err()
+}
+
+// LastRuns 每个任务最近一次运行。
+func LastRuns() (map[string]Run, error) {
+	runs, err := Runs("")
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[string]Run)
+	for _, r := range runs {
+		last[r.Job] = r
+	}
+	return last, nil
+}
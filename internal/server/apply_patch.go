@@ -0,0 +1,304 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/checkpoint"
+	"cata/internal/llm"
+	"cata/internal/textdiff"
+)
+
+// patchFile apply_patch 过程中一个文件的内存状态；全部 hunk 通过后才写盘。
+type patchFile struct {
+	path string
+	full string
+	mode os.FileMode
+	// existed / old 打补丁前的磁盘状态
+	existed bool
+	old     string
+	// exists / cur 打补丁后的状态
+	exists bool
+	cur    string
+	// from 由改名而来时的源文件
+	from *patchFile
+	// movedTo 被改名走时的目标（其删除并入目标的变更）
+	movedTo *patchFile
+	// edited cur 经用户编辑后才批准
+	edited bool
+}
+
+func (f *patchFile) changed() bool {
+	return f.exists != f.existed || f.cur != f.old
+}
+
+// change 本文件的变更（改名的源文件并入目标，不单独调用）。
+func (f *patchFile) change() *fileChange {
+	switch {
+	case !f.exists:
+		return newPatchChange(f.path, "", f.path, f.full, f.old, "", false, true)
+	case f.from != nil:
+		return newPatchChange(f.from.path, f.from.full, f.path, f.full, f.from.old, f.cur, false, false)
+	case !f.existed:
+		return newPatchChange(f.path, "", f.path, f.full, "", f.cur, true, false)
+	default:
+		return newPatchChange(f.path, "", f.path, f.full, f.old, f.cur, false, false)
+	}
+}
+
+// toolApplyPatch 应用 unified diff 或补丁信封（可含多个文件，支持新建、删除、改名）：
+// 先在内存里把每个 hunk 按上下文（宽松）匹配，任一 hunk 失败则不写任何文件并返回每个 hunk 的原因；
+// 都通过后逐个确认（需确认时）再依次写盘，中途出错时恢复已写的文件。
+func toolApplyPatch(sess *brain.Session, reads *fileReads, cp *checkpoint.Turn, confirm editConfirm, argsJSON string) (string, []*fileChange, error) {
+	var p struct {
+		Patch string `json:"patch"`
+	}
+	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
+		return "", nil, fmt.Errorf("apply_patch args: %w", err)
+	}
+	if strings.TrimSpace(p.Patch) == "" {
+		return "", nil, fmt.Errorf("apply_patch: patch required")
+	}
+	fps, err := textdiff.ParsePatch(p.Patch)
+	if err != nil {
+		return "", nil, fmt.Errorf("apply_patch: cannot parse patch: %w", err)
+	}
+	_, maxWrite := workspaceFileLimits()
+
+	var order []*patchFile
+	files := map[string]*patchFile{}
+	load := func(path string) (*patchFile, error) {
+		full, err := resolveWorkspaceFile(sess, path)
+		if err != nil {
+			return nil, err
+		}
+		if f := files[full]; f != nil {
+			return f, nil
+		}
+		f := &patchFile{path: path, full: full, mode: 0644}
+		if st, err := os.Stat(full); err == nil {
+			if st.IsDir() {
+				return nil, fmt.Errorf("%s is a directory", path)
+			}
+			data, err := os.ReadFile(full)
+			if err != nil {
+				return nil, err
+			}
+			f.existed, f.exists, f.mode = true, true, st.Mode().Perm()
+			f.old, f.cur = string(data), string(data)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		files[full] = f
+		order = append(order, f)
+		return f, nil
+	}
+
+	var report []string
+	failed := false
+	reject := func(format string, args ...any) {
+		report = append(report, fmt.Sprintf(format, args...))
+		failed = true
+	}
+	for _, fp := range fps {
+		name := fp.NewPath
+		if name == "" {
+			name = fp.OldPath
+		}
+		switch {
+		case fp.OldPath == "":
+			f, err := load(fp.NewPath)
+			if err != nil {
+				reject("%s: %v", name, err)
+				continue
+			}
+			if f.exists {
+				reject("%s: cannot create, file already exists (patch it as an update instead)", name)
+				continue
+			}
+			cur, res, ok := textdiff.ApplyHunks("", fp.Hunks)
+			if !ok {
+				reject("%s: %s", name, hunkReport(res))
+				continue
+			}
+			f.exists, f.cur = true, cur
+		case fp.NewPath == "":
+			f, err := load(fp.OldPath)
+			if err != nil {
+				reject("%s: %v", name, err)
+				continue
+			}
+			if !f.exists {
+				reject("%s: cannot delete, file does not exist", name)
+				continue
+			}
+			f.exists, f.cur = false, ""
+		default:
+			src, err := load(fp.OldPath)
+			if err != nil {
+				reject("%s: %v", fp.OldPath, err)
+				continue
+			}
+			if !src.exists {
+				reject("%s: file does not exist (use /dev/null as the old side, or *** Add File:, to create it)", fp.OldPath)
+				continue
+			}
+			cur, res, ok := textdiff.ApplyHunks(src.cur, fp.Hunks)
+			if !ok {
+				reject("%s: %s", fp.OldPath, hunkReport(res))
+				continue
+			}
+			if note := hunkFuzz(res); note != "" {
+				report = append(report, fmt.Sprintf("%s: %s", fp.OldPath, note))
+			}
+			dst := src
+			if fp.NewPath != fp.OldPath {
+				if dst, err = load(fp.NewPath); err != nil {
+					reject("%s: %v", fp.NewPath, err)
+					continue
+				}
+				if dst != src && dst.exists {
+					reject("%s: cannot rename %s onto an existing file", fp.NewPath, fp.OldPath)
+					continue
+				}
+				if dst != src {
+					dst.mode, dst.from, src.movedTo = src.mode, src, dst
+					src.exists, src.cur = false, ""
+				}
+			}
+			dst.exists, dst.cur = true, cur
+		}
+	}
+	for _, f := range order {
+		if f.exists && len(f.cur) > maxWrite {
+			reject("%s: result exceeds max_write_bytes (%d)", f.path, maxWrite)
+		}
+	}
+	if failed {
+		return "", nil, fmt.Errorf("apply_patch: nothing was written; fix the rejected parts and resend the whole patch\n%s", strings.Join(report, "\n"))
+	}
+
+	// 任一文件被拒则什么都不写
+	for _, f := range order {
+		if f.movedTo != nil || !f.changed() {
+			continue
+		}
+		ch, err := confirm.check(f.change())
+		if err != nil {
+			return "", nil, fmt.Errorf("apply_patch: nothing was written: %w", err)
+		}
+		if ch.New != f.cur {
+			f.cur, f.edited = ch.New, true
+		}
+	}
+
+	for _, f := range order {
+		if !f.changed() {
+			continue
+		}
+		if err := cp.Snapshot(f.full); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// 写盘：先写新内容再删除，出错时按相反顺序恢复
+	var done []*patchFile
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			f := done[i]
+			if f.existed {
+				_ = writeFileAtomic(f.full, f.old, f.mode)
+			} else {
+				_ = os.Remove(f.full)
+			}
+		}
+	}
+	for _, pass := range []bool{true, false} {
+		for _, f := range order {
+			if f.exists != pass || !f.changed() {
+				continue
+			}
+			var err error
+			if f.exists {
+				err = writeFileAtomic(f.full, f.cur, f.mode)
+			} else {
+				err = os.Remove(f.full)
+			}
+			if err != nil {
+				rollback()
+				return "", nil, fmt.Errorf("apply_patch: writing %s failed, earlier files restored: %w", f.path, err)
+			}
+			done = append(done, f)
+		}
+	}
+
+	var changes []*fileChange
+	var lines []string
+	for _, f := range order {
+		if f.movedTo != nil || !f.changed() {
+			continue
+		}
+		ch := f.change()
+		var line string
+		switch {
+		case ch.Deleted:
+			line = "D " + f.path
+		case f.from != nil:
+			line = fmt.Sprintf("R %s → %s", f.from.path, f.path)
+		case ch.Created:
+			line = "A " + f.path
+		default:
+			line = "M " + f.path
+		}
+		if f.exists {
+			reads.mark(f.full)
+		}
+		line += fmt.Sprintf(" (+%d -%d)", ch.added, ch.removed)
+		if f.edited {
+			line += " (edited by the user before approval)"
+		}
+		lines = append(lines, line)
+		changes = append(changes, ch)
+	}
+	if len(changes) == 0 {
+		return "apply_patch: patch applied but changed nothing", nil, nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "apply_patch: %d file(s) changed\n%s", len(changes), strings.Join(lines, "\n"))
+	if len(report) > 0 {
+		fmt.Fprintf(&b, "\nfuzzy matches:\n%s", strings.Join(report, "\n"))
+	}
+	for _, ch := range changes {
+		fmt.Fprintf(&b, "\n%s: %s", ch.Path, ch.summary())
+	}
+	return b.String(), changes, nil
+}
+
+// hunkReport 被拒文件的逐 hunk 说明。
+func hunkReport(res []textdiff.HunkResult) string {
+	var parts []string
+	for i, r := range res {
+		switch {
+		case r.Err != "":
+			parts = append(parts, fmt.Sprintf("\n  hunk %d REJECTED: %s", i+1, r.Err))
+		case r.Fuzz != "":
+			parts = append(parts, fmt.Sprintf("\n  hunk %d ok at line %d (%s)", i+1, r.Line, r.Fuzz))
+		default:
+			parts = append(parts, fmt.Sprintf("\n  hunk %d ok at line %d", i+1, r.Line))
+		}
+	}
+	return "hunks did not apply:" + strings.Join(parts, "")
+}
+
+// hunkFuzz 成功但经宽松匹配的 hunk，提示模型核对 diff。
+func hunkFuzz(res []textdiff.HunkResult) string {
+	var parts []string
+	for i, r := range res {
+		if r.Fuzz != "" {
+			parts = append(parts, fmt.Sprintf("hunk %d at line %d (%s)", i+1, r.Line, r.Fuzz))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cata/internal/audit"
+	"cata/internal/brain"
+	"cata/internal/llm"
+	"cata/internal/usage"
+)
+
+// auditErrorLen 审计记录里错误信息的长度上限。
+const auditErrorLen = 300
+
+// startAudit 为一次工具调用建立审计记录并放入 ctx；cwd 默认为主产出区，带 path 参数的工具记解析后的绝对路径。
+func startAudit(ctx context.Context, tc llm.ToolCall) (context.Context, *audit.Entry) {
+	sess := brain.SessionFrom(ctx)
+	argsJSON := llm.NormalizeToolArguments(tc.Function.Name, strings.TrimSpace(tc.Function.Arguments))
+	if argsJSON == "" {
+		argsJSON = "{}"
+	}
+	rec := &audit.Entry{
+		Session: usage.SessionFrom(ctx),
+		Tool:    tc.Function.Name,
+		Args:    audit.NormalizeArgs(argsJSON),
+		Cwd:     sess.OutputCwd(),
+	}
+	var p struct {
+		Path string `json:"path"`
+	}
+	if llm.ParseToolArguments(argsJSON, &p) == nil && strings.TrimSpace(p.Path) != "" {
+		rec.Path = p.Path
+		if full, err := resolveOutputPath(sess, p.Path); err == nil {
+			rec.Path = full
+		}
+	}
+	return audit.WithEntry(ctx, rec), rec
+}
+
+// finishAudit 补齐耗时、输出哈希与错误后追加到会话工作区的审计日志。
+func finishAudit(ctx context.Context, rec *audit.Entry, start time.Time, out string, err error) {
+	rec.DurationMS = time.Since(start).Milliseconds()
+	rec.OutputBytes = len(out)
+	rec.OutputHash = audit.Hash(out)
+	if err != nil {
+		msg := err.Error()
+		if len(msg) > auditErrorLen {
+			msg = msg[:auditErrorLen] + "…"
+		}
+		rec.Error = msg
+	}
+	if werr := audit.Record(brain.SessionFrom(ctx).Workspace, *rec); werr != nil {
+		log.Printf("audit log: %v", werr)
+	}
+}
+
+// auditResponse audit 命令：按时间、工具与路径查询当前产出区（或 All 时全部）脑子分区的审计日志。
+func auditResponse(req Request, sess *brain.Session) Response {
+	f := audit.Filter{Tool: strings.TrimSpace(req.Tool), Path: strings.TrimSpace(req.Path)}
+	if s := strings.TrimSpace(req.Since); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return Response{Success: false, Message: fmt.Sprintf("audit: invalid since %q (want RFC3339)", s)}
+		}
+		f.Since = t
+	}
+	wss, err := requestWorkspaces(req, sess)
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	rep, err := audit.Query(wss, f, req.Limit)
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	return Response{
+		Success: true,
+		Message: fmt.Sprintf("%d matching tool execution(s)", rep.Matched),
+		Data:    rep,
+	}
+}
+
+// auditApproval 记录需确认操作的结果。
+func auditApproval(ctx context.Context, approved bool) {
+	if rec := audit.From(ctx); rec != nil {
+		rec.Approval = "denied"
+		if approved {
+			rec.Approval = "approved"
+		}
+	}
+}
+
+// auditFileChange 记录文件工具的写入量；一次调用改多个文件（apply_patch）时累加。
+func auditFileChange(ctx context.Context, ch *fileChange) {
+	rec := audit.From(ctx)
+	if rec == nil || ch == nil {
+		return
+	}
+	if rec.Path == "" {
+		rec.Path = ch.Full
+	} else {
+		rec.Paths = append(rec.Paths, ch.Full)
+	}
+	n := len(ch.New) - len(ch.Old)
+	if n < 0 {
+		n = -n
+	}
+	rec.BytesChanged += n
+	rec.Added += ch.added
+	rec.Removed += ch.removed
+}
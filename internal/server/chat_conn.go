@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+// cancelledByUser 用户取消回合时写入 history 的合成结果（保持 tool_calls 与 tool 消息成对）。
+const cancelledByUser = "[cancelled by user]"
+
+// chatConn 一条 socket 连接：由单一读协程分流请求——chat_cancel 直接取消进行中的回合，
+// 回合内的 exec_confirm / user_choice 投递给等待中的工具，其余交给主循环顺序处理。
+// 写仍只发生在主循环（及其同步调用的 chat 回合）中；回合内并行的只读工具经同一把锁串行写入。
+type chatConn struct {
+	net.Conn
+	replies chan Request
+	// features hello 协商出的特性（仅主循环读写）
+	features []string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// has 客户端是否声明了特性 f。
+func (cc *chatConn) has(f string) bool {
+	for _, x := range cc.features {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+// connRequest 读协程交给主循环的一条请求（err 非 nil 表示该行不是合法 JSON）。
+type connRequest struct {
+	req Request
+	err error
+}
+
+func newChatConn(conn net.Conn) *chatConn {
+	return &chatConn{Conn: conn, replies: make(chan Request, 4)}
+}
+
+// readRequests 启动读协程并返回主循环的请求 channel；连接关闭时 channel 关闭，进行中的回合被取消。
+func (cc *chatConn) readRequests() <-chan connRequest {
+	// 带缓冲：回合进行中客户端再发普通请求时读协程不阻塞，仍能收到 chat_cancel
+	out := make(chan connRequest, 16)
+	go func() {
+		defer close(out)
+		defer close(cc.replies)
+		defer cc.cancelTurn()
+
+		scanner := bufio.NewScanner(cc.Conn)
+		lineBuf := make([]byte, 0, 64*1024)
+		scanner.Buffer(lineBuf, 4<<20)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var req Request
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				out <- connRequest{err: err}
+				continue
+			}
+			switch req.Command {
+			case protocol.CmdChatCancel:
+				// 无进行中的回合时忽略（不回包，避免与下一条请求的响应错位）
+				cc.cancelTurn()
+				continue
+			case protocol.CmdExecConfirm, protocol.CmdUserChoice:
+				if cc.inTurn() {
+					select {
+					case cc.replies <- req:
+					default:
+						log.Printf("drop %s reply: no pending tool", req.Command)
+					}
+					continue
+				}
+			}
+			out <- connRequest{req: req}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("Error reading from connection: %v", err)
+		}
+	}()
+	return out
+}
+
+// beginTurn 为一次 chat 回合派生可取消的 ctx；返回的 end 须在回合结束时调用。
+func (cc *chatConn) beginTurn(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	cc.mu.Lock()
+	cc.cancel = cancel
+	cc.mu.Unlock()
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-cc.replies:
+			drained = !ok
+		default:
+			drained = true
+		}
+	}
+	return ctx, func() {
+		cc.mu.Lock()
+		cc.cancel = nil
+		cc.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelTurn 取消进行中的回合；没有回合时返回 false。
+func (cc *chatConn) cancelTurn() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.cancel == nil {
+		return false
+	}
+	cc.cancel()
+	return true
+}
+
+func (cc *chatConn) inTurn() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.cancel != nil
+}
+
+// waitReply 阻塞等待客户端对 id 的 command 回复（exec_confirm / user_choice）；回合取消或超时返回错误。
+func (cc *chatConn) waitReply(ctx context.Context, command, id string) (Request, error) {
+	timer := time.NewTimer(execConfirmWaitTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return Request{}, ctx.Err()
+	case <-timer.C:
+		return Request{}, fmt.Errorf("%s timed out", command)
+	case req, ok := <-cc.replies:
+		if !ok {
+			return Request{}, fmt.Errorf("read %s: connection closed", command)
+		}
+		if req.Command != command {
+			return Request{}, fmt.Errorf("expected %s while pending, got %q", command, req.Command)
+		}
+		got := req.ConfirmID
+		if command == protocol.CmdUserChoice {
+			got = req.ChoiceID
+		}
+		if strings.TrimSpace(got) != id {
+			return Request{}, fmt.Errorf("%s id mismatch", command)
+		}
+		return req, nil
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cata/internal/brain"
+	"cata/internal/clock"
+	"cata/internal/llm"
+)
+
+// 持久化 chat 会话：每个会话一个 <workspace>/sessions/<id>.jsonl，每行一条 llm.Message（user / assistant / tool）。
+// 每轮结束（含取消与出错）整体重写，使 history 压缩后的裁剪也落盘；--resume 读回即为 server 端 history。
+
+const chatSessionExt = ".jsonl"
+
+// chatSessionInfo /sessions 与 session_list 返回的会话摘要。
+type chatSessionInfo struct {
+	ID       string `json:"id"`
+	Updated  string `json:"updated"`
+	Messages int    `json:"messages"`
+	// Title 首条用户消息（截断）
+	Title string `json:"title"`
+}
+
+// newChatSessionID 按时间排序的会话 id（20261017-153045-a1b2）。
+func newChatSessionID() string {
+	return clock.Format("20060102-150405") + "-" + newExecConfirmID()[:4]
+}
+
+func chatSessionPath(w *brain.Workspace, id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session id: %q", id)
+	}
+	return filepath.Join(w.ChatSessionsDir(), id+chatSessionExt), nil
+}
+
+// saveChatSession 原子重写会话文件。
+func saveChatSession(w *brain.Workspace, id string, history []llm.Message) error {
+	path, err := chatSessionPath(w, id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, m := range history {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadChatSession 读回会话 history；损坏的行跳过。
+func loadChatSession(w *brain.Workspace, id string) ([]llm.Message, error) {
+	path, err := chatSessionPath(w, id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session %s not found", id)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var out []llm.Message
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m llm.Message
+		if err := json.Unmarshal(line, &m); err != nil {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, sc.Err()
+}
+
+// listChatSessions 列出 workspace 的会话，最近更新在前。
+func listChatSessions(w *brain.Workspace) ([]chatSessionInfo, error) {
+	entries, err := os.ReadDir(w.ChatSessionsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	type item struct {
+		info chatSessionInfo
+		mod  time.Time
+	}
+	var items []item
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, chatSessionExt) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		id := strings.TrimSuffix(name, chatSessionExt)
+		msgs, err := loadChatSession(w, id)
+		if err != nil || len(msgs) == 0 {
+			continue
+		}
+		info := chatSessionInfo{
+			ID:       id,
+			Updated:  clock.FormatTime(fi.ModTime(), time.RFC3339),
+			Messages: len(msgs),
+		}
+		for _, m := range msgs {
+			if m.Role == "user" {
+				info.Title = truncateTitle(m.Content, 80)
+				break
+			}
+		}
+		items = append(items, item{info: info, mod: fi.ModTime()})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].mod.After(items[j].mod) })
+	out := make([]chatSessionInfo, len(items))
+	for i, it := range items {
+		out[i] = it.info
+	}
+	return out, nil
+}
+
+func truncateTitle(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// chatThread 本连接的对话：server 端 history 及其持久化会话 id（首次保存时分配）。
+type chatThread struct {
+	ID      string
+	History []llm.Message
+	// reads 本会话读过的文件（write_file 覆盖检查用，不落盘）
+	reads fileReads
+}
+
+// save 将 history 落盘到 w 的会话目录；无 workspace 或空 history 时跳过。
+func (t *chatThread) save(w *brain.Workspace) {
+	if w == nil || len(t.History) == 0 {
+		return
+	}
+	if t.ID == "" {
+		t.ID = newChatSessionID()
+	}
+	if err := saveChatSession(w, t.ID, t.History); err != nil {
+		log.Printf("save chat session %s: %v", t.ID, err)
+	}
+}
+
+// resumeChatThread 读回会话；id 为空时取 w 最近更新的会话。
+func resumeChatThread(w *brain.Workspace, id string) (*chatThread, error) {
+	if w == nil {
+		return nil, fmt.Errorf("no brain workspace for this directory")
+	}
+	if strings.TrimSpace(id) == "" {
+		list, err := listChatSessions(w)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("no saved sessions")
+		}
+		id = list[0].ID
+	}
+	msgs, err := loadChatSession(w, id)
+	if err != nil {
+		return nil, err
+	}
+	return &chatThread{ID: strings.TrimSpace(id), History: msgs}, nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/checkpoint"
+	"cata/internal/llm"
+	"cata/internal/protocol"
+)
+
+type checkpointKey struct{}
+
+// withCheckpoint 回合 ctx 携带本回合的检查点：文件工具写盘前经它保存原内容。
+func withCheckpoint(ctx context.Context, t *checkpoint.Turn) context.Context {
+	return context.WithValue(ctx, checkpointKey{}, t)
+}
+
+func checkpointFrom(ctx context.Context) *checkpoint.Turn {
+	t, _ := ctx.Value(checkpointKey{}).(*checkpoint.Turn)
+	return t
+}
+
+// checkpointListResponse checkpoint_list：本连接会话的检查点（从旧到新）。
+func checkpointListResponse(sess *brain.Session, thread *chatThread) Response {
+	list, err := checkpoint.List(sess.Workspace, thread.ID)
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	if list == nil {
+		list = []protocol.CheckpointInfo{}
+	}
+	return Response{Success: true, Message: fmt.Sprintf("%d checkpoint(s)", len(list)), Data: list}
+}
+
+// checkpointRestoreResponse checkpoint_restore：撤销 req.Checkpoint 及之后的回合（空为最近一个）。
+// 恢复的文件从已读集合中移除（内容已变，write_file 覆盖前须重读），并在 history 里留一条说明，免得模型以为修改还在。
+func checkpointRestoreResponse(req Request, sess *brain.Session, thread *chatThread) Response {
+	if thread.ID == "" {
+		return Response{Success: false, Message: "no checkpoints in this session"}
+	}
+	res, err := checkpoint.Restore(sess.Workspace, thread.ID, strings.TrimSpace(req.Checkpoint))
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	for _, p := range append(res.Restored, res.Removed...) {
+		thread.reads.forget(p)
+	}
+	var note strings.Builder
+	fmt.Fprintf(&note, "[cata] 用户撤销了检查点 %s 的文件修改（文件已恢复到这些回合之前的状态，之后的对话里的修改不再生效）。", strings.Join(res.Checkpoints, ", "))
+	if len(res.Restored) > 0 {
+		fmt.Fprintf(&note, "\n已恢复：%s", strings.Join(res.Restored, ", "))
+	}
+	if len(res.Removed) > 0 {
+		fmt.Fprintf(&note, "\n已删除（回合中新建）：%s", strings.Join(res.Removed, ", "))
+	}
+	if len(res.Failed) > 0 {
+		fmt.Fprintf(&note, "\n未能恢复：%s", strings.Join(res.Failed, "; "))
+	}
+	thread.History = append(thread.History, llm.Message{Role: "user", Content: note.String()})
+	thread.save(sess.Workspace)
+
+	msg := fmt.Sprintf("undid checkpoint(s) %s: %d file(s) restored, %d removed", strings.Join(res.Checkpoints, ", "), len(res.Restored), len(res.Removed))
+	if len(res.Failed) > 0 {
+		msg += fmt.Sprintf(", %d failed", len(res.Failed))
+	}
+	return Response{Success: true, Message: msg, Data: res}
+}
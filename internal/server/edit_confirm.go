@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// editConfirm 文件工具写盘前的确认钩子：返回要写入的修改（用户编辑后批准时内容不同），拒绝时返回 *editRejected。
+// nil 表示无需确认。
+type editConfirm func(ch *fileChange) (*fileChange, error)
+
+func (c editConfirm) check(ch *fileChange) (*fileChange, error) {
+	if c == nil {
+		return ch, nil
+	}
+	return c(ch)
+}
+
+// editRejected 用户拒绝了修改；作为工具错误交给模型。
+type editRejected struct {
+	path   string
+	reason string
+}
+
+func (e *editRejected) Error() string {
+	reason := strings.TrimSpace(e.reason)
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return fmt.Sprintf("the user rejected the edit to %s (%s); the file was not changed. Adjust your approach instead of retrying the same edit", e.path, reason)
+}
+
+// editConfirmer workspace_files 配置了 require_confirm / confirm_paths 时返回本次工具调用的确认钩子：
+// 命中的修改推送 file_confirm_required 并等待客户端 exec_confirm。
+func (ss *SocketServer) editConfirmer(ctx context.Context, conn *chatConn, sess *brain.Session, tool string) editConfirm {
+	cfg := config.Current()
+	if cfg == nil {
+		return nil
+	}
+	if wf := cfg.WorkspaceFiles; !wf.RequireConfirm && len(wf.ConfirmPaths) == 0 {
+		return nil
+	}
+	return func(ch *fileChange) (*fileChange, error) {
+		if !config.FileEditNeedsConfirm(outputRel(sess, ch.Full)) &&
+			(ch.From == "" || !config.FileEditNeedsConfirm(outputRel(sess, ch.From))) {
+			return ch, nil
+		}
+		if !conn.has(protocol.FeatureEditConfirm) {
+			return nil, &editRejected{path: ch.Path, reason: "this client cannot show edit confirmations; ask the user to make the change or use an up-to-date client"}
+		}
+		ev := protocol.FileConfirmRequired{
+			ConfirmID: newExecConfirmID(),
+			Tool:      tool,
+			Path:      ch.Full,
+			From:      ch.From,
+			Diff:      ch.diff,
+			Added:     ch.added,
+			Removed:   ch.removed,
+			Created:   ch.Created,
+			Deleted:   ch.Deleted,
+			Options: []protocol.ChoiceOption{
+				{ID: "approve", Label: "Approve"},
+				{ID: "edit", Label: "Edit, then approve"},
+				{ID: "reject", Label: "Reject"},
+			},
+		}
+		if ch.Deleted {
+			ev.Options = []protocol.ChoiceOption{ev.Options[0], ev.Options[2]}
+		} else {
+			ev.Content = ch.New
+		}
+		_ = ss.emitStreamLine(conn, ev)
+		req, err := conn.waitReply(ctx, protocol.CmdExecConfirm, ev.ConfirmID)
+		if err != nil {
+			return nil, err
+		}
+		auditApproval(ctx, req.Approved)
+		if !req.Approved {
+			return nil, &editRejected{path: ch.Path, reason: req.Reason}
+		}
+		if req.EditedContent == nil || ch.Deleted || *req.EditedContent == ch.New {
+			return ch, nil
+		}
+		if _, maxWrite := workspaceFileLimits(); len(*req.EditedContent) > maxWrite {
+			return nil, fmt.Errorf("edited content for %s exceeds max_write_bytes (%d)", ch.Path, maxWrite)
+		}
+		return ch.withContent(*req.EditedContent), nil
+	}
+}
+
+// outputRel full 相对其所在产出区的 / 分隔路径（不在任何产出区内时为 full 本身）。
+func outputRel(sess *brain.Session, full string) string {
+	for _, root := range outputRoots(sess) {
+		if rel, ok := relWithin(root, full); ok {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(full)
+}
+
+// editedNote 用户编辑后才批准时附在工具结果里，提醒模型文件内容与它的提议不同。
+func editedNote(ch *fileChange, proposed string) string {
+	if ch.New == proposed {
+		return ""
+	}
+	return " (edited by the user before approval; the diff below is what was written)"
+}
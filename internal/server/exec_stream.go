@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+const (
+	// toolOutputInterval tool_output 的最短推送间隔
+	toolOutputInterval = 250 * time.Millisecond
+	// toolOutputHeartbeat 没有新输出时推送空 tool_output（更新已用时间）的间隔
+	toolOutputHeartbeat = time.Second
+	// toolOutputMaxLines 每次推送最多的行数，多出的只保留最后这些行（其余计入 skipped）
+	toolOutputMaxLines = 40
+	// toolOutputMaxLine 单行最多字节数（过长的行截断；不含换行的超长输出按此切行）
+	toolOutputMaxLine = 1024
+)
+
+// outputLine 待推送的一行。
+type outputLine struct {
+	stream string
+	text   string
+}
+
+// outputStreamer 把 run_command 的 stdout / stderr 按行限速推送为 tool_output；只影响客户端展示，
+// 交给模型的结果仍由完整缓冲生成。客户端不支持 tool_output 时 newOutputStreamer 返回 nil（方法对 nil 安全）。
+type outputStreamer struct {
+	ss     *SocketServer
+	conn   *chatConn
+	toolID string
+	start  time.Time
+
+	mu      sync.Mutex
+	pending []outputLine
+	skipped int
+	partial map[string][]byte
+	last    time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newOutputStreamer(ss *SocketServer, conn *chatConn, toolID string) *outputStreamer {
+	if conn == nil || !conn.has(protocol.FeatureToolOutput) {
+		return nil
+	}
+	st := &outputStreamer{
+		ss: ss, conn: conn, toolID: toolID, start: time.Now(),
+		partial: map[string][]byte{},
+		last:    time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go st.loop()
+	return st
+}
+
+// writer stream（stdout / stderr）的 io.Writer。
+func (st *outputStreamer) writer(stream string) *streamWriter {
+	return &streamWriter{st: st, stream: stream}
+}
+
+type streamWriter struct {
+	st     *outputStreamer
+	stream string
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.st.add(w.stream, p)
+	return len(p), nil
+}
+
+func (st *outputStreamer) add(stream string, p []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	buf := append(st.partial[stream], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 && len(buf) < toolOutputMaxLine {
+			break
+		}
+		var line []byte
+		if i < 0 {
+			line, buf = buf[:toolOutputMaxLine], buf[toolOutputMaxLine:]
+		} else {
+			line, buf = buf[:i], buf[i+1:]
+		}
+		st.push(stream, line)
+	}
+	st.partial[stream] = buf
+}
+
+// push 持 mu 调用；积压超过一次推送的上限时丢弃最旧的行。
+func (st *outputStreamer) push(stream string, line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > toolOutputMaxLine {
+		line = append(line[:toolOutputMaxLine:toolOutputMaxLine], "…"...)
+	}
+	st.pending = append(st.pending, outputLine{stream: stream, text: string(line)})
+	if n := len(st.pending) - toolOutputMaxLines; n > 0 {
+		st.pending = st.pending[n:]
+		st.skipped += n
+	}
+}
+
+func (st *outputStreamer) loop() {
+	defer close(st.done)
+	tick := time.NewTicker(toolOutputInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-st.stop:
+			return
+		case <-tick.C:
+			st.flush(false)
+		}
+	}
+}
+
+// flush 推送积压的行（相邻同一 stream 的合为一条）；final 时连同未换行的尾部一起推。
+func (st *outputStreamer) flush(final bool) {
+	st.mu.Lock()
+	if final {
+		for _, stream := range []string{"stdout", "stderr"} {
+			if buf := st.partial[stream]; len(buf) > 0 {
+				st.push(stream, buf)
+				st.partial[stream] = nil
+			}
+		}
+	}
+	lines, skipped := st.pending, st.skipped
+	st.pending, st.skipped = nil, 0
+	now := time.Now()
+	if len(lines) == 0 && skipped == 0 && (final || now.Sub(st.last) < toolOutputHeartbeat) {
+		st.mu.Unlock()
+		return
+	}
+	st.last = now
+	st.mu.Unlock()
+
+	elapsed := now.Sub(st.start).Milliseconds()
+	if len(lines) == 0 {
+		_ = st.ss.emitStreamLine(st.conn, protocol.ToolOutput{ToolID: st.toolID, Skipped: skipped, ElapsedMS: elapsed})
+		return
+	}
+	for len(lines) > 0 {
+		n := 1
+		for n < len(lines) && lines[n].stream == lines[0].stream {
+			n++
+		}
+		ev := protocol.ToolOutput{ToolID: st.toolID, Stream: lines[0].stream, Skipped: skipped, ElapsedMS: elapsed}
+		for _, l := range lines[:n] {
+			ev.Lines = append(ev.Lines, l.text)
+		}
+		_ = st.ss.emitStreamLine(st.conn, ev)
+		lines, skipped = lines[n:], 0
+	}
+}
+
+// finish 命令结束后调用：停止定时推送并推出剩余输出。
+func (st *outputStreamer) finish() {
+	if st == nil {
+		return
+	}
+	close(st.stop)
+	<-st.done
+	st.flush(true)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+
+	"cata/internal/protocol"
+	"cata/internal/textdiff"
+)
+
+// compactDiffLines 工具结果里附带的 diff 行数上限（完整 diff 走 diff 事件给客户端）。
+const compactDiffLines = 60
+
+// fileChange 文件工具的一次写入：Path 为模型传入的路径，Full 为解析后的绝对路径。
+type fileChange struct {
+	Path    string
+	Full    string
+	Old     string
+	New     string
+	Created bool
+	// Deleted 文件被删除（New 为空）；From 非空时为改名前的绝对路径
+	Deleted bool
+	From    string
+
+	diff           string
+	added, removed int
+	// a, b diff 头里的新旧文件名
+	a, b string
+}
+
+func newFileChange(path, full, old, cur string, created bool) *fileChange {
+	return newPatchChange(path, "", path, full, old, cur, created, false)
+}
+
+// newPatchChange 同 newFileChange，另支持改名与删除：from 为改名前路径（模型传入的形式，非改名时同 path），
+// fromFull 为其解析后的绝对路径（非改名时为空）；deleted 时 cur 为空。
+func newPatchChange(from, fromFull, path, full, old, cur string, created, deleted bool) *fileChange {
+	a, b := "a/"+from, "b/"+path
+	if created {
+		a = "/dev/null"
+	}
+	if deleted {
+		b = "/dev/null"
+	}
+	ch := &fileChange{Path: path, Full: full, Old: old, New: cur, Created: created, Deleted: deleted, From: fromFull, a: a, b: b}
+	ch.diff = textdiff.Unified(a, b, old, cur)
+	ch.added, ch.removed = textdiff.Count(ch.diff)
+	return ch
+}
+
+// withContent 同一修改改为写入 cur（用户编辑后批准时）。
+func (ch *fileChange) withContent(cur string) *fileChange {
+	c := *ch
+	c.New = cur
+	c.diff = textdiff.Unified(c.a, c.b, c.Old, cur)
+	c.added, c.removed = textdiff.Count(c.diff)
+	return &c
+}
+
+// summary 追加在工具结果后的紧凑 diff，供模型核对自己的修改。
+func (ch *fileChange) summary() string {
+	if ch.diff == "" {
+		return "(no changes)"
+	}
+	return fmt.Sprintf("diff (+%d -%d):\n%s", ch.added, ch.removed, textdiff.Compact(ch.diff, compactDiffLines))
+}
+
+// emitFileChange 推送 diff + file_written 事件。
+func (ss *SocketServer) emitFileChange(conn *chatConn, toolID string, ch *fileChange) {
+	if ch.diff != "" {
+		_ = ss.emitStreamLine(conn, protocol.Diff{
+			ToolID:  toolID,
+			Path:    ch.Path,
+			Content: ch.diff,
+			Added:   ch.added,
+			Removed: ch.removed,
+			Display: protocol.DisplayNormal,
+		})
+	}
+	_ = ss.emitStreamLine(conn, protocol.FileWritten{
+		ToolID:  toolID,
+		Path:    ch.Full,
+		Bytes:   len(ch.New),
+		Added:   ch.added,
+		Removed: ch.removed,
+		Created: ch.Created,
+		Deleted: ch.Deleted,
+		From:    ch.From,
+		Display: protocol.DisplayNormal,
+	})
+}
+
+// toolDisplay tool_start / tool_result 的显示提示：读文件静默；写文件的内容已由 diff 事件展示；
+// run_command 与任何出错都完整展示。
+func toolDisplay(name string, result bool, failed bool) string {
+	if failed {
+		return protocol.DisplayVerbose
+	}
+	switch name {
+	case "read_file", "list_dir", "glob", "search_files":
+		return protocol.DisplaySilent
+	case "search_replace", "append_file", "write_file", "apply_patch":
+		if result {
+			return protocol.DisplaySilent
+		}
+	case "run_command":
+		if result {
+			return protocol.DisplayVerbose
+		}
+	}
+	return protocol.DisplayNormal
+}
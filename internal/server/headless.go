@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"cata/internal/protocol"
+)
+
+// headlessPolicy 无人应答时如何处理需要客户端回复的事件（规则同 cata ask 的 --approve/--deny/--choice/--extend）。
+type headlessPolicy struct {
+	Approve bool
+	Choice  string
+	Extend  bool
+	// Wait 不自动应答，等 attach 上来的客户端回复（超时按 execConfirmWaitTimeout）
+	Wait bool
+}
+
+// headlessConn 没有 socket 客户端的回合（定时任务、后台 task）所用的“连接”：server 写出的事件逐行记入 w，
+// 经 tee 转给观察者；需要应答的事件按 policy 直接投递到 chatConn.replies。
+type headlessConn struct {
+	mu     sync.Mutex
+	w      io.Writer
+	cc     *chatConn
+	name   string
+	policy headlessPolicy
+	// tee 每个事件行（持 mu 调用，不可阻塞）
+	tee func(line []byte, ev protocol.Event)
+
+	done    *protocol.Done
+	lastErr string
+}
+
+// newHeadlessChatConn 包装 hc 为回合可用的 chatConn（声明全部协议特性）。
+func newHeadlessChatConn(hc *headlessConn) *chatConn {
+	cc := &chatConn{Conn: hc, replies: make(chan Request, 4), features: protocol.Features}
+	hc.cc = cc
+	return cc
+}
+
+func (h *headlessConn) Write(b []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.w.Write(b); err != nil {
+		log.Printf("%s: transcript: %v", h.name, err)
+	}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		ev, err := protocol.Decode(line)
+		if err != nil {
+			continue
+		}
+		if h.tee != nil {
+			h.tee(append([]byte(nil), append(line, '\n')...), ev)
+		}
+		h.observe(ev)
+	}
+	return len(b), nil
+}
+
+func (h *headlessConn) observe(ev protocol.Event) {
+	var reply Request
+	switch ev := ev.(type) {
+	case *protocol.ExecConfirmRequired:
+		reply = Request{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: h.policy.Approve}
+	case *protocol.FileConfirmRequired:
+		reply = Request{Command: protocol.CmdExecConfirm, ConfirmID: ev.ConfirmID, Approved: h.policy.Approve}
+		if !h.policy.Approve {
+			reply.Reason = "unattended run without approval"
+		}
+	case *protocol.UserChoice:
+		reply = Request{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: protocol.AskChoice(h.policy.Choice, ev.Options)}
+	case *protocol.LimitReached:
+		if len(ev.Options) == 0 {
+			return
+		}
+		choice := "stop"
+		if h.policy.Extend {
+			choice = "extend"
+		}
+		reply = Request{Command: protocol.CmdUserChoice, ChoiceID: ev.ID, Selected: []string{choice}}
+	case *protocol.Error:
+		h.lastErr = ev.Message
+		return
+	case *protocol.Done:
+		h.done = ev
+		return
+	default:
+		return
+	}
+	if h.policy.Wait {
+		return
+	}
+	h.reply(reply)
+}
+
+// reply 投递一条应答给等待中的工具。
+func (h *headlessConn) reply(r Request) {
+	select {
+	case h.cc.replies <- r:
+	default:
+		log.Printf("%s: drop %s reply", h.name, r.Command)
+	}
+}
+
+func (h *headlessConn) Read([]byte) (int, error)         { return 0, io.EOF }
+func (h *headlessConn) Close() error                     { return nil }
+func (h *headlessConn) LocalAddr() net.Addr              { return headlessAddr{} }
+func (h *headlessConn) RemoteAddr() net.Addr             { return headlessAddr{} }
+func (h *headlessConn) SetDeadline(time.Time) error      { return nil }
+func (h *headlessConn) SetReadDeadline(time.Time) error  { return nil }
+func (h *headlessConn) SetWriteDeadline(time.Time) error { return nil }
+
+type headlessAddr struct{}
+
+func (headlessAddr) Network() string { return "headless" }
+func (headlessAddr) String() string  { return "headless" }
@@ -1,16 +1,18 @@
 package server
 
 import (
+	"context"
+
 	"cata/internal/llm"
 )
 
 // trimHistoryToTokenBudget 从最早的用户/助手/tool 消息裁掉，使估算 token ≤ budget（保留前置 system 若有）。
-func trimHistoryToTokenBudget(client *llm.Client, msgs []llm.Message, tools []llm.Tool, budget int) []llm.Message {
+func trimHistoryToTokenBudget(ctx context.Context, client *llm.Client, msgs []llm.Message, tools []llm.Tool, budget int) []llm.Message {
 	if budget <= 0 || len(msgs) == 0 {
 		return msgs
 	}
 	out := append([]llm.Message(nil), msgs...)
-	for len(out) > 1 && client.EstimatedChatInputTokens(out, tools) > budget {
+	for len(out) > 1 && client.EstimatedChatInputTokens(ctx, out, tools) > budget {
 		drop := firstDroppableIndex(out)
 		if drop < 0 {
 			break
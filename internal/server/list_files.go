@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/ignore"
+	"cata/internal/llm"
+)
+
+const (
+	// listDefaultLimit / listMaxLimit list_dir、glob 每页条数
+	listDefaultLimit = 200
+	listMaxLimit     = 1000
+	// listMaxScan 单次调用最多遍历的条目数，防止误列巨大目录树
+	listMaxScan = 50000
+)
+
+// listEntry list_dir / glob 的一行结果。
+type listEntry struct {
+	rel  string
+	kind byte
+	size int64
+	mod  string
+}
+
+func newListEntry(rel string, d fs.DirEntry) listEntry {
+	e := listEntry{rel: rel, kind: 'f'}
+	switch {
+	case d.Type()&fs.ModeSymlink != 0:
+		e.kind = 'l'
+	case d.IsDir():
+		e.kind = 'd'
+		e.rel += "/"
+	}
+	if info, err := d.Info(); err == nil {
+		if e.kind == 'f' {
+			e.size = info.Size()
+		}
+		e.mod = info.ModTime().Format("2006-01-02 15:04")
+	}
+	return e
+}
+
+// resolveListDir 解析产出区内的目录（空或 . 为主产出区，规则同 run_command 的 cwd）。
+func resolveListDir(sess *brain.Session, tool, rel string) (string, error) {
+	full, err := resolveOutputDir(sess, rel)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", tool, err)
+	}
+	return full, nil
+}
+
+// formatListPage 输出 offset 起的一页：首行为总数与范围，末行提示下一页的 offset。
+func formatListPage(title string, entries []listEntry, offset, limit int, capped bool) string {
+	if limit <= 0 {
+		limit = listDefaultLimit
+	}
+	if limit > listMaxLimit {
+		limit = listMaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total := len(entries)
+	var b strings.Builder
+	more := ""
+	if capped {
+		more = fmt.Sprintf(" (scan stopped after %d entries; narrow the path or pattern)", listMaxScan)
+	}
+	if total == 0 {
+		fmt.Fprintf(&b, "%s: no entries%s", title, more)
+		return b.String()
+	}
+	if offset >= total {
+		fmt.Fprintf(&b, "%s: offset %d beyond end (%d entries)%s", title, offset, total, more)
+		return b.String()
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	fmt.Fprintf(&b, "%s: %d entries, showing %d-%d%s\n", title, total, offset+1, end, more)
+	for _, e := range entries[offset:end] {
+		size := "-"
+		if e.kind == 'f' {
+			size = fmt.Sprint(e.size)
+		}
+		fmt.Fprintf(&b, "%c %10s  %s  %s\n", e.kind, size, e.mod, e.rel)
+	}
+	if end < total {
+		fmt.Fprintf(&b, "…(%d more; call again with offset %d)\n", total-end, end)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// toolListDir 列出目录（默认只列直接子项），遵循 .gitignore、跳过 .git 与 node_modules（all:true 时不过滤）。
+func toolListDir(sess *brain.Session, argsJSON string) (string, error) {
+	var p struct {
+		Path   string `json:"path"`
+		Depth  int    `json:"depth"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+		All    bool   `json:"all"`
+	}
+	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
+		return "", fmt.Errorf("list_dir args: %w", err)
+	}
+	full, err := resolveListDir(sess, "list_dir", p.Path)
+	if err != nil {
+		return "", err
+	}
+	if p.Depth <= 0 {
+		p.Depth = 1
+	}
+	var entries []listEntry
+	capped := false
+	err = ignore.Walk(full, ignore.Options{All: p.All, MaxDepth: p.Depth}, func(rel string, d fs.DirEntry) error {
+		if len(entries) >= listMaxScan {
+			capped = true
+			return filepath.SkipAll
+		}
+		entries = append(entries, newListEntry(rel, d))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return formatListPage("list_dir "+full, entries, p.Offset, p.Limit, capped), nil
+}
+
+// toolGlob 在 path（默认主产出区）下按 / 分隔的 glob 匹配相对路径；** 跨目录，过滤规则同 list_dir。
+func toolGlob(sess *brain.Session, argsJSON string) (string, error) {
+	var p struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+		Offset  int    `json:"offset"`
+		Limit   int    `json:"limit"`
+		All     bool   `json:"all"`
+	}
+	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
+		return "", fmt.Errorf("glob args: %w", err)
+	}
+	pattern := strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(p.Pattern)), "./")
+	if pattern == "" {
+		return "", fmt.Errorf("glob: pattern required")
+	}
+	if strings.HasPrefix(pattern, "/") || strings.HasPrefix(pattern, "../") {
+		return "", fmt.Errorf("glob: pattern must be relative to path; pass the directory as path")
+	}
+	full, err := resolveListDir(sess, "glob", p.Path)
+	if err != nil {
+		return "", err
+	}
+	// 不含 ** 时只需遍历到模式的层数
+	opt := ignore.Options{All: p.All}
+	if !strings.Contains(pattern, "**") {
+		opt.MaxDepth = strings.Count(pattern, "/") + 1
+	}
+	var entries []listEntry
+	scanned, capped := 0, false
+	err = ignore.Walk(full, opt, func(rel string, d fs.DirEntry) error {
+		if scanned++; scanned > listMaxScan {
+			capped = true
+			return filepath.SkipAll
+		}
+		if ignore.Match(pattern, rel) {
+			entries = append(entries, newListEntry(rel, d))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return formatListPage(fmt.Sprintf("glob %s in %s", pattern, full), entries, p.Offset, p.Limit, capped), nil
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cata/internal/config"
+	"cata/internal/llm"
+	"cata/internal/protocol"
+)
+
+// loopDetector 一个回合内连续相同（参数规范化后一致）的工具调用、连续相同的工具错误，
+// 以及对同一目标（path / argv[0] 等）连续出现同类错误的近似重复调用计数。
+// 到 warnAt 次起在工具结果后追加纠正提示；到 pauseAt 次时回合在本批工具后暂停，经 user_choice 询问是否继续。
+type loopDetector struct {
+	warnAt, pauseAt int
+
+	lastCall  string
+	sameCalls int
+	lastErr   string
+	sameErrs  int
+	// lastNear 工具 + 目标 + 错误类别；参数略有不同（如换了 old_string）但反复同样失败时累计
+	lastNear string
+	nearErrs int
+	// pause 待询问用户的原因（空为无需暂停）
+	pause string
+}
+
+func newLoopDetector() *loopDetector {
+	d := &loopDetector{warnAt: 3, pauseAt: 5}
+	if cfg := config.Current(); cfg != nil {
+		d.warnAt, d.pauseAt = cfg.Turn.LoopWarn, cfg.Turn.LoopPause
+	}
+	return d
+}
+
+// canonicalArgs 参数规范化：只规范 JSON 结构（键排序、去掉结构间的空白），字符串值保持原样。
+func canonicalArgs(args string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(args), &v); err != nil {
+		return strings.TrimSpace(args)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return strings.TrimSpace(args)
+	}
+	return string(b)
+}
+
+// callTarget 调用作用的对象：path、argv[0]、skill 或 url；没有时为空（不做近似重复判断）。
+func callTarget(args string) string {
+	var p struct {
+		Path  string   `json:"path"`
+		Argv  []string `json:"argv"`
+		Skill string   `json:"skill"`
+		URL   string   `json:"url"`
+	}
+	if json.Unmarshal([]byte(args), &p) != nil {
+		return ""
+	}
+	switch {
+	case p.Path != "":
+		return p.Path
+	case len(p.Argv) > 0:
+		return p.Argv[0]
+	case p.Skill != "":
+		return p.Skill
+	}
+	return p.URL
+}
+
+// errorClass 错误类别：优先取 [error] 行，否则取首个非空行；数字与引号内的内容抹掉，
+// 使只差行号、片段内容的同类错误归为一类。
+func errorClass(out string) string {
+	line := ""
+	for _, l := range strings.Split(out, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[error]") {
+			line = l
+			break
+		}
+		if line == "" {
+			line = l
+		}
+	}
+	var b strings.Builder
+	var quote rune
+	digits := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				b.WriteRune(r)
+			}
+			continue
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+			b.WriteString(string(r) + "…")
+			continue
+		case r >= '0' && r <= '9':
+			if !digits {
+				b.WriteByte('#')
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// observe 记录一次工具调用；返回应追加到工具结果后的提示（无则为空）。
+func (d *loopDetector) observe(name, args, out string, failed bool) string {
+	call := name + " " + canonicalArgs(args)
+	if call == d.lastCall {
+		d.sameCalls++
+	} else {
+		d.lastCall, d.sameCalls = call, 1
+	}
+	target := callTarget(args)
+	if failed {
+		e := name + ": " + strings.Join(strings.Fields(out), " ")
+		if e == d.lastErr {
+			d.sameErrs++
+		} else {
+			d.lastErr, d.sameErrs = e, 1
+		}
+		near := ""
+		if target != "" {
+			near = name + " " + target + ": " + errorClass(out)
+		}
+		if near != "" && near == d.lastNear {
+			d.nearErrs++
+		} else {
+			d.lastNear, d.nearErrs = near, 1
+		}
+	} else {
+		d.lastErr, d.sameErrs = "", 0
+		d.lastNear, d.nearErrs = "", 0
+	}
+
+	var desc, note string
+	switch {
+	case d.sameErrs >= d.sameCalls && d.sameErrs > 1 && d.sameErrs >= d.nearErrs:
+		desc = fmt.Sprintf("%s failed %d times in a row with the same error", name, d.sameErrs)
+		note = "Inspect the current state (e.g. re-read the file) before retrying, change approach, or tell the user what is blocking you."
+	case d.nearErrs >= d.sameCalls && d.nearErrs > 1:
+		desc = fmt.Sprintf("%s on %s failed %d times in a row with the same kind of error", name, target, d.nearErrs)
+		note = "Small variations of the same call keep failing; inspect the current state (e.g. re-read the file) before retrying, change approach, or tell the user what is blocking you."
+	case d.sameCalls > 1:
+		desc = fmt.Sprintf("%s called %d times in a row with the same arguments", name, d.sameCalls)
+		note = "Repeating it will not change the result; try a different approach or tell the user what is blocking you."
+	default:
+		return ""
+	}
+	n := d.sameCalls
+	if d.sameErrs > n {
+		n = d.sameErrs
+	}
+	if d.nearErrs > n {
+		n = d.nearErrs
+	}
+	if d.pauseAt > 0 && n >= d.pauseAt {
+		d.pause = desc
+	}
+	if d.warnAt > 0 && n >= d.warnAt {
+		return "[loop detected] " + desc + ". " + note
+	}
+	return ""
+}
+
+// annotate observe 一次调用结果，提示追加到 r.out 后（tool_result 与 history 用同一份输出）。
+func (d *loopDetector) annotate(tc llm.ToolCall, r *toolRun) {
+	if note := d.observe(tc.Function.Name, tc.Function.Arguments, r.out, r.err != nil); note != "" {
+		r.out += "\n\n" + note
+	}
+}
+
+// takePause 取出待询问的暂停原因并清零计数（用户选择继续后重新累计）。
+func (d *loopDetector) takePause() string {
+	p := d.pause
+	if p != "" {
+		d.pause = ""
+		d.lastCall, d.sameCalls = "", 0
+		d.lastErr, d.sameErrs = "", 0
+		d.lastNear, d.nearErrs = "", 0
+	}
+	return p
+}
+
+// confirmLoopContinue 经 user_choice 询问是否在检测到重复调用后继续；未选或选 stop 返回 false。
+func (ss *SocketServer) confirmLoopContinue(ctx context.Context, conn *chatConn, desc string) (bool, error) {
+	id := newExecConfirmID()
+	_ = ss.emitStreamLine(conn, protocol.UserChoice{
+		ID:     id,
+		Prompt: "The model looks stuck: " + desc + ". Continue?",
+		Detail: "Stop asks the model to summarize without tools and ends the turn.",
+		Options: []protocol.ChoiceOption{
+			{ID: "continue", Label: "Continue", Desc: "let the model keep working"},
+			{ID: "stop", Label: "Stop", Desc: "summarize and end the turn"},
+		},
+	})
+	selected, err := ss.waitUserChoice(ctx, conn, id)
+	if err != nil {
+		return false, err
+	}
+	return len(selected) > 0 && selected[0] == "continue", nil
+}
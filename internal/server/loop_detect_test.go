@@ -0,0 +1,93 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalArgs(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{`{"path":"a.go","limit":10}`, "{\n  \"limit\": 10,\n  \"path\": \"a.go\"\n}", true},
+		{`{"path":"a.go","old":"x  y"}`, `{"path":"a.go","old":"x y"}`, false},
+		{`{"old":"if x {\n\treturn\n}"}`, `{"old":"if x {\n    return\n}"}`, false},
+		{`not json`, ` not json `, true},
+	}
+	for _, c := range cases {
+		if got := canonicalArgs(c.a) == canonicalArgs(c.b); got != c.same {
+			t.Errorf("%s vs %s: same = %v, want %v", c.a, c.b, got, c.same)
+		}
+	}
+}
+
+func TestLoopDetectorObserve(t *testing.T) {
+	type call struct {
+		name, args, out string
+		failed          bool
+	}
+	readA := call{name: "read_file", args: `{"path":"a.go"}`, out: "package a"}
+	readB := call{name: "read_file", args: `{"path":"b.go"}`, out: "package b"}
+	failA := call{name: "search_replace", args: `{"path":"a.go","old_string":"x"}`, out: "[error] old_string not found", failed: true}
+	cases := []struct {
+		name  string
+		calls []call
+		// warn 最后一次调用是否带 [loop detected]；note 提示需包含的子串
+		warn  bool
+		note  string
+		pause bool
+	}{
+		{name: "below warn", calls: []call{readA, readA}},
+		{name: "same call warns", calls: []call{readA, readA, readA}, warn: true, note: "same arguments"},
+		{name: "same call pauses", calls: []call{readA, readA, readA, readA}, warn: true, pause: true},
+		{name: "different call resets", calls: []call{readA, readA, readB, readA}},
+		{name: "same error warns", calls: []call{failA, failA, failA}, warn: true, note: "same error"},
+		{name: "success resets errors", calls: []call{failA, failA, readB, failA, failA}},
+		{name: "near duplicate failures", calls: []call{
+			{name: "search_replace", args: `{"path":"a.go","old_string":"x"}`, out: `[error] old_string "x" not found (line 3)`, failed: true},
+			{name: "search_replace", args: `{"path":"a.go","old_string":"y"}`, out: `[error] old_string "y" not found (line 7)`, failed: true},
+			{name: "search_replace", args: `{"path":"a.go","old_string":"z"}`, out: `[error] old_string "z" not found (line 12)`, failed: true},
+		}, warn: true, note: "same kind of error"},
+		{name: "near duplicate needs the same target", calls: []call{
+			{name: "search_replace", args: `{"path":"a.go","old_string":"x"}`, out: `[error] old_string "x" not found`, failed: true},
+			{name: "search_replace", args: `{"path":"b.go","old_string":"y"}`, out: `[error] old_string "y" not found`, failed: true},
+			{name: "search_replace", args: `{"path":"a.go","old_string":"z"}`, out: `[error] old_string "z" not found`, failed: true},
+		}},
+		{name: "near duplicate by argv[0]", calls: []call{
+			{name: "run_command", args: `{"argv":["go","test","./a"]}`, out: "[error] exit status 1", failed: true},
+			{name: "run_command", args: `{"argv":["go","test","./b"]}`, out: "[error] exit status 2", failed: true},
+			{name: "run_command", args: `{"argv":["go","vet"]}`, out: "[error] exit status 1", failed: true},
+		}, warn: true, note: "run_command on go"},
+	}
+	for _, c := range cases {
+		d := &loopDetector{warnAt: 3, pauseAt: 4}
+		note := ""
+		for _, x := range c.calls {
+			note = d.observe(x.name, x.args, x.out, x.failed)
+		}
+		if got := strings.HasPrefix(note, "[loop detected]"); got != c.warn {
+			t.Errorf("%s: note = %q, want warn %v", c.name, note, c.warn)
+		}
+		if !strings.Contains(note, c.note) {
+			t.Errorf("%s: note = %q, want it to mention %q", c.name, note, c.note)
+		}
+		if got := d.takePause() != ""; got != c.pause {
+			t.Errorf("%s: pause = %v, want %v", c.name, got, c.pause)
+		}
+	}
+}
+
+func TestLoopDetectorPauseResets(t *testing.T) {
+	d := &loopDetector{warnAt: 2, pauseAt: 3}
+	for i := 0; i < 3; i++ {
+		d.observe("read_file", `{"path":"a.go"}`, "", false)
+	}
+	if d.takePause() == "" {
+		t.Fatal("no pause after 3 identical calls")
+	}
+	// 用户选择继续后重新累计
+	if note := d.observe("read_file", `{"path":"a.go"}`, "", false); note != "" {
+		t.Fatalf("count not reset after pause: %q", note)
+	}
+}
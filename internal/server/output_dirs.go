@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/config"
+)
+
+// requestOutputDirs 由 chat 请求得到产出区列表（绝对路径、去重）；第一个为主产出区。
+// 旧客户端只发 cwd；都缺省时回退 brain.base_dir。
+func requestOutputDirs(req Request) []string {
+	raw := req.Dirs
+	if len(raw) == 0 {
+		raw = []string{req.Cwd}
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, d := range raw {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			continue
+		}
+		abs = filepath.Clean(abs)
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		out = append(out, abs)
+	}
+	if len(out) == 0 {
+		out = []string{config.GetBrainBaseDir()}
+	}
+	return out
+}
+
+// outputRoots 会话允许文件工具与 run_command 访问的产出区根。
+func outputRoots(sess *brain.Session) []string {
+	if sess != nil && len(sess.OutputDirs) > 0 {
+		return sess.OutputDirs
+	}
+	if base := config.GetBrainBaseDir(); base != "" {
+		return []string{base}
+	}
+	return nil
+}
+
+// resolveOutputPath 将 p 限制在某个产出区之下：相对路径按主产出区解析，绝对路径须落在任一产出区内。
+func resolveOutputPath(sess *brain.Session, p string) (string, error) {
+	roots := outputRoots(sess)
+	if len(roots) == 0 {
+		return "", fmt.Errorf("base directory not configured")
+	}
+	p = strings.TrimSpace(p)
+	if !filepath.IsAbs(p) {
+		return safePathUnder(roots[0], p)
+	}
+	for _, root := range roots {
+		if rel, ok := relWithin(root, p); ok {
+			return safePathUnder(root, rel)
+		}
+	}
+	return "", fmt.Errorf("path %s is outside output dirs (%s)", p, strings.Join(roots, ", "))
+}
+
+// resolveOutputDir 解析 run_command 的 cwd：空为主产出区，否则须为某产出区内已存在的目录。
+func resolveOutputDir(sess *brain.Session, p string) (string, error) {
+	roots := outputRoots(sess)
+	if len(roots) == 0 {
+		return "", fmt.Errorf("base directory not configured")
+	}
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return roots[0], nil
+	}
+	var d string
+	if filepath.IsAbs(p) {
+		for _, root := range roots {
+			if rel, ok := relWithin(root, p); ok {
+				if rel == "." {
+					d = filepath.Clean(root)
+				} else if full, err := safePathUnder(root, rel); err == nil {
+					d = full
+				}
+				break
+			}
+		}
+		if d == "" {
+			return "", fmt.Errorf("cwd %s is outside output dirs (%s)", p, strings.Join(roots, ", "))
+		}
+	} else if filepath.Clean(p) == "." {
+		d = roots[0]
+	} else {
+		full, err := safePathUnder(roots[0], p)
+		if err != nil {
+			return "", err
+		}
+		d = full
+	}
+	st, err := os.Stat(d)
+	if err != nil {
+		return "", fmt.Errorf("cwd: %w", err)
+	}
+	if !st.IsDir() {
+		return "", fmt.Errorf("cwd is not a directory: %s", p)
+	}
+	return d, nil
+}
+
+// relWithin 返回 p 相对 root 的路径；p 不在 root 之下时 ok=false。
+func relWithin(root, p string) (string, bool) {
+	r, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return r, true
+}
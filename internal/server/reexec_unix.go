@@ -0,0 +1,17 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reexec 以相同参数与环境原地重新执行本进程（PID 不变，前台 cata run 仍在原终端）。
+func Reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
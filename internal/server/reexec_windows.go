@@ -0,0 +1,24 @@
+//go:build windows
+
+package server
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Reexec 以相同参数启动新进程并退出本进程（Windows 无 exec 替换）。
+func Reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
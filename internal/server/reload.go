@@ -0,0 +1,129 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"cata/internal/config"
+	"cata/internal/mcp"
+	"cata/internal/protocol"
+)
+
+// configGate 配置只在交互回合之间替换：无进行中的交互回合时立即生效，否则待它们结束时生效，
+// 使一个交互回合内读到的配置始终一致。有待生效配置时新回合先排队，reload 最多等到当前回合结束，
+// 不会被接连开始的回合无限推迟。后台回合（定时任务、后台 task）不计入、也不等待，回合中途可能读到新配置。
+// 新配置在 mu 内发布，之后 enter 的回合必然读到它；只有 MCP 重建在锁外。
+type configGate struct {
+	mu      sync.Mutex
+	active  int
+	pending *config.AppConfig
+	// applied 有待生效配置时非 nil，生效后关闭（唤醒排队的回合）
+	applied chan struct{}
+}
+
+// enter 交互回合开始；与 leave 成对。有待生效的配置时先等它生效，需要等待时调用一次 notify。
+func (g *configGate) enter(notify func()) {
+	g.mu.Lock()
+	for g.pending != nil {
+		ch := g.applied
+		g.mu.Unlock()
+		if notify != nil {
+			notify()
+			notify = nil
+		}
+		<-ch
+		g.mu.Lock()
+	}
+	g.active++
+	g.mu.Unlock()
+}
+
+// leave 回合结束；最后一个回合结束且有待生效配置时替换。
+func (g *configGate) leave() {
+	g.mu.Lock()
+	g.active--
+	restart := false
+	if g.active == 0 && g.pending != nil {
+		restart = publishConfig(g.pending)
+		g.pending = nil
+		close(g.applied)
+		g.applied = nil
+		log.Println("Config reload: applied after in-flight turns finished")
+	}
+	g.mu.Unlock()
+	if restart {
+		// MCP 重建可能耗时，不阻塞回合收尾
+		go func() {
+			if mcp.Restart() {
+				log.Println("Config reload: MCP restarted")
+			}
+		}()
+	}
+}
+
+// swap 替换配置；有进行中的交互回合时挂起（新回合排队），返回仍在进行的回合数。
+func (g *configGate) swap(cfg *config.AppConfig) (pending int, mcpRestarted bool) {
+	g.mu.Lock()
+	if g.active > 0 {
+		g.pending = cfg
+		if g.applied == nil {
+			g.applied = make(chan struct{})
+		}
+		n := g.active
+		g.mu.Unlock()
+		return n, false
+	}
+	g.pending = nil
+	restart := publishConfig(cfg)
+	g.mu.Unlock()
+	if !restart {
+		return 0, false
+	}
+	return 0, mcp.Restart()
+}
+
+// publishConfig 持 configGate.mu 调用：发布新配置，返回 MCP 段是否变化（需在锁外重建）。
+func publishConfig(cfg *config.AppConfig) bool {
+	old := config.Current()
+	config.Set(cfg)
+	for _, c := range config.Diff(old, cfg) {
+		if strings.HasPrefix(c.Key, "mcp.") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload 重新读取并校验配置文件；校验失败时保留当前配置并返回错误（reload 命令与 SIGHUP 共用）。
+func (s *Server) Reload() (protocol.Reload, error) {
+	res := protocol.Reload{Config: config.GetConfigPath(), Changes: []protocol.ConfigChange{}}
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		return res, err
+	}
+	old := config.Current()
+	// 未配置的 base_dir 在启动时按 server 的工作目录决定，reload 沿用，不算变化
+	if old != nil && cfg.Brain.BaseDir == "" {
+		cfg.Brain.BaseDir = old.Brain.BaseDir
+	}
+	for _, c := range config.Diff(old, cfg) {
+		res.Changes = append(res.Changes, protocol.ConfigChange{Key: c.Key, Old: c.Old, New: c.New, Restart: config.NeedsRestart(c.Key)})
+	}
+	if len(res.Changes) == 0 {
+		return res, nil
+	}
+	config.KeepRestartOnly(old, cfg)
+	res.PendingTurns, res.MCPRestarted = s.configGate.swap(cfg)
+	for _, c := range res.Changes {
+		note := ""
+		if c.Restart {
+			note = " (needs restart)"
+		}
+		log.Printf("Config reload: %s: %s → %s%s", c.Key, c.Old, c.New, note)
+	}
+	if res.PendingTurns > 0 {
+		log.Printf("Config reload: waiting for %d in-flight turn(s)", res.PendingTurns)
+	}
+	return res, nil
+}
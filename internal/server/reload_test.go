@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"cata/internal/config"
+)
+
+func TestConfigGateQueuesNewTurns(t *testing.T) {
+	config.Set(&config.AppConfig{Turn: config.TurnConfig{MaxRounds: 1}})
+	var g configGate
+	g.enter(nil)
+	if n, _ := g.swap(&config.AppConfig{Turn: config.TurnConfig{MaxRounds: 2}}); n != 1 {
+		t.Fatalf("pending turns = %d, want 1", n)
+	}
+
+	entered := make(chan int)
+	notified := make(chan bool, 1)
+	go func() {
+		g.enter(func() { notified <- true })
+		entered <- config.Current().Turn.MaxRounds
+	}()
+	select {
+	case <-entered:
+		t.Fatal("new turn entered while a reload was pending")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !<-notified {
+		t.Fatal("notify not called")
+	}
+
+	g.leave()
+	if got := <-entered; got != 2 {
+		t.Fatalf("queued turn saw max_rounds %d, want the reloaded 2", got)
+	}
+	g.leave()
+	if n, _ := g.swap(&config.AppConfig{Turn: config.TurnConfig{MaxRounds: 3}}); n != 0 || config.Current().Turn.MaxRounds != 3 {
+		t.Fatalf("idle swap: pending %d, max_rounds %d", n, config.Current().Turn.MaxRounds)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cata/internal/clock"
+	"cata/internal/schedule"
+)
+
+// scheduledPrompt 定时任务提示词前缀：告知模型无人值守。
+const scheduledPrompt = "[scheduled task %s, running unattended: nobody is watching, so do not ask the user questions; finish the task and report the result]\n\n"
+
+// scheduler 每分钟读取 $CATA_HOME/schedule/jobs.json，到期任务各自在后台运行（同一任务不重叠）。
+type scheduler struct {
+	ss *SocketServer
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// startScheduler 随 server 启动；ctx 结束时停止检查（进行中的任务由 Stop 经 cancelTurns 取消）。
+func (ss *SocketServer) startScheduler(ctx context.Context) {
+	sc := &scheduler{ss: ss, running: make(map[string]bool)}
+	go func() {
+		for {
+			now := clock.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(next.Sub(now)):
+			}
+			sc.tick(next)
+		}
+	}()
+}
+
+// tick 启动在 at 这一分钟到期的任务。
+func (sc *scheduler) tick(at time.Time) {
+	jobs, err := schedule.Load()
+	if err != nil {
+		log.Printf("schedule: %v", err)
+		return
+	}
+	for _, j := range jobs {
+		c, err := schedule.ParseCron(j.Cron)
+		if err != nil {
+			log.Printf("schedule %s: %v", j.ID, err)
+			continue
+		}
+		if !c.Match(at) {
+			continue
+		}
+		sc.mu.Lock()
+		busy := sc.running[j.ID]
+		sc.running[j.ID] = true
+		sc.mu.Unlock()
+		if busy {
+			log.Printf("schedule %s: previous run still in progress, skipping %s", j.ID, at.Format("15:04"))
+			continue
+		}
+		go func(j schedule.Job) {
+			defer func() {
+				sc.mu.Lock()
+				delete(sc.running, j.ID)
+				sc.mu.Unlock()
+			}()
+			sc.ss.runScheduledJob(j, at)
+		}(j)
+	}
+}
+
+// runScheduledJob 以无人值守连接执行一次任务：事件流写 transcript，确认与选择按任务策略自动应答，结束后追加运行记录。
+func (ss *SocketServer) runScheduledJob(j schedule.Job, at time.Time) {
+	start := time.Now()
+	run := schedule.Run{Job: j.ID, At: clock.FormatTime(at, time.RFC3339), Transcript: at.Format("20060102-1504") + ".ndjson"}
+	defer func() {
+		run.DurationMS = time.Since(start).Milliseconds()
+		if err := schedule.AppendRun(run); err != nil {
+			log.Printf("schedule %s: record run: %v", j.ID, err)
+		}
+	}()
+
+	if len(j.Dirs) == 0 {
+		run.Error = "job has no dirs"
+		return
+	}
+	path := schedule.TranscriptPath(j.ID, run.Transcript)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		run.Error = err.Error()
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	defer f.Close()
+
+	hc := &headlessConn{w: f, name: "schedule " + j.ID, policy: headlessPolicy{Approve: j.Approve, Choice: j.Choice}}
+	cc := newHeadlessChatConn(hc)
+	sess := requestSession(Request{Cwd: j.Dirs[0], Dirs: j.Dirs})
+	thread := &chatThread{}
+	ss.trackClient(cc, sess, thread)
+	defer ss.untrackClient(cc)
+
+	log.Printf("schedule %s: running (%s)", j.ID, j.Cron)
+	prompt := fmt.Sprintf(scheduledPrompt, j.ID) + j.Prompt
+	if err := ss.handleTerminalChatStream(cc, sess, thread, prompt); err != nil {
+		run.Error = err.Error()
+	}
+	run.Session = thread.ID
+	if d := hc.done; d != nil {
+		run.Success, run.Cancelled, run.Limit = d.Success, d.Cancelled, d.Limit
+	}
+	if run.Error == "" && !run.Success {
+		run.Error = hc.lastErr
+	}
+	log.Printf("schedule %s: done success=%v in %s", j.ID, run.Success, time.Since(start).Round(time.Second))
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cata/internal/brain"
+	"cata/internal/ignore"
+	"cata/internal/llm"
+)
+
+const (
+	// searchDefaultMatches / searchMaxMatches search_files 返回的匹配行数
+	searchDefaultMatches = 100
+	searchMaxMatches     = 500
+	// searchMaxContext 上下文行数上限
+	searchMaxContext = 10
+	// searchMaxLine 单行超过此长度时截断显示
+	searchMaxLine = 300
+)
+
+// searchGlobs 参数可以是单个 glob 或数组。
+type searchGlobs []string
+
+func (g *searchGlobs) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		if one != "" {
+			*g = searchGlobs{one}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*g = many
+	return nil
+}
+
+// match 不含 / 的 glob 匹配文件名，否则匹配相对路径。
+func (g searchGlobs) match(rel string) bool {
+	for _, pat := range g {
+		pat = strings.TrimPrefix(filepath.ToSlash(pat), "./")
+		if !strings.Contains(pat, "/") {
+			if ignore.Match(pat, path.Base(rel)) {
+				return true
+			}
+		} else if ignore.Match(pat, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolSearchFiles 在产出区内按正则（literal 时按字面）搜索文件内容，按文件分组输出行号与上下文。
+// 遵循 .gitignore，跳过 .git / node_modules、二进制文件与超过 max_read_bytes 的文件。
+func toolSearchFiles(sess *brain.Session, argsJSON string) (string, error) {
+	var p struct {
+		Pattern         string      `json:"pattern"`
+		Literal         bool        `json:"literal"`
+		CaseInsensitive bool        `json:"case_insensitive"`
+		Path            string      `json:"path"`
+		Include         searchGlobs `json:"include"`
+		Exclude         searchGlobs `json:"exclude"`
+		Context         int         `json:"context"`
+		MaxMatches      int         `json:"max_matches"`
+		All             bool        `json:"all"`
+	}
+	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
+		return "", fmt.Errorf("search_files args: %w", err)
+	}
+	if p.Pattern == "" {
+		return "", fmt.Errorf("search_files: pattern required")
+	}
+	expr := p.Pattern
+	if p.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if p.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("search_files: bad regex (pass literal:true to search plain text): %w", err)
+	}
+	if p.Context < 0 {
+		p.Context = 0
+	}
+	if p.Context > searchMaxContext {
+		p.Context = searchMaxContext
+	}
+	if p.MaxMatches <= 0 {
+		p.MaxMatches = searchDefaultMatches
+	}
+	if p.MaxMatches > searchMaxMatches {
+		p.MaxMatches = searchMaxMatches
+	}
+
+	// path 可以是单个文件
+	var root, single string
+	if t := strings.TrimSpace(p.Path); t != "" && filepath.Clean(t) != "." {
+		if full, err := resolveWorkspaceFile(sess, t); err == nil {
+			if st, err := os.Stat(full); err == nil && !st.IsDir() {
+				root, single = filepath.Dir(full), filepath.Base(full)
+			}
+		}
+	}
+	if root == "" {
+		if root, err = resolveListDir(sess, "search_files", p.Path); err != nil {
+			return "", err
+		}
+	}
+
+	maxRead, _ := workspaceFileLimits()
+	var out strings.Builder
+	matches, files, scanned, skipped := 0, 0, 0, 0
+	stopped := ""
+	search := func(rel string) error {
+		if single == "" && (len(p.Include) > 0 && !p.Include.match(rel) || p.Exclude.match(rel)) {
+			return nil
+		}
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		st, err := os.Stat(full)
+		if err != nil || !st.Mode().IsRegular() {
+			return nil
+		}
+		if st.Size() > int64(maxRead) {
+			skipped++
+			return nil
+		}
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return nil
+		}
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil
+		}
+		n, done := searchFileLines(&out, rel, data, re, p.Context, p.MaxMatches-matches)
+		if n > 0 {
+			files++
+			matches += n
+		}
+		if done {
+			stopped = fmt.Sprintf("stopped at max_matches %d", p.MaxMatches)
+			return filepath.SkipAll
+		}
+		return nil
+	}
+	if single != "" {
+		if err = search(single); err == filepath.SkipAll {
+			err = nil
+		}
+	} else {
+		err = ignore.Walk(root, ignore.Options{All: p.All}, func(rel string, d fs.DirEntry) error {
+			if scanned++; scanned > listMaxScan {
+				stopped = fmt.Sprintf("scan stopped after %d entries; narrow path or include", listMaxScan)
+				return filepath.SkipAll
+			}
+			if d.IsDir() {
+				return nil
+			}
+			return search(rel)
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	where := root
+	if single != "" {
+		where = filepath.Join(root, single)
+	}
+	head := fmt.Sprintf("search_files %q in %s: %d match(es) in %d file(s)", p.Pattern, where, matches, files)
+	if stopped != "" {
+		head += " (" + stopped + ")"
+	}
+	if skipped > 0 {
+		head += fmt.Sprintf("; %d file(s) over max_read_bytes skipped", skipped)
+	}
+	if matches == 0 {
+		return head, nil
+	}
+	return head + "\n" + strings.TrimRight(out.String(), "\n"), nil
+}
+
+// searchFileLines 把 data 中的匹配写入 out（文件名一行，其下 "行号:" 为匹配、"行号-" 为上下文，带上下文时不相邻的块以 -- 分隔）。
+// 返回匹配行数；写满 budget 后仍有匹配时 done 为 true（该匹配不输出）。
+func searchFileLines(out *strings.Builder, rel string, data []byte, re *regexp.Regexp, context, budget int) (n int, done bool) {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	last := -1 // 已输出的最后一行（0-based）
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		if n >= budget {
+			return n, true
+		}
+		if n == 0 {
+			out.WriteString(rel + "\n")
+		}
+		from := max(i-context, last+1)
+		if context > 0 && last >= 0 && from > last+1 {
+			out.WriteString("  --\n")
+		}
+		for j := from; j < i; j++ {
+			writeSearchLine(out, j+1, '-', lines[j])
+		}
+		writeSearchLine(out, i+1, ':', line)
+		last = i
+		n++
+		// 后文上下文在下一个匹配前或文件末尾补齐
+		end := min(i+context, len(lines)-1)
+		next := i + 1
+		for next <= end && !re.MatchString(lines[next]) {
+			writeSearchLine(out, next+1, '-', lines[next])
+			last = next
+			next++
+		}
+	}
+	return n, false
+}
+
+func writeSearchLine(out *strings.Builder, no int, sep byte, line string) {
+	line = strings.TrimRight(line, "\r")
+	if r := []rune(line); len(r) > searchMaxLine {
+		line = string(r[:searchMaxLine]) + "…"
+	}
+	fmt.Fprintf(out, "  %d%c %s\n", no, sep, line)
+}
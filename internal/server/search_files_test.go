@@ -0,0 +1,33 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSearchFileLinesBudget(t *testing.T) {
+	data := []byte("a1\nb\na2\nb\na3\n")
+	re := regexp.MustCompile(`^a`)
+	cases := []struct {
+		budget int
+		n      int
+		done   bool
+	}{
+		{budget: 0, n: 0, done: true},
+		{budget: 2, n: 2, done: true},
+		// 最后一个匹配恰好用完额度：没有被截掉的结果
+		{budget: 3, n: 3, done: false},
+		{budget: 5, n: 3, done: false},
+	}
+	for _, c := range cases {
+		var out strings.Builder
+		n, done := searchFileLines(&out, "f.txt", data, re, 0, c.budget)
+		if n != c.n || done != c.done {
+			t.Errorf("budget %d: n=%d done=%v, want n=%d done=%v", c.budget, n, done, c.n, c.done)
+		}
+		if got := strings.Count(out.String(), ": a"); got != c.n {
+			t.Errorf("budget %d: wrote %d matches, want %d:\n%s", c.budget, got, c.n, out.String())
+		}
+	}
+}
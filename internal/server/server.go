@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -22,12 +23,21 @@ type Server struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	managed   bool // true：由 cata chat 自动拉起，最后一个客户端断开后退出
+	startedAt time.Time
+
+	stopOnce sync.Once
+	restart  atomic.Bool // Stop 后由 main 以相同参数重新执行本进程
+
+	configGate configGate // reload 的配置在回合之间替换
 }
 
+// stopGraceTimeout 停止时等待进行中的 chat 回合收尾（取消后落盘会话）的上限。
+const stopGraceTimeout = 10 * time.Second
+
 // NewServer 创建服务器实例。managed 为 true 时无客户端连接后自动停止。
 func NewServer(managed bool) (*Server, error) {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Server{ctx: ctx, cancel: cancel, managed: managed}, nil
+	return &Server{ctx: ctx, cancel: cancel, managed: managed, startedAt: time.Now()}, nil
 }
 
 // ClientDisconnected 在 socket 客户端断开时调用。
@@ -38,7 +48,7 @@ func (s *Server) ClientDisconnected() {
 	if atomic.LoadInt32(&activeChatStreams) > 0 {
 		return
 	}
-	if s.socketSrv != nil && s.socketSrv.ChatSessions() > 0 {
+	if s.socketSrv != nil && (s.socketSrv.ChatSessions() > 0 || s.socketSrv.tasks.active() > 0) {
 		return
 	}
 	log.Println("Managed server: no chat clients, shutting down...")
@@ -54,13 +64,10 @@ func (s *Server) Start() error {
 		return fmt.Errorf("create socket server: %w", err)
 	}
 	s.socketSrv = socketSrv
-	socketSrv.Start()
-	log.Println("✓ Socket server started")
 
-	log.Println("- MCP: lazy init on first chat (if enabled)")
-
-	if config.Config != nil && config.Config.Evolution.Enabled {
-		interval := time.Duration(config.Config.Evolution.CycleInterval) * time.Second
+	// 演进引擎先于 socket 就绪（status 命令会读取）
+	if cfg := config.Current(); cfg != nil && cfg.Evolution.Enabled {
+		interval := time.Duration(cfg.Evolution.CycleInterval) * time.Second
 		if interval <= 0 {
 			interval = 10 * time.Minute
 		}
@@ -71,8 +78,16 @@ func (s *Server) Start() error {
 		log.Println("- Autonomous evolution disabled")
 	}
 
+	// task 队列先于 socket 就绪（task_* 命令会读取）
+	socketSrv.startTasks()
+	socketSrv.Start()
+	log.Println("✓ Socket server started")
+	socketSrv.startScheduler(s.ctx)
+
+	log.Println("- MCP: lazy init on first chat (if enabled)")
+
 	s.setupSignalHandling()
-	if config.Config != nil && !config.Config.Exec.Enabled {
+	if cfg := config.Current(); cfg != nil && !cfg.Exec.Enabled {
 		log.Println("WARNING: exec.enabled=false — terminal run_command disabled until config is updated")
 	}
 	if s.managed {
@@ -85,23 +100,52 @@ func (s *Server) Start() error {
 
 func (s *Server) setupSignalHandling() {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 	go func() {
-		sig := <-sigChan
-		log.Printf("Received signal: %v, shutting down...", sig)
-		s.Stop()
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				log.Println("Received SIGHUP, reloading config...")
+				if _, err := s.Reload(); err != nil {
+					log.Printf("Config reload failed (keeping current config): %v", err)
+				}
+				continue
+			}
+			log.Printf("Received signal: %v, shutting down...", sig)
+			s.Stop()
+			return
+		}
 	}()
 }
 
-// Stop 优雅停止。
+// Stop 优雅停止：不再接受连接，取消进行中的 chat 回合并等其收尾（会话落盘），再关闭 MCP。可重复调用。
 func (s *Server) Stop() {
-	mcp.Shutdown()
-	s.cancel()
-	if s.socketSrv != nil {
-		s.socketSrv.Stop()
-	}
-	time.Sleep(100 * time.Millisecond)
-	log.Println("Server stopped")
+	s.stopOnce.Do(func() {
+		if s.socketSrv != nil {
+			s.socketSrv.Stop()
+			if n := s.socketSrv.cancelTurns(); n > 0 {
+				log.Printf("Cancelling %d in-flight chat turn(s)...", n)
+			}
+			deadline := time.Now().Add(stopGraceTimeout)
+			for atomic.LoadInt32(&activeChatStreams) > 0 && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		mcp.Shutdown()
+		s.cancel()
+		time.Sleep(100 * time.Millisecond)
+		log.Println("Server stopped")
+	})
+}
+
+// Restart 优雅停止后重新执行本进程（加载新配置与新二进制）；Wait 返回后由调用方执行 Reexec。
+func (s *Server) Restart() {
+	s.restart.Store(true)
+	s.Stop()
+}
+
+// RestartRequested Wait 返回后是否应 Reexec。
+func (s *Server) RestartRequested() bool {
+	return s.restart.Load()
 }
 
 // Wait 阻塞直到收到停止信号。
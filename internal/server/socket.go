@@ -1,20 +1,21 @@
 package server
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"cata/internal/brain"
 	"cata/internal/client"
 	"cata/internal/config"
-	"cata/internal/llm"
+	"cata/internal/protocol"
 )
 
 // SocketServer 处理客户端连接
@@ -22,6 +23,18 @@ type SocketServer struct {
 	server       *Server
 	ln           net.Listener
 	chatSessions int32 // 仅统计 cata chat 长连接；ping 探测不计入
+
+	mu      sync.Mutex
+	clients map[*chatConn]*chatClient // 已发过 chat 类请求的连接（status 汇报、停止时取消回合）
+	tasks   *taskQueue                // 后台 task（startTasks 后非 nil）
+}
+
+// chatClient 一条 chat 连接的概况，由该连接的主循环在每条请求后更新。
+type chatClient struct {
+	connectedAt time.Time
+	dirs        []string
+	workspace   *brain.Workspace
+	session     string
 }
 
 // ChatSessions 返回当前交互式 chat 会话数（不含 ping 探活连接）。
@@ -29,28 +42,11 @@ func (ss *SocketServer) ChatSessions() int32 {
 	return atomic.LoadInt32(&ss.chatSessions)
 }
 
-// Request 客户端请求
-type Request struct {
-	Command string `json:"command"`
-	// Text 用于 chat 的完整用户输入
-	Text string `json:"text,omitempty"`
-	// Stream 为 true 时 chat 走 NDJSON 流式事件（token / tool_* / done 等）
-	Stream bool `json:"stream,omitempty"`
-	// ExecConfirm：流式 chat 中收到 exec_confirm_required 后由客户端发送（非 LLM）
-	ConfirmID string `json:"confirm_id,omitempty"`
-	Approved  bool   `json:"approved,omitempty"`
-	// Cwd 产出区：当前工作目录（命令与交付物）；用于选脑子分区 + exec.cwd
-	Cwd string `json:"cwd,omitempty"`
-	// Runtime 客户端所在 OS/终端（注入 LLM，避免生成需多轮纠正的命令）
-	Runtime *brain.RuntimeEnv `json:"runtime,omitempty"`
-}
-
-// Response 服务器响应
-type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-}
+// Request / Response 协议类型见 internal/protocol（与客户端共用）。
+type (
+	Request  = protocol.Request
+	Response = protocol.Response
+)
 
 // NewSocketServer 创建 socket 服务器
 func NewSocketServer(srv *Server) (*SocketServer, error) {
@@ -95,6 +91,9 @@ func (ss *SocketServer) Start() {
 			conn, err := ss.ln.Accept()
 			if err != nil {
 				// 检查是否因为关闭而错误
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				select {
 				case <-ss.server.ctx.Done():
 					return
@@ -112,6 +111,9 @@ func (ss *SocketServer) Start() {
 
 // Stop 停止 socket 服务器
 func (ss *SocketServer) Stop() {
+	if ss.tasks != nil {
+		ss.tasks.close()
+	}
 	if ss.ln != nil {
 		ss.ln.Close()
 		socketPath := getSocketPath()
@@ -122,12 +124,15 @@ func (ss *SocketServer) Stop() {
 
 // handleConnection 处理客户端连接
 func (ss *SocketServer) handleConnection(conn net.Conn) {
+	// cc 统一读取本连接：chat_cancel 与回合内的确认/选择由读协程分流，其余请求在此顺序处理
+	cc := newChatConn(conn)
 	var chatSession bool
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("connection handler panic: %v", r)
 		}
 		conn.Close()
+		ss.untrackClient(cc)
 		if chatSession {
 			if atomic.AddInt32(&ss.chatSessions, -1) == 0 {
 				ss.server.ClientDisconnected()
@@ -135,30 +140,30 @@ func (ss *SocketServer) handleConnection(conn net.Conn) {
 		}
 	}()
 
-	var chatHistory []llm.Message
+	// thread 本连接的对话 history（持久化为 workspace 会话，可 resume）
+	thread := &chatThread{}
+	// sess 本连接的脑子/产出区绑定；每条 chat 请求按其 dirs 与 runtime 重建
+	var sess *brain.Session
 
-	scanner := bufio.NewScanner(conn)
-	lineBuf := make([]byte, 0, 64*1024)
-	scanner.Buffer(lineBuf, 4<<20)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		// 解析请求
-		var req Request
-		if err := json.Unmarshal([]byte(line), &req); err != nil {
+	for in := range cc.readRequests() {
+		if in.err != nil {
 			ss.sendResponse(conn, Response{
 				Success: false,
-				Message: fmt.Sprintf("Invalid request: %v", err),
+				Message: fmt.Sprintf("Invalid request: %v", in.err),
 			})
 			continue
 		}
+		req := in.req
 
 		switch req.Command {
-		case "chat":
+		case protocol.CmdHello:
+			resp := helloResponse(req)
+			if h, ok := resp.Data.(protocol.Hello); ok && resp.Success {
+				cc.features = h.Features
+			}
+			ss.sendResponse(conn, resp)
+			continue
+		case protocol.CmdChat:
 			ss.markChatSession(&chatSession)
 			if !req.Stream {
 				ss.sendResponse(conn, Response{
@@ -167,40 +172,174 @@ func (ss *SocketServer) handleConnection(conn net.Conn) {
 				})
 				continue
 			}
-			cwd := strings.TrimSpace(req.Cwd)
-			if cwd == "" {
-				cwd = config.GetBrainBaseDir()
+			sess = requestSession(req)
+			ss.trackClient(cc, sess, thread)
+			if err := ss.handleTerminalChatStream(cc, sess, thread, req.Text); err != nil {
+				log.Printf("terminal chat stream: %v", err)
 			}
-			if req.Runtime != nil {
-				brain.SetRuntimeEnv(req.Runtime)
-			} else {
-				e := brain.DetectLocalRuntimeEnv()
-				brain.SetRuntimeEnv(&e)
+			ss.trackClient(cc, sess, thread)
+			continue
+		case protocol.CmdChatReset:
+			ss.markChatSession(&chatSession)
+			thread = &chatThread{}
+			if sess != nil && sess.Workspace != nil {
+				if err := brain.AppendSessionBoundaryFor(sess.Workspace); err != nil {
+					log.Printf("short-term session boundary: %v", err)
+				}
+			}
+			ss.trackClient(cc, sess, thread)
+			ss.sendResponse(conn, Response{Success: true, Message: "Conversation cleared."})
+			continue
+		case protocol.CmdSessionList:
+			ss.markChatSession(&chatSession)
+			sess = requestSession(req)
+			ss.trackClient(cc, sess, thread)
+			if sess.Workspace == nil {
+				ss.sendResponse(conn, Response{Success: false, Message: "no brain workspace for this directory"})
+				continue
 			}
-			if _, err := brain.ResolveWorkspace(cwd); err != nil {
-				log.Printf("resolve brain: %v", err)
+			list, err := listChatSessions(sess.Workspace)
+			if err != nil {
+				ss.sendResponse(conn, Response{Success: false, Message: err.Error()})
+				continue
 			}
-			if err := ss.handleTerminalChatStream(conn, &chatHistory, req.Text); err != nil {
-				log.Printf("terminal chat stream: %v", err)
+			if list == nil {
+				list = []chatSessionInfo{}
 			}
+			ss.sendResponse(conn, Response{Success: true, Message: fmt.Sprintf("%d session(s)", len(list)), Data: list})
 			continue
-		case "chat_reset":
+		case protocol.CmdSessionResume:
 			ss.markChatSession(&chatSession)
-			chatHistory = nil
-			if err := brain.AppendSessionBoundary(); err != nil {
-				log.Printf("short-term session boundary: %v", err)
+			sess = requestSession(req)
+			t, err := resumeChatThread(sess.Workspace, req.Session)
+			if err != nil {
+				ss.sendResponse(conn, Response{Success: false, Message: err.Error()})
+				continue
+			}
+			thread = t
+			ss.trackClient(cc, sess, thread)
+			ss.sendResponse(conn, Response{
+				Success: true,
+				Message: fmt.Sprintf("Resumed session %s (%d messages).", t.ID, len(t.History)),
+				Data:    t.ID,
+			})
+			continue
+		case protocol.CmdUsage:
+			if sess == nil {
+				sess = requestSession(req)
+			}
+			ss.sendResponse(conn, usageResponse(req, sess, thread))
+			continue
+		case protocol.CmdAudit:
+			if sess == nil {
+				sess = requestSession(req)
+			}
+			ss.sendResponse(conn, auditResponse(req, sess))
+			continue
+		case protocol.CmdCheckpointList, protocol.CmdCheckpointRestore:
+			if sess == nil {
+				sess = requestSession(req)
+			}
+			if req.Command == protocol.CmdCheckpointList {
+				ss.sendResponse(conn, checkpointListResponse(sess, thread))
+			} else {
+				ss.sendResponse(conn, checkpointRestoreResponse(req, sess, thread))
+			}
+			continue
+		case protocol.CmdTaskSubmit, protocol.CmdTaskList, protocol.CmdTaskStatus, protocol.CmdTaskCancel:
+			ss.sendResponse(conn, ss.taskResponse(req))
+			continue
+		case protocol.CmdTaskAttach:
+			ss.attachTask(cc, req.Task)
+			continue
+		case protocol.CmdStatus:
+			ss.sendResponse(conn, Response{Success: true, Message: "running", Data: ss.status()})
+			continue
+		case protocol.CmdReload:
+			res, err := ss.server.Reload()
+			if err != nil {
+				ss.sendResponse(conn, Response{Success: false, Message: "reload failed, keeping current config: " + err.Error()})
+				continue
+			}
+			msg := fmt.Sprintf("config reloaded: %d change(s)", len(res.Changes))
+			if res.PendingTurns > 0 {
+				msg += fmt.Sprintf(", applies after %d in-flight turn(s)", res.PendingTurns)
+			}
+			ss.sendResponse(conn, Response{Success: true, Message: msg, Data: res})
+			continue
+		case protocol.CmdStop, protocol.CmdRestart:
+			restart := req.Command == protocol.CmdRestart
+			log.Printf("%s requested by client", req.Command)
+			ss.sendResponse(conn, Response{
+				Success: true,
+				Message: fmt.Sprintf("%s: stopping server (pid %d, %d chat client(s))", req.Command, os.Getpid(), ss.ChatSessions()),
+			})
+			if restart {
+				go ss.server.Restart()
+			} else {
+				go ss.server.Stop()
 			}
-			ss.sendResponse(conn, Response{Success: true, Message: "Conversation cleared."})
 			continue
 		default:
 			resp := ss.handleCommand(req)
 			ss.sendResponse(conn, resp)
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading from connection: %v", err)
+// requestSession 按请求的产出区与运行环境构造会话绑定（解析失败时 Workspace 为 nil）。
+func requestSession(req Request) *brain.Session {
+	env := req.Runtime
+	if env == nil {
+		e := brain.DetectLocalRuntimeEnv()
+		env = &e
+	}
+	sess, err := brain.NewSession(requestOutputDirs(req), env)
+	if err != nil {
+		log.Printf("resolve brain: %v", err)
 	}
+	if sess == nil {
+		sess = &brain.Session{}
+	}
+	return sess
+}
+
+// trackClient 记录连接当前的产出区、脑子分区与会话 id。
+func (ss *SocketServer) trackClient(cc *chatConn, sess *brain.Session, thread *chatThread) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.clients == nil {
+		ss.clients = make(map[*chatConn]*chatClient)
+	}
+	c := ss.clients[cc]
+	if c == nil {
+		c = &chatClient{connectedAt: time.Now()}
+		ss.clients[cc] = c
+	}
+	if sess != nil {
+		c.dirs = sess.OutputDirs
+		c.workspace = sess.Workspace
+	}
+	c.session = thread.ID
+}
+
+func (ss *SocketServer) untrackClient(cc *chatConn) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.clients, cc)
+}
+
+// cancelTurns 取消所有连接上进行中的回合；返回取消的个数。
+func (ss *SocketServer) cancelTurns() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	n := 0
+	for cc := range ss.clients {
+		if cc.cancelTurn() {
+			n++
+		}
+	}
+	return n
 }
 
 func (ss *SocketServer) markChatSession(chatSession *bool) {
@@ -214,7 +353,7 @@ func (ss *SocketServer) markChatSession(chatSession *bool) {
 // handleCommand 处理非 chat 类 socket 命令（终端客户端仅需 ping）。
 func (ss *SocketServer) handleCommand(req Request) Response {
 	switch req.Command {
-	case "ping":
+	case protocol.CmdPing:
 		return Response{Success: true, Message: "pong"}
 	default:
 		return Response{
@@ -224,6 +363,26 @@ func (ss *SocketServer) handleCommand(req Request) Response {
 	}
 }
 
+// helloResponse 协商协议版本与特性；版本无交集时 Success=false，客户端据此拒绝运行。
+func helloResponse(req Request) Response {
+	min := req.MinVersion
+	if min == 0 {
+		min = req.Version
+	}
+	version, features, err := protocol.Negotiate(req.Version, min, req.Features)
+	if err != nil {
+		return Response{Success: false, Message: err.Error(), Data: protocol.Hello{Version: protocol.Version, MinVersion: protocol.MinVersion}}
+	}
+	if features == nil {
+		features = []string{}
+	}
+	return Response{
+		Success: true,
+		Message: fmt.Sprintf("cata protocol v%d", version),
+		Data:    protocol.Hello{Version: version, MinVersion: protocol.MinVersion, Features: features},
+	}
+}
+
 // sendResponse 发送响应
 func (ss *SocketServer) sendResponse(conn net.Conn, resp Response) {
 	data, err := json.Marshal(resp)
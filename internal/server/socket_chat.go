@@ -1,7 +1,6 @@
 package server
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"crypto/rand"
@@ -9,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -19,12 +19,16 @@ import (
 	"sync/atomic"
 	"time"
 
+	"cata/internal/audit"
 	"cata/internal/brain"
+	"cata/internal/checkpoint"
 	"cata/internal/config"
 	"cata/internal/evolve"
 	"cata/internal/execcmd"
 	"cata/internal/llm"
 	"cata/internal/mcp"
+	"cata/internal/protocol"
+	"cata/internal/usage"
 )
 
 var activeChatStreams int32
@@ -37,8 +41,8 @@ const execConfirmWaitTimeout = 10 * time.Minute
 // 终端对话：history 仅维护 user / assistant / tool。boot-leader.md 与 brain 节选由 internal/llm.Client.withBootLeaderSystemMessage 在出站前注入为前两条 system（与 user 无关）；工具仅经 API 的 tools 字段。旧版 terminalUserContent 已移除。
 
 // emitStreamLine 向 CLI 写入一行 NDJSON（无换行外的分隔；每条独立 JSON）。
-func (ss *SocketServer) emitStreamLine(conn net.Conn, ev map[string]interface{}) error {
-	data, err := json.Marshal(ev)
+func (ss *SocketServer) emitStreamLine(conn net.Conn, ev protocol.Event) error {
+	data, err := protocol.Encode(ev)
 	if err != nil {
 		return err
 	}
@@ -48,103 +52,172 @@ func (ss *SocketServer) emitStreamLine(conn net.Conn, ev map[string]interface{})
 }
 
 // handleTerminalChatStream 流式 + 服务端工具循环；协议为多条 NDJSON，最后一条 type=done。
-func (ss *SocketServer) handleTerminalChatStream(conn net.Conn, history *[]llm.Message, userText string) (err error) {
+// sess 为本连接的会话绑定，经 ctx 传给 LLM 上下文组装、工具与会话压缩。
+// 回合 ctx 可被同连接的 chat_cancel 取消：中止 LLM 流、run_command 与 MCP 调用，history 补齐后以 done cancelled 结束。
+// thread 的 history 在每轮工具后与回合结束时落盘（可 --resume）。
+func (ss *SocketServer) handleTerminalChatStream(conn *chatConn, sess *brain.Session, thread *chatThread, userText string) (err error) {
+	// 计数在会话落盘之后才减：停止 server 时据此等待回合收尾
 	atomic.AddInt32(&activeChatStreams, 1)
 	defer atomic.AddInt32(&activeChatStreams, -1)
+	// 交互回合内配置不变：reload 的新配置待回合结束后替换（后台回合不参与，见 configGate）
+	if _, background := conn.Conn.(*headlessConn); !background {
+		ss.server.configGate.enter(func() {
+			_ = ss.emitStreamLine(conn, protocol.Progress{Message: "waiting for in-flight turns to finish before applying the reloaded config"})
+		})
+		defer ss.server.configGate.leave()
+	}
+	history := &thread.History
+	defer thread.save(sess.Workspace)
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("chat stream panic: %v\n%s", r, debug.Stack())
-			_ = ss.emitStreamLine(conn, map[string]interface{}{
-				"type": "error", "message": fmt.Sprintf("internal error: %v", r),
-			})
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": false})
+			_ = ss.emitStreamLine(conn, protocol.Error{Message: fmt.Sprintf("internal error: %v", r)})
+			_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Session: thread.ID})
 			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
 
+	// 回合一开始即可取消（MCP 初始化等准备阶段也算）
+	ctx, endTurn := conn.beginTurn(brain.WithSession(context.Background(), sess))
+	defer endTurn()
+	// LLM 限流排队：无客户端的回合（定时任务、后台 task）让位于交互 chat；等待原因以 progress 报告
+	priority := llm.PriorityInteractive
+	if _, ok := conn.Conn.(*headlessConn); ok {
+		priority = llm.PriorityBackground
+	}
+	ctx = llm.WithPriority(ctx, priority)
+	ctx = llm.WithQueueNotice(ctx, func(msg string) {
+		_ = ss.emitStreamLine(conn, protocol.Progress{Message: msg})
+	})
+	ctx = withFileReads(ctx, &thread.reads)
+
 	_ = config.InitBrainPath()
 
 	text := strings.TrimSpace(userText)
 	if text == "" {
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "error", "message": "empty message"})
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": false})
+		_ = ss.emitStreamLine(conn, protocol.Error{Message: "empty message"})
+		_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Session: thread.ID})
 		return fmt.Errorf("empty message")
 	}
 
 	client, err := llm.NewClientForRole(llm.RoleChat)
 	if err != nil {
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "error", "message": fmt.Sprintf("LLM: %v", err)})
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": false})
+		_ = ss.emitStreamLine(conn, protocol.Error{Message: fmt.Sprintf("LLM: %v", err)})
+		_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Session: thread.ID})
 		return err
 	}
 
 	*history = append(*history, llm.Message{Role: "user", Content: text})
+	// 会话 id 随首条消息分配，done 事件带回客户端（断线重连后据此 session_resume）
+	if thread.ID == "" {
+		thread.ID = newChatSessionID()
+	}
+	ctx = usage.WithSession(ctx, thread.ID)
+	ctx = withCheckpoint(ctx, checkpoint.Begin(sess.Workspace, thread.ID, text))
 
-	mcp.ReinitIfNeeded()
-	tools := ss.buildTerminalChatTools()
+	mgr := mcp.Acquire(sess.Capabilities())
+	defer mcp.Release(mgr)
+	ctx = mcp.WithManager(ctx, mgr)
+	tools := ss.buildTerminalChatTools(sess, mgr)
 	if len(tools) == 0 {
-		msg := "无可用工具：请在 " + config.GetConfigPath() + " 启用 exec.enabled 或 workspace_files.enabled，然后 /exit 重进以拉起新 server。"
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "error", "message": msg})
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": false})
+		msg := "无可用工具：请在 " + config.GetConfigPath() + " 启用 exec.enabled 或 workspace_files.enabled，然后 cata reload 重新加载配置。"
+		_ = ss.emitStreamLine(conn, protocol.Error{Message: msg})
+		_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Session: thread.ID})
 		return fmt.Errorf("no terminal tools enabled")
 	}
-	ctx := context.Background()
 
+	limits := newTurnLimits()
+	loops := newLoopDetector()
 	for round := 1; ; round++ {
-		ss.maybeContextCompress(conn, client, history, tools)
-		_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "progress", "message": fmt.Sprintf("model round %d", round)})
+		// 到达回合上限：客户端可延长，否则不带工具总结后结束
+		for {
+			limit, used, max := limits.exceeded(round - 1)
+			if limit == "" {
+				break
+			}
+			extend, err := ss.askExtendTurn(ctx, conn, limit, used, max)
+			if ctx.Err() != nil {
+				ss.finishCancelledTurn(conn, thread, "", nil)
+				return nil
+			}
+			if err != nil || !extend {
+				ss.finishLimitedTurn(ctx, conn, client, thread, sess, text, tools, round, limit, limitDesc(limit, used, max))
+				return nil
+			}
+			limits.extend(limit, used)
+			_ = ss.emitStreamLine(conn, protocol.Progress{Message: "turn limit extended (" + limitDesc(limit, used, max) + ")"})
+		}
+		ss.maybeContextCompress(ctx, conn, client, history, tools)
+		_ = ss.emitStreamLine(conn, protocol.Progress{Message: fmt.Sprintf("model round %d", round)})
 
+		// partial 本次尝试已流出的正文；取消时保留进 history
+		var partial strings.Builder
 		onDelta := func(s string) error {
 			if s == "" {
 				return nil
 			}
-			return ss.emitStreamLine(conn, map[string]interface{}{"type": "token", "content": s})
+			partial.WriteString(s)
+			return ss.emitStreamLine(conn, protocol.Token{Content: s})
 		}
 
 		const maxLLMAttempts = 3
 		var asst string
 		var reasoning string
 		var toolCalls []llm.ToolCall
+		var used llm.Usage
 		var err error
 		for attempt := 1; attempt <= maxLLMAttempts; attempt++ {
 			if attempt > 1 {
-				_ = ss.emitStreamLine(conn, map[string]interface{}{
-					"type": "progress", "message": fmt.Sprintf("LLM 超时或网络抖动，重试 %d/%d …", attempt, maxLLMAttempts),
-				})
-				time.Sleep(time.Duration(attempt) * time.Second)
+				msg := fmt.Sprintf("LLM 超时或网络抖动，重试 %d/%d …", attempt, maxLLMAttempts)
+				var rl *llm.RateLimitError
+				if errors.As(err, &rl) {
+					msg = fmt.Sprintf("LLM 限流（429），%s 后重试 %d/%d …", rl.RetryAfter.Round(time.Second), attempt, maxLLMAttempts)
+				}
+				_ = ss.emitStreamLine(conn, protocol.Progress{Message: msg})
+				select {
+				case <-ctx.Done():
+				case <-time.After(llm.RetryDelay(err, attempt)):
+				}
 			}
-			asst, reasoning, toolCalls, _, err = client.ChatStreamRound(ctx, *history, tools, "auto", 0, 0, onDelta)
+			partial.Reset()
+			asst, reasoning, toolCalls, _, used, err = client.ChatStreamRound(ctx, *history, tools, "auto", 0, 0, onDelta)
 			toolCalls = llm.NormalizeToolCalls(toolCalls)
 			if err == nil {
 				break
 			}
-			if !llm.IsRetryableChatError(err) || attempt == maxLLMAttempts {
+			if ctx.Err() != nil || !llm.IsRetryableChatError(err) || attempt == maxLLMAttempts {
 				break
 			}
 			log.Printf("chat stream round %d attempt %d: %v", round, attempt, err)
 		}
 		if err != nil {
+			if ctx.Err() != nil {
+				ss.finishCancelledTurn(conn, thread, partial.String(), nil)
+				return nil
+			}
 			msg := err.Error() + "\n\n本连接对话上下文已保留（含已执行的工具结果）。直接输入「继续」即可接着做，无需从头重述任务。"
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "error", "message": msg})
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": false})
+			_ = ss.emitStreamLine(conn, protocol.Error{Message: msg})
+			_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Session: thread.ID})
 			return err
 		}
 
+		ss.emitRoundUsage(conn, client, round, used)
+
 		if len(toolCalls) == 0 {
-			if parsed, stripped := llm.ParseEmbeddedToolCalls(asst); len(parsed) > 0 {
+			if parsed, stripped := llm.ParseEmbeddedToolCalls(asst, sess.Env()); len(parsed) > 0 {
 				toolCalls = llm.NormalizeToolCalls(parsed)
 				asst = stripped
-				_ = ss.emitStreamLine(conn, map[string]interface{}{
-					"type": "progress", "message": fmt.Sprintf("executing %d tool(s) from model output", len(parsed)),
+				_ = ss.emitStreamLine(conn, protocol.Progress{
+					Message: fmt.Sprintf("executing %d tool(s) from model output", len(parsed)),
 				})
 			} else if strings.Contains(strings.ToLower(asst), "<tool") || strings.Contains(asst, "[tool_call") {
-				hint := "模型返回了 tool 标记但未解析成功；大文件请分块 append_file。/exit 后重进以加载新 server。"
+				hint := "模型返回了 tool 标记但未解析成功；整文件请用 write_file，超过 max_write_bytes 时分块 append_file。cata restart 可加载新 server。"
 				log.Printf("embedded tool parse failed, content prefix: %.200q", asst)
-				_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "error", "message": hint})
+				_ = ss.emitStreamLine(conn, protocol.Error{Message: hint})
 			}
 		} else if len(toolCalls) > 0 {
 			// 流式 arguments 可能截断；尝试从正文中的 [tool_call name] {json} 补全
-			if parsed, stripped := llm.ParseEmbeddedToolCalls(asst); len(parsed) > 0 {
+			if parsed, stripped := llm.ParseEmbeddedToolCalls(asst, sess.Env()); len(parsed) > 0 {
 				byName := make(map[string]llm.ToolCall)
 				for _, p := range parsed {
 					if llm.NormalizeToolArguments(p.Function.Name, p.Function.Arguments) != "" {
@@ -170,11 +243,13 @@ func (ss *SocketServer) handleTerminalChatStream(conn net.Conn, history *[]llm.M
 
 		if len(toolCalls) == 0 {
 			*history = append(*history, llm.Message{Role: "assistant", Content: asst})
-			if err := brain.AppendChatTurn(text, asst); err != nil {
-				log.Printf("short-term memory: %v", err)
+			if sess.Workspace != nil {
+				if err := brain.AppendChatTurnFor(sess.Workspace, text, asst); err != nil {
+					log.Printf("short-term memory: %v", err)
+				}
 			}
-			ss.maybeContextCompress(conn, client, history, tools)
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "done", "success": true})
+			ss.maybeContextCompress(ctx, conn, client, history, tools)
+			_ = ss.emitStreamLine(conn, protocol.Done{Success: true, Session: thread.ID})
 			return nil
 		}
 
@@ -185,77 +260,143 @@ func (ss *SocketServer) handleTerminalChatStream(conn net.Conn, history *[]llm.M
 			ToolCalls:        toolCalls,
 		})
 
+		limits.toolCalls += len(toolCalls)
 		fatalBrowser := false
-		for _, tc := range toolCalls {
-			name := tc.Function.Name
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "tool_start", "id": tc.ID, "name": name})
-			var out string
-			var terr error
-			if fatalBrowser && mcp.IsBrowserTool(name) {
-				out = "[browser error] skipped: browser crashed (see previous error)"
-			} else {
-				out, terr = ss.runTerminalTool(ctx, conn, tc)
+		for i := 0; i < len(toolCalls); {
+			if ctx.Err() != nil {
+				ss.finishCancelledTurn(conn, thread, "", toolCalls[i:])
+				return nil
 			}
-			if terr != nil {
-				if out != "" {
-					out = out + "\n[error] " + terr.Error()
-				} else {
-					out = "[error] " + terr.Error()
+			// 连续的只读调用并发执行（结果按原顺序写入 history）；其余逐个执行
+			n := readOnlyPrefix(mgr, toolCalls[i:])
+			var runs []toolRun
+			if n > 1 {
+				runs = ss.runToolsParallel(conn, toolCalls[i:i+n], &fatalBrowser, loops, func(tc llm.ToolCall, skip bool) toolRun {
+					return ss.execTool(ctx, conn, tc, skip)
+				})
+			} else {
+				n = 1
+				tc := toolCalls[i]
+				_ = ss.emitStreamLine(conn, protocol.ToolStart{ID: tc.ID, Name: tc.Function.Name, Display: toolDisplay(tc.Function.Name, false, false)})
+				r := ss.execTool(ctx, conn, tc, fatalBrowser)
+				if isFatalBrowserError(r.err, r.out) {
+					fatalBrowser = true
 				}
+				loops.annotate(tc, &r)
+				_ = ss.emitStreamLine(conn, protocol.ToolResult{ID: tc.ID, Name: tc.Function.Name, Output: r.out, Display: toolDisplay(tc.Function.Name, true, r.err != nil)})
+				runs = []toolRun{r}
+			}
+			for k, r := range runs {
+				tc := toolCalls[i+k]
+				*history = append(*history, llm.Message{
+					Role:       "tool",
+					ToolCallID: tc.ID,
+					Name:       tc.Function.Name,
+					Content:    r.out,
+				})
+			}
+			i += n
+			if ctx.Err() != nil {
+				ss.finishCancelledTurn(conn, thread, "", toolCalls[i:])
+				return nil
 			}
+		}
+		thread.save(sess.Workspace)
 
-			if !fatalBrowser && isFatalBrowserError(terr, out) {
-				fatalBrowser = true
+		// 连续重复调用 / 相同错误到阈值：暂停询问用户（本批 tool 结果已齐，history 可直接续聊）
+		if desc := loops.takePause(); desc != "" {
+			cont, err := ss.confirmLoopContinue(ctx, conn, desc)
+			if ctx.Err() != nil {
+				ss.finishCancelledTurn(conn, thread, "", nil)
+				return nil
+			}
+			if err != nil || !cont {
+				ss.finishLimitedTurn(ctx, conn, client, thread, sess, text, tools, round, protocol.LimitLoop, desc)
+				return nil
 			}
-			_ = ss.emitStreamLine(conn, map[string]interface{}{"type": "tool_result", "id": tc.ID, "name": name, "output": out})
-			*history = append(*history, llm.Message{
-				Role:       "tool",
-				ToolCallID: tc.ID,
-				Name:       name,
-				Content:    out,
-			})
 		}
 	}
 }
 
+// finishCancelledTurn 结束被 chat_cancel 中止的回合：partial 为已流出的回复正文（LLM 流中取消时），
+// pending 为尚未执行的 tool_calls，各补一条合成 tool 结果，使 history 仍可直接续聊。
+func (ss *SocketServer) finishCancelledTurn(conn net.Conn, thread *chatThread, partial string, pending []llm.ToolCall) {
+	history := &thread.History
+	if len(pending) == 0 {
+		*history = append(*history, llm.Message{
+			Role:    "assistant",
+			Content: strings.TrimSpace(partial + "\n\n" + cancelledByUser),
+		})
+	}
+	for _, tc := range pending {
+		*history = append(*history, llm.Message{
+			Role:       "tool",
+			ToolCallID: tc.ID,
+			Name:       tc.Function.Name,
+			Content:    cancelledByUser,
+		})
+	}
+	_ = ss.emitStreamLine(conn, protocol.Done{Success: false, Cancelled: true, Session: thread.ID})
+}
+
 // maybeContextCompress 当估算输入 token ≥ context_window×ratio（默认 85%）时，触发自主演进压缩并裁短 socket history。
 // history 指本连接内存中的多轮 user/assistant/tool，不是 short-term 文件；short-term 由 AppendChatTurn 写入磁盘供 evolve 提炼。
-func (ss *SocketServer) maybeContextCompress(conn net.Conn, client *llm.Client, history *[]llm.Message, tools []llm.Tool) {
-	if config.Config == nil || !config.Config.Evolution.Enabled {
+func (ss *SocketServer) maybeContextCompress(ctx context.Context, conn net.Conn, client *llm.Client, history *[]llm.Message, tools []llm.Tool) {
+	cfg := config.Current()
+	if cfg == nil || !cfg.Evolution.Enabled {
 		return
 	}
 	window := client.ContextWindowTokens()
 	threshold := llm.ContextCompressThreshold(window)
-	est := client.EstimatedChatInputTokens(*history, tools)
+	est := client.EstimatedChatInputTokens(ctx, *history, tools)
 	if est < threshold {
 		return
 	}
-	_ = ss.emitStreamLine(conn, map[string]interface{}{
-		"type":    "progress",
-		"message": fmt.Sprintf("context ~%d/%d tokens (≥%.0f%%), consolidating memory...", est, window, llm.ContextCompressRatioValue()*100),
+	_ = ss.emitStreamLine(conn, protocol.Progress{
+		Message: fmt.Sprintf("context ~%d/%d tokens (≥%.0f%%), consolidating memory...", est, window, llm.ContextCompressRatioValue()*100),
 	})
-	if err := evolve.RunSessionCompress(context.Background()); err != nil {
+	if err := evolve.RunSessionCompress(ctx); err != nil {
 		log.Printf("session compress: %v", err)
 		return
 	}
 	budget := int(float64(window) * historyBudgetAfterCompressRatio)
-	*history = trimHistoryToTokenBudget(client, *history, tools, budget)
+	*history = trimHistoryToTokenBudget(ctx, client, *history, tools, budget)
 }
 
-func (ss *SocketServer) buildTerminalChatTools() []llm.Tool {
+func (ss *SocketServer) buildTerminalChatTools(sess *brain.Session, mgr *mcp.Manager) []llm.Tool {
 	_ = config.InitBrainPath()
 
 	var out []llm.Tool
-	if config.Config != nil && config.Config.WorkspaceFilesEnabled() {
-		readParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Relative path under output cwd (brain.base_dir)"},"offset":{"type":"integer","description":"1-based start line (optional)"},"limit":{"type":"integer","description":"Max lines from offset (optional)"}},"required":["path"]}`)
+	if cfg := config.Current(); cfg != nil && cfg.WorkspaceFilesEnabled() {
+		readParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Relative path under primary output dir, or absolute path inside any output dir"},"offset":{"type":"integer","description":"1-based start line (optional)"},"limit":{"type":"integer","description":"Max lines from offset (optional)"}},"required":["path"]}`)
 		replaceParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"old_string":{"type":"string"},"new_string":{"type":"string"},"replace_all":{"type":"boolean"}},"required":["path","old_string","new_string"]}`)
 		appendParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"content":{"type":"string"}},"required":["path","content"]}`)
+		listParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Directory (default: primary output dir)"},"depth":{"type":"integer","description":"Levels to descend (default 1 = direct children)"},"offset":{"type":"integer","description":"0-based entry offset for paging"},"limit":{"type":"integer","description":"Max entries (default 200, max 1000)"},"all":{"type":"boolean","description":"Include .gitignored files, .git and node_modules"}}}`)
+		globParams := json.RawMessage(`{"type":"object","properties":{"pattern":{"type":"string","description":"Slash-separated glob relative to path, e.g. **/*.go or src/*.ts; ** spans directories"},"path":{"type":"string","description":"Base directory (default: primary output dir)"},"offset":{"type":"integer"},"limit":{"type":"integer","description":"Max entries (default 200, max 1000)"},"all":{"type":"boolean","description":"Include .gitignored files, .git and node_modules"}},"required":["pattern"]}`)
+		searchParams := json.RawMessage(`{"type":"object","properties":{"pattern":{"type":"string","description":"Go regexp (RE2) matched per line"},"literal":{"type":"boolean","description":"Treat pattern as plain text"},"case_insensitive":{"type":"boolean"},"path":{"type":"string","description":"Directory or single file to search (default: primary output dir)"},"include":{"type":"array","items":{"type":"string"},"description":"Only files matching these globs (no / = file name, e.g. *.go; with / = relative path, e.g. src/**/*.ts)"},"exclude":{"type":"array","items":{"type":"string"},"description":"Skip files matching these globs"},"context":{"type":"integer","description":"Lines of context around each match (max 10)"},"max_matches":{"type":"integer","description":"Stop after this many matching lines (default 100, max 500)"},"all":{"type":"boolean","description":"Include .gitignored files, .git and node_modules"}},"required":["pattern"]}`)
+		patchParams := json.RawMessage(`{"type":"object","properties":{"patch":{"type":"string","description":"Unified diff (---/+++ headers, @@ hunks; /dev/null to create or delete; git rename headers) or a patch envelope: *** Begin Patch / *** Add File: p / *** Update File: p [*** Move to: q] / *** Delete File: p / *** End Patch, hunks introduced by @@ [anchor line]"}},"required":["patch"]}`)
+		writeParams := json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"content":{"type":"string","description":"Complete new file content"},"overwrite":{"type":"boolean","description":"Replace an existing file you have not read this session"}},"required":["path","content"]}`)
 		out = append(out,
 			llm.Tool{Type: "function", Function: llm.ToolFunction{
 				Name:        "read_file",
-				Description: "Read a text file in the output workspace (relative path). Use before editing.",
+				Description: "Read a text file in the output dirs (relative to primary, or absolute inside any --dir). Use before editing.",
 				Parameters:  readParams,
 			}},
+			llm.Tool{Type: "function", Function: llm.ToolFunction{
+				Name:        "list_dir",
+				Description: "List a directory in the output dirs with type (f/d/l), size and mtime. Honors .gitignore and skips .git/node_modules unless all:true; paged by offset/limit.",
+				Parameters:  listParams,
+			}},
+			llm.Tool{Type: "function", Function: llm.ToolFunction{
+				Name:        "glob",
+				Description: "Find files in the output dirs by glob pattern (** matches across directories). Same filtering and paging as list_dir.",
+				Parameters:  globParams,
+			}},
+			llm.Tool{Type: "function", Function: llm.ToolFunction{
+				Name:        "search_files",
+				Description: "Search file contents in the output dirs by regex or literal text; results grouped per file with line numbers and optional context. Honors .gitignore, skips binary files. Prefer this over run_command grep/rg.",
+				Parameters:  searchParams,
+			}},
 			llm.Tool{Type: "function", Function: llm.ToolFunction{
 				Name:        "search_replace",
 				Description: "Replace old_string with new_string in a file under output cwd (first match unless replace_all).",
@@ -266,18 +407,26 @@ func (ss *SocketServer) buildTerminalChatTools() []llm.Tool {
 				Description: "Append text to a file under output cwd (creates file if missing).",
 				Parameters:  appendParams,
 			}},
+			llm.Tool{Type: "function", Function: llm.ToolFunction{
+				Name:        "apply_patch",
+				Description: "Apply a multi-hunk, multi-file patch in one call: edit, create, rename and delete files. Context is matched fuzzily (line offsets, whitespace); all-or-nothing, and rejected hunks are reported with reasons so you can resend a corrected patch. Prefer this over repeated search_replace when a change touches several places.",
+				Parameters:  patchParams,
+			}},
+			llm.Tool{Type: "function", Function: llm.ToolFunction{
+				Name:        "write_file",
+				Description: "Create or overwrite a whole file in one call (parent dirs created, atomic replace). Overwriting an existing file requires reading it first this session or overwrite:true. Prefer search_replace for small edits.",
+				Parameters:  writeParams,
+			}},
 		)
 	}
-	if mgr := mcp.Global(); mgr != nil {
-		out = append(out, mgr.Tools()...)
-	}
-	if config.Config != nil && config.Config.Exec.Enabled {
-		runCmdParams := json.RawMessage(`{"type":"object","properties":{"argv":{"type":"array","items":{"type":"string"},"minItems":1,"description":"argv[0]=program on PATH; no shell."}},"required":["argv"]}`)
+	out = append(out, mgr.Tools()...)
+	if cfg := config.Current(); cfg != nil && cfg.Exec.Enabled {
+		runCmdParams := json.RawMessage(`{"type":"object","properties":{"argv":{"type":"array","items":{"type":"string"},"minItems":1,"description":"argv[0]=program on PATH; no shell."},"cwd":{"type":"string","description":"Optional working dir: relative to primary output dir, or absolute inside any output dir (default: primary)"}},"required":["argv"]}`)
 		out = append(out, llm.Tool{
 			Type: "function",
 			Function: llm.ToolFunction{
 				Name:        "run_command",
-				Description: brain.RunCommandToolDescription(),
+				Description: sess.RunCommandToolDescription(),
 				Parameters:  runCmdParams,
 			},
 		})
@@ -303,7 +452,8 @@ func (ss *SocketServer) buildTerminalChatTools() []llm.Tool {
 	return out
 }
 
-func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc llm.ToolCall) (string, error) {
+func (ss *SocketServer) runTerminalTool(ctx context.Context, conn *chatConn, tc llm.ToolCall) (string, error) {
+	sess := brain.SessionFrom(ctx)
 	fn := tc.Function
 	name := fn.Name
 	argsJSON := llm.NormalizeToolArguments(name, strings.TrimSpace(fn.Arguments))
@@ -311,16 +461,15 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 		argsJSON = "{}"
 	}
 
-	if mgr := mcp.Global(); mgr != nil {
-		if out, err, ok := mgr.TryCall(ctx, name, argsJSON); ok {
-			return out, err
-		}
+	if out, err, ok := mcp.ManagerFrom(ctx).TryCall(ctx, name, argsJSON); ok {
+		return out, err
 	}
 
 	switch name {
 	case "run_command":
 		var p struct {
 			Argv []string `json:"argv"`
+			Cwd  string   `json:"cwd"`
 		}
 		if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
 			return "", fmt.Errorf("run_command args: %w", err)
@@ -328,39 +477,48 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 		if len(p.Argv) == 0 {
 			return "", fmt.Errorf("run_command: argv required")
 		}
-		if config.Config == nil {
+		cfg := config.Current()
+		if cfg == nil {
 			return "", fmt.Errorf("config not loaded")
 		}
 		if err := config.CheckExecArgv(p.Argv); err != nil {
 			return "", err
 		}
-		ec := &config.Config.Exec
-		wd, err := resolveExecCwd()
+		ec := &cfg.Exec
+		var wd string
+		var err error
+		if strings.TrimSpace(p.Cwd) != "" {
+			wd, err = resolveOutputDir(sess, p.Cwd)
+		} else {
+			wd, err = resolveExecCwd(sess)
+		}
 		if err != nil {
 			return "", err
 		}
 		cmdLine := execcmd.FormatLine(p.Argv)
+		if rec := audit.From(ctx); rec != nil {
+			rec.Cwd, rec.Approval = wd, "auto"
+		}
 		if config.ExecNeedsConfirm(p.Argv) {
 			id := newExecConfirmID()
-			_ = ss.emitStreamLine(conn, map[string]interface{}{
-				"type":         "exec_confirm_required",
-				"confirm_id":   id,
-				"argv":         p.Argv,
-				"command_line": cmdLine,
-				"cwd":          wd,
-				"options": []map[string]string{
-					{"id": "run", "label": "Run"},
-					{"id": "cancel", "label": "Cancel"},
+			_ = ss.emitStreamLine(conn, protocol.ExecConfirmRequired{
+				ConfirmID:   id,
+				Argv:        p.Argv,
+				CommandLine: cmdLine,
+				Cwd:         wd,
+				Options: []protocol.ChoiceOption{
+					{ID: "run", Label: "Run"},
+					{ID: "cancel", Label: "Cancel"},
 				},
 			})
-			approved, err := ss.waitExecClientConfirm(conn, id)
+			approved, err := ss.waitExecClientConfirm(ctx, conn, id)
 			if err != nil {
 				return "", err
 			}
+			auditApproval(ctx, approved)
 			if !approved {
-				_ = ss.emitStreamLine(conn, map[string]interface{}{
-					"type": "exec_denied", "confirm_id": id,
-					"command_line": cmdLine, "cwd": wd,
+				_ = ss.emitStreamLine(conn, protocol.ExecDenied{
+					ConfirmID: id, CommandLine: cmdLine, Cwd: wd,
 				})
 				return "[run_command] cancelled by user", nil
 			}
@@ -375,11 +533,20 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 
 		cmd := exec.CommandContext(xctx, p.Argv[0], p.Argv[1:]...)
 		cmd.Dir = wd
+		// 取消/超时杀掉进程后，不再等仍持有输出管道的子进程
+		cmd.WaitDelay = 2 * time.Second
 
 		var stdOut, stdErr bytes.Buffer
 		cmd.Stdout = &stdOut
 		cmd.Stderr = &stdErr
+		// 客户端边跑边看输出；模型仍只拿结束后的完整（截断）结果
+		stream := newOutputStreamer(ss, conn, tc.ID)
+		if stream != nil {
+			cmd.Stdout = io.MultiWriter(&stdOut, stream.writer("stdout"))
+			cmd.Stderr = io.MultiWriter(&stdErr, stream.writer("stderr"))
+		}
 		runErr := cmd.Run()
+		stream.finish()
 
 		maxB := ec.MaxOutputBytes
 		if maxB <= 0 {
@@ -410,15 +577,17 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 		}
 
 		result := formatCommandResult(wd, cmdLine, exitCode, timedOut, truncated, stdoutStr, stderrStr)
+		if rec := audit.From(ctx); rec != nil {
+			rec.ExitCode = &exitCode
+		}
 
-		_ = ss.emitStreamLine(conn, map[string]interface{}{
-			"type":         "exec_done",
-			"argv":         p.Argv,
-			"command_line": cmdLine,
-			"cwd":          wd,
-			"exit_code":    exitCode,
-			"timed_out":    timedOut,
-			"truncated":    truncated,
+		_ = ss.emitStreamLine(conn, protocol.ExecDone{
+			Argv:        p.Argv,
+			CommandLine: cmdLine,
+			Cwd:         wd,
+			ExitCode:    exitCode,
+			TimedOut:    timedOut,
+			Truncated:   truncated,
 		})
 
 		if runErr != nil && !timedOut && exitCode < 0 {
@@ -429,11 +598,39 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 		return result, nil
 
 	case "read_file":
-		return toolReadFile(argsJSON)
-	case "search_replace":
-		return toolSearchReplace(argsJSON)
-	case "append_file":
-		return toolAppendFile(argsJSON)
+		return toolReadFile(sess, fileReadsFrom(ctx), argsJSON)
+	case "list_dir":
+		return toolListDir(sess, argsJSON)
+	case "glob":
+		return toolGlob(sess, argsJSON)
+	case "search_files":
+		return toolSearchFiles(sess, argsJSON)
+	case "search_replace", "append_file", "write_file":
+		var out string
+		var ch *fileChange
+		var err error
+		confirm := ss.editConfirmer(ctx, conn, sess, name)
+		switch name {
+		case "append_file":
+			out, ch, err = toolAppendFile(sess, checkpointFrom(ctx), confirm, argsJSON)
+		case "write_file":
+			out, ch, err = toolWriteFile(sess, fileReadsFrom(ctx), checkpointFrom(ctx), confirm, argsJSON)
+		default:
+			out, ch, err = toolSearchReplace(sess, checkpointFrom(ctx), confirm, argsJSON)
+		}
+		if ch != nil {
+			ss.emitFileChange(conn, tc.ID, ch)
+			auditFileChange(ctx, ch)
+		}
+		return out, err
+
+	case "apply_patch":
+		out, changes, err := toolApplyPatch(sess, fileReadsFrom(ctx), checkpointFrom(ctx), ss.editConfirmer(ctx, conn, sess, name), argsJSON)
+		for _, ch := range changes {
+			ss.emitFileChange(conn, tc.ID, ch)
+			auditFileChange(ctx, ch)
+		}
+		return out, err
 
 	case "run_skill":
 		var p brain.RunSkillArgs
@@ -444,13 +641,9 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 
 	case "ask_user":
 		var p struct {
-			Prompt  string `json:"prompt"`
-			Options []struct {
-				ID    string `json:"id"`
-				Label string `json:"label"`
-				Desc  string `json:"desc"`
-			} `json:"options"`
-			Multi bool `json:"multi"`
+			Prompt  string                  `json:"prompt"`
+			Options []protocol.ChoiceOption `json:"options"`
+			Multi   bool                    `json:"multi"`
 		}
 		if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
 			return "", fmt.Errorf("ask_user args: %w", err)
@@ -459,15 +652,13 @@ func (ss *SocketServer) runTerminalTool(ctx context.Context, conn net.Conn, tc l
 			return "", fmt.Errorf("ask_user: at least 2 options required")
 		}
 		choiceID := newExecConfirmID()
-		_ = ss.emitStreamLine(conn, map[string]interface{}{
-			"type":    "user_choice",
-			"id":      choiceID,
-			"prompt":  p.Prompt,
-			"detail":  "",
-			"multi":   p.Multi,
-			"options": p.Options,
+		_ = ss.emitStreamLine(conn, protocol.UserChoice{
+			ID:      choiceID,
+			Prompt:  p.Prompt,
+			Multi:   p.Multi,
+			Options: p.Options,
 		})
-		selected, err := ss.waitUserChoice(conn, choiceID)
+		selected, err := ss.waitUserChoice(ctx, conn, choiceID)
 		if err != nil {
 			return "", err
 		}
@@ -606,40 +797,13 @@ func safePathUnder(base, rel string) (string, error) {
 	return fullAbs, nil
 }
 
-// waitExecClientConfirm 在流式 chat 同连接上阻塞，直到客户端发送 command=exec_confirm。
-func (ss *SocketServer) waitExecClientConfirm(conn net.Conn, confirmID string) (bool, error) {
-	deadline := time.Now().Add(execConfirmWaitTimeout)
-	br := bufio.NewReader(conn)
-	for {
-		if time.Now().After(deadline) {
-			return false, fmt.Errorf("exec confirmation timed out")
-		}
-		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		line, err := br.ReadBytes('\n')
-		if err != nil {
-			var netErr net.Error
-			if errors.As(err, &netErr) && netErr.Timeout() {
-				continue
-			}
-			return false, fmt.Errorf("read exec_confirm: %w", err)
-		}
-		line = bytes.TrimSpace(line)
-		if len(line) == 0 {
-			continue
-		}
-		var req Request
-		if err := json.Unmarshal(line, &req); err != nil {
-			return false, fmt.Errorf("invalid exec_confirm JSON: %w", err)
-		}
-		if req.Command != "exec_confirm" {
-			return false, fmt.Errorf("expected exec_confirm while command pending, got %q", req.Command)
-		}
-		if strings.TrimSpace(req.ConfirmID) != confirmID {
-			return false, fmt.Errorf("confirm_id mismatch")
-		}
-		_ = conn.SetReadDeadline(time.Time{})
-		return req.Approved, nil
+// waitExecClientConfirm 在流式 chat 同连接上阻塞，直到客户端发送 command=exec_confirm（或回合被取消）。
+func (ss *SocketServer) waitExecClientConfirm(ctx context.Context, conn *chatConn, confirmID string) (bool, error) {
+	req, err := conn.waitReply(ctx, protocol.CmdExecConfirm, confirmID)
+	if err != nil {
+		return false, err
 	}
+	return req.Approved, nil
 }
 
 func newExecConfirmID() string {
@@ -650,12 +814,17 @@ func newExecConfirmID() string {
 	return hex.EncodeToString(b[:])
 }
 
-func resolveExecCwd() (string, error) {
-	if config.Config == nil {
+// resolveExecCwd run_command 默认目录：会话主产出区（或其下 exec.working_dir）。
+func resolveExecCwd(sess *brain.Session) (string, error) {
+	cfg := config.Current()
+	if cfg == nil {
 		return "", fmt.Errorf("config not loaded")
 	}
-	base := config.GetBrainBaseDir()
-	sub := strings.TrimSpace(config.Config.Exec.WorkingDir)
+	base := sess.OutputCwd()
+	if base == "" {
+		base = config.GetBrainBaseDir()
+	}
+	sub := strings.TrimSpace(cfg.Exec.WorkingDir)
 	if sub == "" {
 		return base, nil
 	}
@@ -673,44 +842,13 @@ func resolveExecCwd() (string, error) {
 	return d, nil
 }
 
-// waitUserChoice blocks on the same chat connection waiting for a user_choice response.
-func (ss *SocketServer) waitUserChoice(conn net.Conn, choiceID string) ([]string, error) {
-	deadline := time.Now().Add(execConfirmWaitTimeout)
-	br := bufio.NewReader(conn)
-	for {
-		if time.Now().After(deadline) {
-			return nil, fmt.Errorf("user choice timed out")
-		}
-		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		line, err := br.ReadBytes('\n')
-		if err != nil {
-			var netErr net.Error
-			if errors.As(err, &netErr) && netErr.Timeout() {
-				continue
-			}
-			return nil, fmt.Errorf("read user_choice: %w", err)
-		}
-		line = bytes.TrimSpace(line)
-		if len(line) == 0 {
-			continue
-		}
-		var req struct {
-			Command  string   `json:"command"`
-			ChoiceID string   `json:"choice_id"`
-			Selected []string `json:"selected"`
-		}
-		if err := json.Unmarshal(line, &req); err != nil {
-			return nil, fmt.Errorf("invalid user_choice JSON: %w", err)
-		}
-		if req.Command != "user_choice" {
-			return nil, fmt.Errorf("expected user_choice, got %q", req.Command)
-		}
-		if req.ChoiceID != choiceID {
-			return nil, fmt.Errorf("choice_id mismatch")
-		}
-		_ = conn.SetReadDeadline(time.Time{})
-		return req.Selected, nil
+// waitUserChoice blocks on the same chat connection waiting for a user_choice response (or turn cancel).
+func (ss *SocketServer) waitUserChoice(ctx context.Context, conn *chatConn, choiceID string) ([]string, error) {
+	req, err := conn.waitReply(ctx, protocol.CmdUserChoice, choiceID)
+	if err != nil {
+		return nil, err
 	}
+	return req.Selected, nil
 }
 
 // isFatalBrowserError returns true when the tool error or output indicates
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"cata/internal/clock"
+	"cata/internal/config"
+	"cata/internal/evolve"
+	"cata/internal/mcp"
+	"cata/internal/protocol"
+)
+
+// status 汇总 server 进程、chat 连接、MCP 与后台演进（status 命令的 Data）。
+func (ss *SocketServer) status() protocol.Status {
+	st := protocol.Status{
+		PID:        os.Getpid(),
+		StartedAt:  clock.FormatTime(ss.server.startedAt, time.RFC3339Nano),
+		Managed:    ss.server.managed,
+		Socket:     getSocketPath(),
+		Version:    protocol.Version,
+		Clients:    []protocol.ClientStatus{},
+		Workspaces: []protocol.WorkspaceStatus{},
+		MCP:        []protocol.MCPServerStatus{},
+	}
+
+	ss.mu.Lock()
+	seen := make(map[string]bool)
+	for cc, c := range ss.clients {
+		cs := protocol.ClientStatus{
+			ConnectedAt: clock.FormatTime(c.connectedAt, time.RFC3339),
+			Dirs:        c.dirs,
+			Session:     c.session,
+			InTurn:      cc.inTurn(),
+		}
+		if w := c.workspace; w != nil {
+			cs.Workspace = w.ID
+			if !seen[w.ID] {
+				seen[w.ID] = true
+				ws := protocol.WorkspaceStatus{ID: w.ID, Root: w.RootPath}
+				ws.LastEvolutionAt, ws.LastEvolutionAction = evolve.LastEvolution(w)
+				st.Workspaces = append(st.Workspaces, ws)
+			}
+		}
+		st.Clients = append(st.Clients, cs)
+	}
+	ss.mu.Unlock()
+	sort.Slice(st.Clients, func(i, j int) bool { return st.Clients[i].ConnectedAt < st.Clients[j].ConnectedAt })
+	sort.Slice(st.Workspaces, func(i, j int) bool { return st.Workspaces[i].ID < st.Workspaces[j].ID })
+
+	for name, n := range mcp.ServerTools() {
+		st.MCP = append(st.MCP, protocol.MCPServerStatus{Name: name, Tools: n})
+	}
+	sort.Slice(st.MCP, func(i, j int) bool { return st.MCP[i].Name < st.MCP[j].Name })
+
+	if e, cfg := ss.server.evolve, config.Current(); e != nil && cfg != nil && cfg.Evolution.Enabled {
+		interval, last, next := e.Schedule()
+		st.Evolution = protocol.EvolutionStatus{Enabled: !next.IsZero(), IntervalSeconds: int(interval / time.Second)}
+		if !last.IsZero() {
+			st.Evolution.LastRun = clock.FormatTime(last, time.RFC3339)
+		}
+		if !next.IsZero() {
+			st.Evolution.NextRun = clock.FormatTime(next, time.RFC3339)
+		}
+	}
+	return st
+}
@@ -0,0 +1,537 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"cata/internal/clock"
+	"cata/internal/protocol"
+	"cata/internal/tasks"
+)
+
+// maxRunningTasks 同时运行的后台 task 数，其余按提交顺序排队。
+const maxRunningTasks = 2
+
+// taskSubBuffer attach 订阅的事件缓冲；客户端跟不上时断开该 attach（task 不受影响）。
+const taskSubBuffer = 1024
+
+// taskQueue 后台 task：cata task submit 提交后在 server 内以无客户端的回合运行，事件流写 $CATA_HOME/tasks/<id>.ndjson，
+// attach 的客户端先收到已有事件再实时跟随，并可应答确认与选择。
+type taskQueue struct {
+	ss *SocketServer
+
+	mu      sync.Mutex
+	tasks   map[string]*bgTask // 排队或运行中
+	queue   []*bgTask
+	running int
+	closed  bool
+}
+
+// bgTask 内存中的一个 task。info 与 cancelRequested 由 taskQueue.mu 保护；
+// subs / pending / ended 由 hc.mu 保护（需要两把锁时先 hc.mu 后 taskQueue.mu）。
+type bgTask struct {
+	info            protocol.TaskInfo
+	f               *os.File
+	hc              *headlessConn
+	cc              *chatConn
+	cancelRequested bool
+
+	subs map[chan []byte]bool
+	// pending 等待客户端应答的请求事件行及其 id（仅 policy 为等待时）
+	pending   []byte
+	pendingID string
+	ended     bool
+}
+
+// startTasks 随 server 启动：恢复上次未运行的排队 task，上次运行中的标记为 interrupted。
+func (ss *SocketServer) startTasks() {
+	q := &taskQueue{ss: ss, tasks: make(map[string]*bgTask)}
+	ss.tasks = q
+	list, err := tasks.List()
+	if err != nil {
+		log.Printf("tasks: %v", err)
+	}
+	for _, info := range list {
+		switch info.State {
+		case protocol.TaskRunning:
+			info.State = protocol.TaskInterrupted
+			info.FinishedAt = clock.RFC3339()
+			info.Error = "server stopped while the task was running"
+			info.Waiting = ""
+			if err := tasks.Save(info); err != nil {
+				log.Printf("task %s: %v", info.ID, err)
+			}
+		case protocol.TaskQueued:
+			t, err := q.newTask(info)
+			if err != nil {
+				log.Printf("task %s: %v", info.ID, err)
+				continue
+			}
+			q.tasks[info.ID] = t
+			q.queue = append(q.queue, t)
+		}
+	}
+	if len(q.queue) > 0 {
+		log.Printf("tasks: %d queued task(s) resumed", len(q.queue))
+	}
+	q.kick()
+}
+
+// newTask 打开事件流文件（追加）并准备无客户端连接。
+func (q *taskQueue) newTask(info protocol.TaskInfo) (*bgTask, error) {
+	if err := os.MkdirAll(tasks.Dir(), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(tasks.TranscriptPath(info.ID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	p := info.Policy
+	t := &bgTask{info: info, f: f, subs: make(map[chan []byte]bool)}
+	t.hc = &headlessConn{
+		w:      f,
+		name:   "task " + info.ID,
+		policy: headlessPolicy{Approve: p.Exec == "approve", Choice: p.Choice, Extend: p.Extend, Wait: p.Waits()},
+		tee:    func(line []byte, ev protocol.Event) { q.tee(t, line, ev) },
+	}
+	t.cc = newHeadlessChatConn(t.hc)
+	return t, nil
+}
+
+// close 停止启动新 task（server 停止时；运行中的由 cancelTurns 取消）。
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+}
+
+// active 排队与运行中的 task 数。
+func (q *taskQueue) active() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// submit 校验并入队一个 task。
+func (q *taskQueue) submit(req Request) (protocol.TaskInfo, error) {
+	info := protocol.TaskInfo{ID: tasks.NewID(), Prompt: strings.TrimSpace(req.Text), Dirs: req.Dirs, State: protocol.TaskQueued, SubmittedAt: clock.RFC3339()}
+	if req.Policy != nil {
+		info.Policy = *req.Policy
+	}
+	switch {
+	case info.Prompt == "":
+		return info, fmt.Errorf("empty prompt")
+	case len(info.Dirs) == 0:
+		return info, fmt.Errorf("at least one dir required")
+	case info.Policy.Exec != "" && info.Policy.Exec != "approve" && info.Policy.Exec != "deny":
+		return info, fmt.Errorf("policy exec must be approve or deny")
+	}
+	if err := tasks.Save(info); err != nil {
+		return info, err
+	}
+	t, err := q.newTask(info)
+	if err != nil {
+		return info, err
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		t.f.Close()
+		return info, fmt.Errorf("server is stopping; the task stays queued for the next start")
+	}
+	q.tasks[info.ID] = t
+	q.queue = append(q.queue, t)
+	q.mu.Unlock()
+	log.Printf("task %s: queued", info.ID)
+	q.kick()
+	return info, nil
+}
+
+// kick 在并发上限内启动排队的 task。
+func (q *taskQueue) kick() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.running < maxRunningTasks && len(q.queue) > 0 {
+		t := q.queue[0]
+		q.queue = q.queue[1:]
+		q.running++
+		t.info.State = protocol.TaskRunning
+		t.info.StartedAt = clock.RFC3339()
+		if err := tasks.Save(t.info); err != nil {
+			log.Printf("task %s: %v", t.info.ID, err)
+		}
+		go q.run(t)
+	}
+}
+
+// run 以与 chat 相同的工具循环执行 task，结束后写回状态并通知 attach 的客户端。
+func (q *taskQueue) run(t *bgTask) {
+	ss := q.ss
+	q.mu.Lock()
+	info := t.info
+	q.mu.Unlock()
+
+	log.Printf("task %s: running", info.ID)
+	sess := requestSession(Request{Cwd: info.Dirs[0], Dirs: info.Dirs})
+	thread := &chatThread{}
+	ss.trackClient(t.cc, sess, thread)
+	err := ss.handleTerminalChatStream(t.cc, sess, thread, info.Prompt)
+	ss.untrackClient(t.cc)
+
+	t.hc.mu.Lock()
+	done, lastErr := t.hc.done, t.hc.lastErr
+	t.ended = true
+	for ch := range t.subs {
+		close(ch)
+		delete(t.subs, ch)
+	}
+	t.hc.mu.Unlock()
+	t.f.Close()
+
+	q.mu.Lock()
+	t.info.Session = thread.ID
+	t.info.FinishedAt = clock.RFC3339()
+	t.info.Waiting = ""
+	t.info.Attached = 0
+	switch {
+	case done != nil && done.Success:
+		t.info.State = protocol.TaskDone
+		t.info.Limit = done.Limit
+	case done != nil && done.Cancelled && t.cancelRequested:
+		t.info.State = protocol.TaskCancelled
+	case done != nil && done.Cancelled:
+		t.info.State = protocol.TaskInterrupted
+		t.info.Error = "server stopped while the task was running"
+	default:
+		t.info.State = protocol.TaskFailed
+		t.info.Error = lastErr
+		if err != nil {
+			t.info.Error = err.Error()
+		}
+	}
+	if serr := tasks.Save(t.info); serr != nil {
+		log.Printf("task %s: %v", t.info.ID, serr)
+	}
+	log.Printf("task %s: %s", t.info.ID, t.info.State)
+	delete(q.tasks, t.info.ID)
+	q.running--
+	q.mu.Unlock()
+
+	q.kick()
+	ss.server.ClientDisconnected()
+}
+
+// cancel 取消排队或运行中的 task。
+func (q *taskQueue) cancel(id string) (protocol.TaskInfo, error) {
+	info, err := tasks.Load(id)
+	if err != nil {
+		return info, err
+	}
+	q.mu.Lock()
+	t := q.tasks[info.ID]
+	if t == nil {
+		q.mu.Unlock()
+		return info, fmt.Errorf("task %s is already %s", info.ID, info.State)
+	}
+	if t.info.State == protocol.TaskQueued {
+		for i, x := range q.queue {
+			if x == t {
+				q.queue = append(q.queue[:i], q.queue[i+1:]...)
+				break
+			}
+		}
+		delete(q.tasks, info.ID)
+		t.info.State = protocol.TaskCancelled
+		t.info.FinishedAt = clock.RFC3339()
+		info = t.info
+		q.mu.Unlock()
+		t.f.Close()
+		return info, tasks.Save(info)
+	}
+	t.cancelRequested = true
+	info = t.info
+	q.mu.Unlock()
+	t.cc.cancelTurn()
+	return info, nil
+}
+
+// info 当前状态：内存中的优先，其余读文件。
+func (q *taskQueue) info(id string) (protocol.TaskInfo, error) {
+	info, err := tasks.Load(id)
+	if err != nil {
+		return info, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t := q.tasks[info.ID]; t != nil {
+		return t.info, nil
+	}
+	return info, nil
+}
+
+// list 全部 task（内存中的状态覆盖文件）。
+func (q *taskQueue) list() ([]protocol.TaskInfo, error) {
+	list, err := tasks.List()
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, info := range list {
+		if t := q.tasks[info.ID]; t != nil {
+			list[i] = t.info
+		}
+	}
+	return list, nil
+}
+
+// tee 由 headlessConn 在写出每个事件时调用（持 t.hc.mu）：记录待应答请求并转发给 attach 的客户端。
+func (q *taskQueue) tee(t *bgTask, line []byte, ev protocol.Event) {
+	if t.hc.policy.Wait {
+		id, waiting := replyRequest(ev)
+		t.pending, t.pendingID = nil, id
+		if id != "" {
+			t.pending = line
+		}
+		q.mu.Lock()
+		t.info.Waiting = waiting
+		q.mu.Unlock()
+	}
+	for ch := range t.subs {
+		select {
+		case ch <- line:
+		default:
+			close(ch)
+			delete(t.subs, ch)
+			q.setAttached(t, len(t.subs))
+		}
+	}
+}
+
+// replyRequest 需要客户端应答的事件返回其 id 与摘要。
+func replyRequest(ev protocol.Event) (id, summary string) {
+	switch ev := ev.(type) {
+	case *protocol.ExecConfirmRequired:
+		line := ev.CommandLine
+		if line == "" {
+			line = strings.Join(ev.Argv, " ")
+		}
+		return ev.ConfirmID, "run_command: " + line
+	case *protocol.FileConfirmRequired:
+		return ev.ConfirmID, fmt.Sprintf("%s: %s (+%d -%d)", ev.Tool, ev.Path, ev.Added, ev.Removed)
+	case *protocol.UserChoice:
+		return ev.ID, "choice: " + ev.Prompt
+	case *protocol.LimitReached:
+		if len(ev.Options) > 0 {
+			return ev.ID, "turn limit reached: " + ev.Limit
+		}
+	}
+	return "", ""
+}
+
+func (q *taskQueue) setAttached(t *bgTask, n int) {
+	q.mu.Lock()
+	t.info.Attached = n
+	q.mu.Unlock()
+}
+
+// subscribe 返回已有事件（过期的请求事件去掉，只保留仍在等待的那条）与实时订阅；task 已结束时 ch 为 nil。
+func (q *taskQueue) subscribe(t *bgTask) (ch chan []byte, backlog []byte) {
+	t.hc.mu.Lock()
+	defer t.hc.mu.Unlock()
+	data, err := os.ReadFile(tasks.TranscriptPath(t.info.ID))
+	if err != nil {
+		log.Printf("task %s: %v", t.info.ID, err)
+	}
+	backlog = replayTranscript(data)
+	backlog = append(backlog, t.pending...)
+	if t.ended {
+		return nil, backlog
+	}
+	ch = make(chan []byte, taskSubBuffer)
+	t.subs[ch] = true
+	q.setAttached(t, len(t.subs))
+	return ch, backlog
+}
+
+func (q *taskQueue) unsubscribe(t *bgTask, ch chan []byte) {
+	t.hc.mu.Lock()
+	defer t.hc.mu.Unlock()
+	if t.subs[ch] {
+		delete(t.subs, ch)
+		close(ch)
+		q.setAttached(t, len(t.subs))
+	}
+}
+
+// answer 把 attach 客户端的应答转给 task；不是当前等待的请求（已由其他客户端应答）时忽略。
+func (q *taskQueue) answer(t *bgTask, r Request) {
+	id := r.ConfirmID
+	if r.Command == protocol.CmdUserChoice {
+		id = r.ChoiceID
+	}
+	t.hc.mu.Lock()
+	defer t.hc.mu.Unlock()
+	if t.pendingID == "" || strings.TrimSpace(id) != t.pendingID {
+		log.Printf("task %s: drop stale %s reply", t.info.ID, r.Command)
+		return
+	}
+	t.pending, t.pendingID = nil, ""
+	q.mu.Lock()
+	t.info.Waiting = ""
+	q.mu.Unlock()
+	t.hc.reply(r)
+}
+
+// replayTranscript 事件流去掉需要应答的请求事件（回放时不应再次提示）。
+func replayTranscript(data []byte) []byte {
+	var out bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for sc.Scan() {
+		ev, err := protocol.Decode(sc.Bytes())
+		if err != nil {
+			continue
+		}
+		if id, _ := replyRequest(ev); id != "" {
+			continue
+		}
+		out.Write(sc.Bytes())
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// hasDone 事件流中是否已有 done。
+func hasDone(data []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for sc.Scan() {
+		if ev, err := protocol.Decode(sc.Bytes()); err == nil {
+			if _, ok := ev.(*protocol.Done); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attachTask 把 task 的事件流转给本连接直到 done；期间本连接的 exec_confirm / user_choice 转给 task，
+// chat_cancel 或断开只结束 attach（task 继续运行）。
+func (ss *SocketServer) attachTask(cc *chatConn, id string) {
+	info, err := tasks.Load(id)
+	if err != nil {
+		_ = ss.emitStreamLine(cc, protocol.Error{Message: err.Error()})
+		_ = ss.emitStreamLine(cc, protocol.Done{Success: false})
+		return
+	}
+	q := ss.tasks
+	q.mu.Lock()
+	t := q.tasks[info.ID]
+	q.mu.Unlock()
+
+	var ch chan []byte
+	var backlog []byte
+	if t != nil {
+		ch, backlog = q.subscribe(t)
+	} else {
+		data, err := os.ReadFile(tasks.TranscriptPath(info.ID))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("task %s: %v", info.ID, err)
+		}
+		backlog = replayTranscript(data)
+	}
+	if _, err := cc.Write(backlog); err != nil {
+		if ch != nil {
+			q.unsubscribe(t, ch)
+		}
+		return
+	}
+	if ch == nil {
+		// 已结束：事件流中没有 done 时（排队中取消、server 中途退出）补一条
+		if !hasDone(backlog) {
+			if info.Error != "" {
+				_ = ss.emitStreamLine(cc, protocol.Error{Message: info.Error})
+			}
+			_ = ss.emitStreamLine(cc, protocol.Done{Success: info.State == protocol.TaskDone, Cancelled: info.State == protocol.TaskCancelled, Session: info.Session})
+		}
+		return
+	}
+	defer q.unsubscribe(t, ch)
+
+	ctx, end := cc.beginTurn(ss.server.ctx)
+	defer end()
+	for {
+		select {
+		case line, ok := <-ch:
+			if !ok {
+				if !t.subEnded() {
+					_ = ss.emitStreamLine(cc, protocol.Error{Message: "detached: client too slow to follow the task"})
+					_ = ss.emitStreamLine(cc, protocol.Done{Success: false, Cancelled: true})
+				}
+				return
+			}
+			if _, err := cc.Write(line); err != nil {
+				return
+			}
+		case r, ok := <-cc.replies:
+			if !ok {
+				return
+			}
+			q.answer(t, r)
+		case <-ctx.Done():
+			_ = ss.emitStreamLine(cc, protocol.Done{Success: false, Cancelled: true})
+			return
+		}
+	}
+}
+
+// subEnded task 是否已结束（订阅因结束而关闭，done 已转发）。
+func (t *bgTask) subEnded() bool {
+	t.hc.mu.Lock()
+	defer t.hc.mu.Unlock()
+	return t.ended
+}
+
+// taskResponse task_submit / task_list / task_status / task_cancel。
+func (ss *SocketServer) taskResponse(req Request) Response {
+	q := ss.tasks
+	switch req.Command {
+	case protocol.CmdTaskSubmit:
+		info, err := q.submit(req)
+		if err != nil {
+			return Response{Success: false, Message: err.Error()}
+		}
+		return Response{Success: true, Message: "queued task " + info.ID, Data: info}
+	case protocol.CmdTaskList:
+		list, err := q.list()
+		if err != nil {
+			return Response{Success: false, Message: err.Error()}
+		}
+		if list == nil {
+			list = []protocol.TaskInfo{}
+		}
+		return Response{Success: true, Message: fmt.Sprintf("%d task(s)", len(list)), Data: list}
+	case protocol.CmdTaskStatus:
+		info, err := q.info(req.Task)
+		if err != nil {
+			return Response{Success: false, Message: err.Error()}
+		}
+		return Response{Success: true, Message: info.State, Data: info}
+	case protocol.CmdTaskCancel:
+		info, err := q.cancel(req.Task)
+		if err != nil {
+			return Response{Success: false, Message: err.Error()}
+		}
+		return Response{Success: true, Message: "cancelling task " + info.ID, Data: info}
+	}
+	return Response{Success: false, Message: fmt.Sprintf("Unknown command: %s", req.Command)}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"cata/internal/llm"
+	"cata/internal/mcp"
+	"cata/internal/protocol"
+)
+
+// maxParallelTools 同一批只读工具的并发上限。
+const maxParallelTools = 4
+
+// readOnlyTools 不修改文件、不执行命令、不等待用户的内置工具。
+var readOnlyTools = map[string]bool{
+	"read_file":    true,
+	"list_dir":     true,
+	"glob":         true,
+	"search_files": true,
+}
+
+// isReadOnlyTool 内置只读工具或 server 声明 readOnlyHint 的 MCP 工具。
+func isReadOnlyTool(mgr *mcp.Manager, name string) bool {
+	if readOnlyTools[name] {
+		return true
+	}
+	return mgr.ReadOnly(name)
+}
+
+// readOnlyPrefix calls 开头连续只读调用的个数（MCP 工具按本回合会话的 mgr 判断）。
+func readOnlyPrefix(mgr *mcp.Manager, calls []llm.ToolCall) int {
+	n := 0
+	for n < len(calls) && isReadOnlyTool(mgr, calls[n].Function.Name) {
+		n++
+	}
+	return n
+}
+
+// toolRun 一次工具调用的结果。
+type toolRun struct {
+	out string
+	err error
+}
+
+// execTool 执行一次工具调用并写审计日志，错误与取消并入输出文本；skip 为浏览器已崩溃时跳过浏览器工具。
+func (ss *SocketServer) execTool(ctx context.Context, conn *chatConn, tc llm.ToolCall, skip bool) toolRun {
+	name := tc.Function.Name
+	start := time.Now()
+	ctx, rec := startAudit(ctx, tc)
+	var out string
+	var terr error
+	if skip && mcp.IsBrowserTool(name) {
+		out = "[browser error] skipped: browser crashed (see previous error)"
+	} else {
+		out, terr = ss.runTerminalTool(ctx, conn, tc)
+	}
+	finishAudit(ctx, rec, start, out, terr)
+	if terr != nil {
+		if out != "" {
+			out = out + "\n[error] " + terr.Error()
+		} else {
+			out = "[error] " + terr.Error()
+		}
+	}
+	if ctx.Err() != nil {
+		out = strings.TrimSpace(out + "\n" + cancelledByUser)
+	}
+	return toolRun{out: out, err: terr}
+}
+
+// runToolsParallel 并发执行一批只读调用（exec 执行单个调用，通常为 execTool）：各自开始时推 tool_start、
+// 完成时经 loops 加注后推 tool_result；返回结果（已加注）与 calls 同序，供按原顺序写入 history。fatalBrowser 在批次内共享。
+func (ss *SocketServer) runToolsParallel(conn *chatConn, calls []llm.ToolCall, fatalBrowser *bool, loops *loopDetector, exec func(tc llm.ToolCall, skip bool) toolRun) []toolRun {
+	runs := make([]toolRun, len(calls))
+	var mu sync.Mutex // 保护 conn 写入、fatalBrowser 与 loops（按完成顺序计数）
+	sem := make(chan struct{}, maxParallelTools)
+	var wg sync.WaitGroup
+	for i, tc := range calls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, tc llm.ToolCall) {
+			defer func() { <-sem; wg.Done() }()
+			name := tc.Function.Name
+			mu.Lock()
+			skip := *fatalBrowser
+			_ = ss.emitStreamLine(conn, protocol.ToolStart{ID: tc.ID, Name: name, Display: toolDisplay(name, false, false)})
+			mu.Unlock()
+
+			r := exec(tc, skip)
+
+			mu.Lock()
+			if isFatalBrowserError(r.err, r.out) {
+				*fatalBrowser = true
+			}
+			loops.annotate(tc, &r)
+			_ = ss.emitStreamLine(conn, protocol.ToolResult{ID: tc.ID, Name: name, Output: r.out, Display: toolDisplay(name, true, r.err != nil)})
+			mu.Unlock()
+			runs[i] = r
+		}(i, tc)
+	}
+	wg.Wait()
+	return runs
+}
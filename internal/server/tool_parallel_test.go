@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"testing"
+
+	"cata/internal/llm"
+	"cata/internal/protocol"
+)
+
+func toolCall(id, name string) llm.ToolCall {
+	tc := llm.ToolCall{ID: id}
+	tc.Function.Name = name
+	tc.Function.Arguments = `{"path":"` + id + `"}`
+	return tc
+}
+
+func TestReadOnlyPrefix(t *testing.T) {
+	cases := []struct {
+		names []string
+		want  int
+	}{
+		{nil, 0},
+		{[]string{"read_file", "glob", "search_files", "list_dir"}, 4},
+		{[]string{"read_file", "write_file", "read_file"}, 1},
+		{[]string{"run_command", "read_file"}, 0},
+		{[]string{"read_file", "ask_user"}, 1},
+		// 没有 MCP manager 时浏览器工具不算只读
+		{[]string{"list_dir", "browser_snapshot"}, 1},
+	}
+	for _, c := range cases {
+		var calls []llm.ToolCall
+		for i, name := range c.names {
+			calls = append(calls, toolCall(string(rune('a'+i)), name))
+		}
+		if got := readOnlyPrefix(nil, calls); got != c.want {
+			t.Errorf("%v: readOnlyPrefix = %d, want %d", c.names, got, c.want)
+		}
+	}
+}
+
+func TestRunToolsParallelKeepsCallOrder(t *testing.T) {
+	finished := make(chan string, 3)
+	hc := &headlessConn{w: io.Discard, name: "test", tee: func(_ []byte, ev protocol.Event) {
+		if r, ok := ev.(*protocol.ToolResult); ok {
+			finished <- r.ID
+		}
+	}}
+	conn := newHeadlessChatConn(hc)
+	calls := []llm.ToolCall{toolCall("a", "read_file"), toolCall("b", "glob"), toolCall("c", "list_dir")}
+	release := map[string]chan struct{}{}
+	for _, tc := range calls {
+		release[tc.ID] = make(chan struct{})
+	}
+	exec := func(tc llm.ToolCall, skip bool) toolRun {
+		<-release[tc.ID]
+		return toolRun{out: "out " + tc.ID}
+	}
+
+	var fatal bool
+	ss := &SocketServer{}
+	done := make(chan []toolRun)
+	go func() { done <- ss.runToolsParallel(conn, calls, &fatal, &loopDetector{warnAt: 3, pauseAt: 5}, exec) }()
+	// 按 c、a、b 的顺序完成
+	var order []string
+	for _, id := range []string{"c", "a", "b"} {
+		close(release[id])
+		order = append(order, <-finished)
+	}
+	runs := <-done
+
+	if got := order[0] + order[1] + order[2]; got != "cab" {
+		t.Fatalf("tool_result order = %s, want completion order cab", got)
+	}
+	for i, tc := range calls {
+		if runs[i].out != "out "+tc.ID {
+			t.Fatalf("runs[%d] = %q, want the result of call %s", i, runs[i].out, tc.ID)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cata/internal/brain"
+	"cata/internal/config"
+	"cata/internal/llm"
+	"cata/internal/protocol"
+)
+
+// turnLimits 一个用户回合的额度（config turn）；延长时触发的那一项在已用量之上再给一份初始额度。
+type turnLimits struct {
+	start     time.Time
+	toolCalls int
+
+	maxRounds, maxToolCalls int
+	maxTime                 time.Duration
+}
+
+func newTurnLimits() *turnLimits {
+	l := &turnLimits{start: time.Now()}
+	if cfg := config.Current(); cfg != nil {
+		t := cfg.Turn
+		l.maxRounds, l.maxToolCalls = t.MaxRounds, t.MaxToolCalls
+		l.maxTime = time.Duration(t.MaxSeconds) * time.Second
+	}
+	return l
+}
+
+// exceeded rounds 为已完成的模型轮数；返回触发的上限（空为未触发）及其用量与额度。
+func (l *turnLimits) exceeded(rounds int) (limit string, used, max int) {
+	switch {
+	case l.maxRounds > 0 && rounds >= l.maxRounds:
+		return protocol.LimitRounds, rounds, l.maxRounds
+	case l.maxToolCalls > 0 && l.toolCalls >= l.maxToolCalls:
+		return protocol.LimitToolCalls, l.toolCalls, l.maxToolCalls
+	case l.maxTime > 0 && time.Since(l.start) >= l.maxTime:
+		return protocol.LimitTime, int(time.Since(l.start).Seconds()), int(l.maxTime.Seconds())
+	}
+	return "", 0, 0
+}
+
+// extend 延长 limit：额度 = 已用 + 一份初始额度。
+func (l *turnLimits) extend(limit string, used int) {
+	t := config.TurnConfig{}
+	if cfg := config.Current(); cfg != nil {
+		t = cfg.Turn
+	}
+	switch limit {
+	case protocol.LimitRounds:
+		l.maxRounds = used + t.MaxRounds
+	case protocol.LimitToolCalls:
+		l.maxToolCalls = used + t.MaxToolCalls
+	case protocol.LimitTime:
+		l.maxTime = time.Since(l.start) + time.Duration(t.MaxSeconds)*time.Second
+	}
+}
+
+// limitDesc 上限的可读描述（用于进度提示与总结提示词）。
+func limitDesc(limit string, used, max int) string {
+	switch limit {
+	case protocol.LimitRounds:
+		return fmt.Sprintf("%d/%d model rounds", used, max)
+	case protocol.LimitToolCalls:
+		return fmt.Sprintf("%d/%d tool calls", used, max)
+	default:
+		return fmt.Sprintf("%s/%s wall time", time.Duration(used)*time.Second, time.Duration(max)*time.Second)
+	}
+}
+
+// askExtendTurn 推送 limit_reached；客户端支持 turn_limits 时等待其选择，返回是否延长。
+func (ss *SocketServer) askExtendTurn(ctx context.Context, conn *chatConn, limit string, used, max int) (bool, error) {
+	ev := protocol.LimitReached{ID: newExecConfirmID(), Limit: limit, Used: used, Max: max}
+	if !conn.has(protocol.FeatureTurnLimits) {
+		_ = ss.emitStreamLine(conn, ev)
+		return false, nil
+	}
+	ev.Options = []protocol.ChoiceOption{
+		{ID: "extend", Label: "Continue", Desc: "keep working with another allowance"},
+		{ID: "stop", Label: "Stop", Desc: "summarize progress and end the turn"},
+	}
+	_ = ss.emitStreamLine(conn, ev)
+	selected, err := ss.waitUserChoice(ctx, conn, ev.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(selected) > 0 && selected[0] == "extend", nil
+}
+
+// limitSummaryPrompt 回合被叫停后最后一轮的提示（仅发给模型，不写入 history）。
+func limitSummaryPrompt(desc string) string {
+	return "[turn stopped: " + desc + "] Tools are disabled for this reply. " +
+		"Briefly summarize what you have done in this turn, the current state, and what remains, " +
+		"so the user can decide whether to continue."
+}
+
+// finishLimitedTurn 到达上限且不延长（或重复调用后用户选择停止）：模型不带工具做最后一轮总结，以 done(limit) 结束回合。
+func (ss *SocketServer) finishLimitedTurn(ctx context.Context, conn *chatConn, client *llm.Client, thread *chatThread, sess *brain.Session, userText string, tools []llm.Tool, round int, limit, desc string) {
+	history := &thread.History
+	_ = ss.emitStreamLine(conn, protocol.Progress{Message: "turn stopped (" + desc + "), summarizing"})
+
+	var partial strings.Builder
+	onDelta := func(s string) error {
+		if s == "" {
+			return nil
+		}
+		partial.WriteString(s)
+		return ss.emitStreamLine(conn, protocol.Token{Content: s})
+	}
+	msgs := append(append([]llm.Message(nil), *history...), llm.Message{Role: "user", Content: limitSummaryPrompt(desc)})
+	asst, _, _, _, used, err := client.ChatStreamRound(ctx, msgs, tools, "none", 0, 0, onDelta)
+	if err != nil {
+		if ctx.Err() != nil {
+			ss.finishCancelledTurn(conn, thread, partial.String(), nil)
+			return
+		}
+		log.Printf("turn limit summary: %v", err)
+		_ = ss.emitStreamLine(conn, protocol.Error{Message: "summary round failed: " + err.Error()})
+	} else {
+		ss.emitRoundUsage(conn, client, round, used)
+	}
+	if strings.TrimSpace(asst) == "" {
+		asst = fmt.Sprintf("[turn stopped: %s]", desc)
+	}
+	*history = append(*history, llm.Message{Role: "assistant", Content: asst})
+	if sess.Workspace != nil {
+		if err := brain.AppendChatTurnFor(sess.Workspace, userText, asst); err != nil {
+			log.Printf("short-term memory: %v", err)
+		}
+	}
+	_ = ss.emitStreamLine(conn, protocol.Done{Success: true, Session: thread.ID, Limit: limit})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+func TestTurnLimits(t *testing.T) {
+	config.Set(&config.AppConfig{Turn: config.TurnConfig{MaxRounds: 3, MaxToolCalls: 10, MaxSeconds: 60}})
+	cases := []struct {
+		name      string
+		rounds    int
+		toolCalls int
+		elapsed   time.Duration
+		limit     string
+		used, max int
+	}{
+		{name: "within all limits", rounds: 2, toolCalls: 9, elapsed: 59 * time.Second},
+		{name: "rounds", rounds: 3, limit: protocol.LimitRounds, used: 3, max: 3},
+		{name: "tool calls", rounds: 1, toolCalls: 12, limit: protocol.LimitToolCalls, used: 12, max: 10},
+		{name: "wall time", rounds: 1, elapsed: 61 * time.Second, limit: protocol.LimitTime, used: 61, max: 60},
+		{name: "rounds reported first", rounds: 3, toolCalls: 10, elapsed: time.Hour, limit: protocol.LimitRounds, used: 3, max: 3},
+	}
+	for _, c := range cases {
+		l := newTurnLimits()
+		l.start = time.Now().Add(-c.elapsed)
+		l.toolCalls = c.toolCalls
+		limit, used, max := l.exceeded(c.rounds)
+		if limit != c.limit || used != c.used || max != c.max {
+			t.Errorf("%s: exceeded = %q %d/%d, want %q %d/%d", c.name, limit, used, max, c.limit, c.used, c.max)
+		}
+	}
+}
+
+func TestTurnLimitsExtend(t *testing.T) {
+	config.Set(&config.AppConfig{Turn: config.TurnConfig{MaxRounds: 3, MaxToolCalls: 10, MaxSeconds: 60}})
+	l := newTurnLimits()
+	l.toolCalls = 11
+	limit, used, _ := l.exceeded(3)
+	l.extend(limit, used)
+	if limit, _, _ := l.exceeded(5); limit != protocol.LimitToolCalls {
+		t.Fatalf("after extending rounds: limit %q, want tool_calls", limit)
+	}
+	if limit, _, _ := l.exceeded(6); limit != protocol.LimitRounds {
+		t.Fatalf("extended rounds should allow 3 more, got %q at round 6", limit)
+	}
+
+	limit, used, _ = l.exceeded(5)
+	l.extend(limit, used)
+	l.toolCalls = 20
+	if limit, _, _ := l.exceeded(5); limit != "" {
+		t.Fatalf("after extending tool calls to 21: %q", limit)
+	}
+
+	l.start = time.Now().Add(-2 * time.Minute)
+	limit, used, _ = l.exceeded(5)
+	if limit != protocol.LimitTime {
+		t.Fatalf("wall time not exceeded: %q", limit)
+	}
+	l.extend(limit, used)
+	if limit, _, _ := l.exceeded(5); limit != "" {
+		t.Fatalf("after extending time: %q", limit)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"cata/internal/brain"
+	"cata/internal/llm"
+	"cata/internal/protocol"
+	"cata/internal/usage"
+)
+
+// usageResponse usage 命令：汇总当前产出区（或 All 时全部）脑子分区的用量台账；thread 为本连接会话，用于 /cost 的会话合计。
+func usageResponse(req Request, sess *brain.Session, thread *chatThread) Response {
+	var since time.Time
+	if s := strings.TrimSpace(req.Since); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return Response{Success: false, Message: fmt.Sprintf("usage: invalid since %q (want RFC3339)", s)}
+		}
+		since = t
+	}
+	wss, err := requestWorkspaces(req, sess)
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	rep, err := usage.Report(wss, since, thread.ID)
+	if err != nil {
+		return Response{Success: false, Message: err.Error()}
+	}
+	return Response{
+		Success: true,
+		Message: fmt.Sprintf("%d call(s), %d tokens", rep.Total.Calls, rep.Total.TotalTokens),
+		Data:    rep,
+	}
+}
+
+// requestWorkspaces usage / audit 的查询范围：All 时全部脑子分区，否则为请求产出区的分区。
+func requestWorkspaces(req Request, sess *brain.Session) ([]*brain.Workspace, error) {
+	if req.All {
+		return brain.ListWorkspaces()
+	}
+	if sess == nil || sess.Workspace == nil {
+		return nil, fmt.Errorf("no brain workspace for this directory")
+	}
+	return []*brain.Workspace{sess.Workspace}, nil
+}
+
+// emitRoundUsage 推送一轮模型调用的 usage 事件（有单价时带费用）。
+func (ss *SocketServer) emitRoundUsage(conn net.Conn, client *llm.Client, round int, used llm.Usage) {
+	cost, _ := usage.Cost(client.Model(), used.PromptTokens, used.CachedTokens, used.CompletionTokens)
+	_ = ss.emitStreamLine(conn, protocol.Usage{
+		Round:            round,
+		Model:            client.Model(),
+		PromptTokens:     used.PromptTokens,
+		CompletionTokens: used.CompletionTokens,
+		ReasoningTokens:  used.ReasoningTokens,
+		CachedTokens:     used.CachedTokens,
+		TotalTokens:      used.TotalTokens,
+		Estimated:        used.Estimated,
+		Cost:             cost,
+	})
+}
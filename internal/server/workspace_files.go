@@ -5,14 +5,16 @@ import (
 	"os"
 	"strings"
 
+	"cata/internal/brain"
+	"cata/internal/checkpoint"
 	"cata/internal/config"
 	"cata/internal/llm"
 )
 
 func workspaceFileLimits() (maxRead, maxWrite int) {
 	maxRead, maxWrite = 512*1024, 512*1024
-	if config.Config != nil {
-		wf := config.Config.WorkspaceFiles
+	if cfg := config.Current(); cfg != nil {
+		wf := cfg.WorkspaceFiles
 		if wf.MaxReadBytes > 0 {
 			maxRead = wf.MaxReadBytes
 		}
@@ -23,11 +25,12 @@ func workspaceFileLimits() (maxRead, maxWrite int) {
 	return maxRead, maxWrite
 }
 
-func resolveWorkspaceFile(rel string) (string, error) {
-	return safePathUnder(config.GetBrainBaseDir(), rel)
+// resolveWorkspaceFile 相对路径按主产出区解析；绝对路径须在任一 --dir 产出区内。
+func resolveWorkspaceFile(sess *brain.Session, rel string) (string, error) {
+	return resolveOutputPath(sess, rel)
 }
 
-func toolReadFile(argsJSON string) (string, error) {
+func toolReadFile(sess *brain.Session, reads *fileReads, argsJSON string) (string, error) {
 	var p struct {
 		Path   string `json:"path"`
 		Offset int    `json:"offset"`
@@ -39,7 +42,7 @@ func toolReadFile(argsJSON string) (string, error) {
 	if strings.TrimSpace(p.Path) == "" {
 		return "", fmt.Errorf("read_file: path required")
 	}
-	full, err := resolveWorkspaceFile(p.Path)
+	full, err := resolveWorkspaceFile(sess, p.Path)
 	if err != nil {
 		return "", err
 	}
@@ -47,6 +50,7 @@ func toolReadFile(argsJSON string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	reads.mark(full)
 	maxRead, _ := workspaceFileLimits()
 	text := string(data)
 	if len(data) > maxRead {
@@ -70,7 +74,7 @@ func toolReadFile(argsJSON string) (string, error) {
 	return fmt.Sprintf("read %s (%d bytes shown)\n%s", p.Path, len(text), text), nil
 }
 
-func toolSearchReplace(argsJSON string) (string, error) {
+func toolSearchReplace(sess *brain.Session, cp *checkpoint.Turn, confirm editConfirm, argsJSON string) (string, *fileChange, error) {
 	var p struct {
 		Path        string `json:"path"`
 		OldString   string `json:"old_string"`
@@ -78,21 +82,21 @@ func toolSearchReplace(argsJSON string) (string, error) {
 		ReplaceAll  bool   `json:"replace_all"`
 	}
 	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
-		return "", fmt.Errorf("search_replace args: %w", err)
+		return "", nil, fmt.Errorf("search_replace args: %w", err)
 	}
 	if strings.TrimSpace(p.Path) == "" {
-		return "", fmt.Errorf("search_replace: path required")
+		return "", nil, fmt.Errorf("search_replace: path required")
 	}
 	if p.OldString == "" {
-		return "", fmt.Errorf("search_replace: old_string required")
+		return "", nil, fmt.Errorf("search_replace: old_string required")
 	}
-	full, err := resolveWorkspaceFile(p.Path)
+	full, err := resolveWorkspaceFile(sess, p.Path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	data, err := os.ReadFile(full)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	_, maxWrite := workspaceFileLimits()
 	content := string(data)
@@ -104,58 +108,84 @@ func toolSearchReplace(argsJSON string) (string, error) {
 	} else {
 		idx := strings.Index(content, p.OldString)
 		if idx < 0 {
-			return "", fmt.Errorf("search_replace: old_string not found in %s", p.Path)
+			return "", nil, fmt.Errorf("search_replace: old_string not found in %s", p.Path)
 		}
 		newContent = content[:idx] + p.NewString + content[idx+len(p.OldString):]
 		n = 1
 	}
 	if newContent == content {
-		return "", fmt.Errorf("search_replace: old_string not found in %s", p.Path)
+		return "", nil, fmt.Errorf("search_replace: old_string not found in %s", p.Path)
 	}
 	if len(newContent) > maxWrite {
-		return "", fmt.Errorf("search_replace: result exceeds max_write_bytes (%d)", maxWrite)
+		return "", nil, fmt.Errorf("search_replace: result exceeds max_write_bytes (%d)", maxWrite)
 	}
-	if err := os.WriteFile(full, []byte(newContent), 0644); err != nil {
-		return "", err
+	ch, err := confirm.check(newFileChange(p.Path, full, content, newContent, false))
+	if err != nil {
+		return "", nil, fmt.Errorf("search_replace: %w", err)
 	}
-	return fmt.Sprintf("search_replace %s: %d replacement(s), %d -> %d bytes", p.Path, n, len(content), len(newContent)), nil
+	if err := cp.Snapshot(full); err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(full, []byte(ch.New), 0644); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("search_replace %s: %d replacement(s), %d -> %d bytes%s\n%s", p.Path, n, len(content), len(ch.New), editedNote(ch, newContent), ch.summary()), ch, nil
 }
 
-func toolAppendFile(argsJSON string) (string, error) {
+func toolAppendFile(sess *brain.Session, cp *checkpoint.Turn, confirm editConfirm, argsJSON string) (string, *fileChange, error) {
 	var p struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
 	}
 	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
-		return "", fmt.Errorf("append_file args: %w", err)
+		return "", nil, fmt.Errorf("append_file args: %w", err)
 	}
 	if strings.TrimSpace(p.Path) == "" {
-		return "", fmt.Errorf("append_file: path required")
+		return "", nil, fmt.Errorf("append_file: path required")
 	}
-	full, err := resolveWorkspaceFile(p.Path)
+	full, err := resolveWorkspaceFile(sess, p.Path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	_, maxWrite := workspaceFileLimits()
 	add := len(p.Content)
 	if add > maxWrite {
-		return "", fmt.Errorf("append_file: content exceeds max_write_bytes (%d)", maxWrite)
+		return "", nil, fmt.Errorf("append_file: content exceeds max_write_bytes (%d)", maxWrite)
+	}
+	var old string
+	created, mode := true, os.FileMode(0644)
+	if data, err := os.ReadFile(full); err == nil {
+		old, created = string(data), false
+		if len(old)+add > maxWrite {
+			return "", nil, fmt.Errorf("append_file: file would exceed max_write_bytes")
+		}
+		if st, err := os.Stat(full); err == nil {
+			mode = st.Mode().Perm()
+		}
+	}
+	ch, err := confirm.check(newFileChange(p.Path, full, old, old+p.Content, created))
+	if err != nil {
+		return "", nil, fmt.Errorf("append_file: %w", err)
 	}
-	var prev int64
-	if st, err := os.Stat(full); err == nil {
-		prev = st.Size()
-		if prev+int64(add) > int64(maxWrite) {
-			return "", fmt.Errorf("append_file: file would exceed max_write_bytes")
+	if err := cp.Snapshot(full); err != nil {
+		return "", nil, err
+	}
+	if ch.New != old+p.Content {
+		// 用户编辑过：整体写入
+		if err := writeFileAtomic(full, ch.New, mode); err != nil {
+			return "", nil, err
 		}
+		return fmt.Sprintf("append_file %s: wrote %d bytes (was %d)%s\n%s", p.Path, len(ch.New), len(old), editedNote(ch, old+p.Content), ch.summary()), ch, nil
 	}
 	f, err := os.OpenFile(full, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer f.Close()
 	n, err := f.WriteString(p.Content)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return fmt.Sprintf("append_file %s: appended %d bytes (was %d)", p.Path, n, prev), nil
+	ch = newFileChange(p.Path, full, old, old+p.Content[:n], created)
+	return fmt.Sprintf("append_file %s: appended %d bytes (was %d)\n%s", p.Path, n, len(old), ch.summary()), ch, nil
 }
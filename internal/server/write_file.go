@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cata/internal/brain"
+	"cata/internal/checkpoint"
+	"cata/internal/llm"
+)
+
+// fileReads 本会话模型读过（或用 write_file 写过）的文件，write_file 覆盖已有文件前据此检查；不落盘。
+type fileReads struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func (r *fileReads) mark(full string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paths == nil {
+		r.paths = make(map[string]bool)
+	}
+	r.paths[full] = true
+}
+
+func (r *fileReads) seen(full string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paths[full]
+}
+
+// forget 文件被外部恢复或改动后，须重新读过才能覆盖。
+func (r *fileReads) forget(full string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.paths, full)
+}
+
+type fileReadsKey struct{}
+
+// withFileReads 回合 ctx 携带会话的已读文件集（并行的 read_file 可同时标记）。
+func withFileReads(ctx context.Context, r *fileReads) context.Context {
+	return context.WithValue(ctx, fileReadsKey{}, r)
+}
+
+func fileReadsFrom(ctx context.Context) *fileReads {
+	r, _ := ctx.Value(fileReadsKey{}).(*fileReads)
+	return r
+}
+
+// toolWriteFile 一次写入整个文件：经同目录临时文件 + rename 原子替换，自动创建父目录。
+// 覆盖已有文件须本会话 read_file 过，或显式 overwrite:true。
+func toolWriteFile(sess *brain.Session, reads *fileReads, cp *checkpoint.Turn, confirm editConfirm, argsJSON string) (string, *fileChange, error) {
+	var p struct {
+		Path      string `json:"path"`
+		Content   string `json:"content"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if err := llm.ParseToolArguments(argsJSON, &p); err != nil {
+		return "", nil, fmt.Errorf("write_file args: %w", err)
+	}
+	if strings.TrimSpace(p.Path) == "" {
+		return "", nil, fmt.Errorf("write_file: path required")
+	}
+	full, err := resolveWorkspaceFile(sess, p.Path)
+	if err != nil {
+		return "", nil, err
+	}
+	_, maxWrite := workspaceFileLimits()
+	if len(p.Content) > maxWrite {
+		return "", nil, fmt.Errorf("write_file: content exceeds max_write_bytes (%d)", maxWrite)
+	}
+
+	var old string
+	created, mode := true, os.FileMode(0644)
+	if st, err := os.Stat(full); err == nil {
+		if st.IsDir() {
+			return "", nil, fmt.Errorf("write_file: %s is a directory", p.Path)
+		}
+		if !p.Overwrite && !reads.seen(full) {
+			return "", nil, fmt.Errorf("write_file: %s already exists and has not been read in this session; read_file it first, or pass overwrite:true to replace it", p.Path)
+		}
+		data, err := os.ReadFile(full)
+		if err != nil {
+			return "", nil, err
+		}
+		old, created, mode = string(data), false, st.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return "", nil, err
+	}
+
+	ch, err := confirm.check(newFileChange(p.Path, full, old, p.Content, created))
+	if err != nil {
+		return "", nil, fmt.Errorf("write_file: %w", err)
+	}
+	if err := cp.Snapshot(full); err != nil {
+		return "", nil, err
+	}
+	if err := writeFileAtomic(full, ch.New, mode); err != nil {
+		return "", nil, err
+	}
+	reads.mark(full)
+
+	verb := fmt.Sprintf("overwrote %d bytes (was %d)", len(ch.New), len(old))
+	if created {
+		verb = fmt.Sprintf("created %d bytes", len(ch.New))
+	}
+	return fmt.Sprintf("write_file %s: %s%s\n%s", p.Path, verb, editedNote(ch, p.Content), ch.summary()), ch, nil
+}
+
+// writeFileAtomic 经同目录临时文件 + rename 替换 full（自动创建父目录），读者看不到写了一半的文件。
+func writeFileAtomic(full, content string, mode os.FileMode) error {
+	dir := filepath.Dir(full)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(full)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), full)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
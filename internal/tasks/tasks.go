@@ -0,0 +1,124 @@
+// Package tasks 后台 task 的文件存储：$CATA_HOME/tasks/<id>.json 为 task 状态（protocol.TaskInfo），
+// <id>.ndjson 为回合事件流。队列与执行在 server 内（见 internal/server/tasks.go），由 cata task 提交与查看。
+package tasks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// Dir task 状态目录。
+func Dir() string {
+	return filepath.Join(config.CataHome(), "tasks")
+}
+
+func infoPath(id string) string { return filepath.Join(Dir(), id+".json") }
+
+// TranscriptPath task 的事件流文件。
+func TranscriptPath(id string) string {
+	return filepath.Join(Dir(), id+".ndjson")
+}
+
+// NewID 生成 task id。
+func NewID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("t%d", time.Now().UnixNano()%1e8)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Save 原子写回 task 状态。
+func Save(t protocol.TaskInfo) error {
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := infoPath(t.ID) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, infoPath(t.ID))
+}
+
+// Load 读取一个 task；id 可为唯一前缀。
+func Load(id string) (protocol.TaskInfo, error) {
+	var t protocol.TaskInfo
+	data, err := os.ReadFile(infoPath(id))
+	if os.IsNotExist(err) {
+		all, lerr := List()
+		if lerr != nil {
+			return t, lerr
+		}
+		var found []protocol.TaskInfo
+		for _, x := range all {
+			if id != "" && strings.HasPrefix(x.ID, id) {
+				found = append(found, x)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return t, fmt.Errorf("no task %q", id)
+		case 1:
+			return found[0], nil
+		}
+		return t, fmt.Errorf("task id %q is ambiguous (%d matches)", id, len(found))
+	}
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("%s: %w", infoPath(id), err)
+	}
+	return t, nil
+}
+
+// List 全部 task，按提交时间排序（坏文件跳过）。
+func List() ([]protocol.TaskInfo, error) {
+	entries, err := os.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []protocol.TaskInfo
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(Dir(), e.Name()))
+		if err != nil {
+			continue
+		}
+		var t protocol.TaskInfo
+		if json.Unmarshal(data, &t) != nil || t.ID == "" {
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].SubmittedAt < out[j].SubmittedAt })
+	return out, nil
+}
+
+// Finished state 是否为终态。
+func Finished(state string) bool {
+	switch state {
+	case protocol.TaskDone, protocol.TaskFailed, protocol.TaskCancelled, protocol.TaskInterrupted:
+		return true
+	}
+	return false
+}
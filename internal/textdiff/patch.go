@@ -0,0 +1,531 @@
+package textdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxFuzz 匹配不上时最多从 hunk 两端各去掉的上下文行数（同 GNU patch 的 fuzz）。
+const maxFuzz = 2
+
+// Hunk 补丁里的一个变更块；Lines 的 Line 不含换行。
+type Hunk struct {
+	// Hint 旧文件中预期的起始位置（0 起）；-1 表示未知（补丁信封格式）
+	Hint int
+	// Anchor 信封格式 "@@ xxx" 的定位行：先找到该行，再在其后匹配
+	Anchor string
+	Lines  []Op
+	// EOF 须匹配在文件末尾（信封的 *** End of File）
+	EOF bool
+	// NoNewline 新侧末行无换行（\ No newline at end of file）
+	NoNewline bool
+}
+
+// FilePatch 一个文件的变更：新建时 OldPath 为空，删除时 NewPath 为空，改名时两者不同。
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// ParsePatch 解析 unified diff（含 git diff 的 new / deleted file、rename 头）或补丁信封
+// （*** Begin Patch / *** Add File: / *** Update File: / *** Move to: / *** Delete File: / *** End Patch）。
+// hunk 的行数不可靠（模型常数错），按行首字符读取，不依赖 @@ 里的计数。
+func ParsePatch(text string) ([]FilePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	// 去掉 markdown 代码围栏
+	for len(lines) > 0 && (strings.TrimSpace(lines[0]) == "" || strings.HasPrefix(lines[0], "```")) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && (strings.TrimSpace(lines[len(lines)-1]) == "" || strings.HasPrefix(lines[len(lines)-1], "```")) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty patch")
+	}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "*** Begin Patch") || strings.HasPrefix(l, "*** Update File:") ||
+			strings.HasPrefix(l, "*** Add File:") || strings.HasPrefix(l, "*** Delete File:") {
+			return parseEnvelope(lines)
+		}
+	}
+	return parseUnified(lines)
+}
+
+func parseEnvelope(lines []string) ([]FilePatch, error) {
+	var out []FilePatch
+	var fp *FilePatch
+	var h *Hunk
+	adding := false
+	flush := func() {
+		if fp != nil {
+			if h != nil && len(h.Lines) > 0 {
+				fp.Hunks = append(fp.Hunks, *h)
+			}
+			out = append(out, *fp)
+		}
+		fp, h, adding = nil, nil, false
+	}
+	for i, l := range lines {
+		n := i + 1
+		switch {
+		case strings.HasPrefix(l, "*** Begin Patch"):
+		case strings.HasPrefix(l, "*** End Patch"):
+			flush()
+		case strings.HasPrefix(l, "*** Add File:"):
+			flush()
+			fp = &FilePatch{NewPath: strings.TrimSpace(strings.TrimPrefix(l, "*** Add File:"))}
+			h, adding = &Hunk{Hint: 0}, true
+		case strings.HasPrefix(l, "*** Delete File:"):
+			flush()
+			fp = &FilePatch{OldPath: strings.TrimSpace(strings.TrimPrefix(l, "*** Delete File:"))}
+		case strings.HasPrefix(l, "*** Update File:"):
+			flush()
+			p := strings.TrimSpace(strings.TrimPrefix(l, "*** Update File:"))
+			fp = &FilePatch{OldPath: p, NewPath: p}
+		case strings.HasPrefix(l, "*** Move to:"):
+			if fp == nil || fp.OldPath == "" || fp.NewPath == "" {
+				return nil, fmt.Errorf("line %d: *** Move to: must follow *** Update File:", n)
+			}
+			fp.NewPath = strings.TrimSpace(strings.TrimPrefix(l, "*** Move to:"))
+		case strings.HasPrefix(l, "*** End of File"):
+			if h == nil {
+				return nil, fmt.Errorf("line %d: *** End of File outside a hunk", n)
+			}
+			h.EOF = true
+		case fp == nil:
+			if strings.TrimSpace(l) != "" {
+				return nil, fmt.Errorf("line %d: expected *** Add/Update/Delete File:, got %q", n, l)
+			}
+		case adding:
+			if !strings.HasPrefix(l, "+") {
+				return nil, fmt.Errorf("line %d: *** Add File: lines must start with +", n)
+			}
+			h.Lines = append(h.Lines, Op{Kind: Insert, Line: l[1:]})
+		case fp.NewPath == "":
+			if strings.TrimSpace(l) != "" {
+				return nil, fmt.Errorf("line %d: unexpected content after *** Delete File:", n)
+			}
+		case strings.HasPrefix(l, "@@"):
+			if h != nil && len(h.Lines) > 0 {
+				fp.Hunks = append(fp.Hunks, *h)
+			}
+			h = &Hunk{Hint: -1, Anchor: strings.TrimSpace(strings.TrimPrefix(l, "@@"))}
+		default:
+			op, ok := hunkLine(l)
+			if !ok {
+				return nil, fmt.Errorf("line %d: hunk lines must start with ' ', '+' or '-', got %q", n, l)
+			}
+			if h == nil {
+				h = &Hunk{Hint: -1}
+			}
+			h.Lines = append(h.Lines, op)
+		}
+	}
+	flush()
+	if len(out) == 0 {
+		return nil, fmt.Errorf("patch has no file sections")
+	}
+	return out, nil
+}
+
+func parseUnified(lines []string) ([]FilePatch, error) {
+	var out []FilePatch
+	var fp *FilePatch
+	// git 头（diff --git）已开启本文件时，其后路径一致的 ---/+++ 不再新开文件；
+	// 只改名的 git 段没有 ---/+++，gitPaths 为头部解析出的路径是否可信
+	gitHeader, gitPaths := false, false
+	for i := 0; i < len(lines); i++ {
+		l, n := lines[i], i+1
+		switch {
+		case strings.HasPrefix(l, "diff --git "):
+			if fp != nil {
+				out = append(out, *fp)
+			}
+			fp, gitHeader = &FilePatch{}, true
+			var a, b string
+			a, b, gitPaths = gitDiffPaths(strings.TrimPrefix(l, "diff --git "))
+			fp.OldPath, fp.NewPath = a, b
+		case strings.HasPrefix(l, "GIT binary patch") || strings.HasPrefix(l, "Binary files "):
+			return nil, fmt.Errorf("line %d: binary patches are not supported", n)
+		case fp != nil && gitHeader && strings.HasPrefix(l, "new file mode"):
+			fp.OldPath = ""
+		case fp != nil && gitHeader && strings.HasPrefix(l, "deleted file mode"):
+			fp.NewPath = ""
+		case fp != nil && strings.HasPrefix(l, "rename from "):
+			fp.OldPath = strings.TrimSpace(strings.TrimPrefix(l, "rename from "))
+		case fp != nil && strings.HasPrefix(l, "rename to "):
+			fp.NewPath = strings.TrimSpace(strings.TrimPrefix(l, "rename to "))
+		case strings.HasPrefix(l, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			a := headerPath(strings.TrimPrefix(l, "--- "), "a/")
+			b := headerPath(strings.TrimPrefix(lines[i+1], "+++ "), "b/")
+			same := fp != nil && gitHeader && len(fp.Hunks) == 0 &&
+				(!gitPaths || (a == "" || a == fp.OldPath) && (b == "" || b == fp.NewPath))
+			if !same {
+				if fp != nil {
+					out = append(out, *fp)
+				}
+				fp = &FilePatch{}
+			}
+			gitHeader = false
+			fp.OldPath, fp.NewPath = a, b
+			i++
+		case strings.HasPrefix(l, "@@"):
+			if fp == nil {
+				return nil, fmt.Errorf("line %d: hunk before ---/+++ file header", n)
+			}
+			gitHeader = false
+			h, err := parseHunkHeader(l)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if strings.HasPrefix(next, "@@") || strings.HasPrefix(next, "diff --git ") ||
+					strings.HasPrefix(next, "--- ") && i+2 < len(lines) && strings.HasPrefix(lines[i+2], "+++ ") {
+					break
+				}
+				if strings.HasPrefix(next, `\`) {
+					// \ No newline at end of file：紧跟在新侧（+ 或上下文）末行之后时新文件末尾无换行
+					if k := len(h.Lines); k > 0 && h.Lines[k-1].Kind != Delete {
+						h.NoNewline = true
+					}
+					i++
+					continue
+				}
+				op, ok := hunkLine(next)
+				if !ok {
+					break
+				}
+				h.Lines = append(h.Lines, op)
+				i++
+			}
+			// 末尾的空行多半是补丁文本的结尾而不是空白上下文行
+			for k := len(h.Lines); k > 0 && h.Lines[k-1].Kind == Equal && h.Lines[k-1].Line == ""; k-- {
+				h.Lines = h.Lines[:k-1]
+			}
+			fp.Hunks = append(fp.Hunks, h)
+		case strings.TrimSpace(l) == "" || fp != nil && gitHeader:
+			// index / mode / similarity 等 git 扩展头
+		case fp == nil:
+			// 补丁前的说明文字
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q outside a hunk", n, l)
+		}
+	}
+	if fp != nil {
+		out = append(out, *fp)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no ---/+++ file headers or *** Begin Patch found")
+	}
+	for _, f := range out {
+		if f.OldPath == "" && f.NewPath == "" {
+			return nil, fmt.Errorf("file section without paths")
+		}
+	}
+	return out, nil
+}
+
+// hunkLine 一行 hunk 内容；空行视为空白上下文行（模型常丢掉行首空格）。
+func hunkLine(l string) (Op, bool) {
+	if l == "" {
+		return Op{Kind: Equal}, true
+	}
+	switch l[0] {
+	case ' ':
+		return Op{Kind: Equal, Line: l[1:]}, true
+	case '-':
+		return Op{Kind: Delete, Line: l[1:]}, true
+	case '+':
+		return Op{Kind: Insert, Line: l[1:]}, true
+	}
+	return Op{}, false
+}
+
+// parseHunkHeader @@ -a,b +c,d @@；只取旧侧起点作定位提示，缺数字时提示未知。
+func parseHunkHeader(l string) (Hunk, error) {
+	h := Hunk{Hint: -1}
+	rest := strings.TrimSpace(strings.TrimPrefix(l, "@@"))
+	if !strings.HasPrefix(rest, "-") {
+		return h, nil
+	}
+	field := strings.Fields(rest)[0][1:]
+	start, count := field, "1"
+	if i := strings.IndexByte(field, ','); i >= 0 {
+		start, count = field[:i], field[i+1:]
+	}
+	a, err := strconv.Atoi(start)
+	if err != nil {
+		return h, fmt.Errorf("bad hunk header %q", l)
+	}
+	if c, err := strconv.Atoi(count); err == nil && c == 0 {
+		// 纯插入：插在第 a 行之后
+		h.Hint = a
+	} else if a > 0 {
+		h.Hint = a - 1
+	} else {
+		h.Hint = 0
+	}
+	return h, nil
+}
+
+// headerPath ---/+++ 行的路径：去掉时间戳与 a/ b/ 前缀，/dev/null 返回空。
+func headerPath(s, prefix string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(s, prefix)
+}
+
+// gitDiffPaths "a/x b/y"；路径含空格时按两侧相同的常见情形拆分。
+func gitDiffPaths(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "a/") {
+		return "", "", false
+	}
+	if i := strings.Index(s, " b/"); i >= 0 && strings.Count(s, " b/") == 1 {
+		return s[2:i], s[i+3:], true
+	}
+	if half := (len(s) - 1) / 2; len(s)%2 == 1 && s[half] == ' ' && s[2:half] == s[half+3:] {
+		return s[2:half], s[half+3:], true
+	}
+	return "", "", false
+}
+
+// HunkResult 一个 hunk 的应用结果：Line 为在旧文件中匹配到的行号（1 起），Fuzz 说明宽松匹配的方式，Err 为拒绝原因。
+type HunkResult struct {
+	Line int
+	Fuzz string
+	Err  string
+}
+
+// ApplyHunks 把 hunks 依次应用到 old：先精确匹配，再忽略行尾空白、忽略首尾空白，仍不行时从两端各去掉至多
+// maxFuzz 行上下文；多处匹配时取离行号提示最近的。上下文行保留文件原文，换行风格（\n / \r\n）沿用原文件。
+// 任一 hunk 被拒时 ok 为 false，结果中给出每个 hunk 的情况。
+func ApplyHunks(old string, hunks []Hunk) (string, []HunkResult, bool) {
+	eol := "\n"
+	if strings.Contains(old, "\r\n") {
+		eol = "\r\n"
+	}
+	finalNL := old == "" || strings.HasSuffix(old, "\n")
+	var lines []string
+	for _, l := range SplitLines(old) {
+		lines = append(lines, strings.TrimRight(l, "\r\n"))
+	}
+
+	results := make([]HunkResult, len(hunks))
+	var out []string
+	ok := true
+	cursor, drift := 0, 0
+	for i, h := range hunks {
+		pos, hl, fuzz, reason := locate(lines, cursor, h, drift)
+		if pos < 0 {
+			results[i].Err = reason
+			ok = false
+			continue
+		}
+		results[i] = HunkResult{Line: pos + 1, Fuzz: fuzz}
+		if h.Hint >= 0 {
+			drift = pos - h.Hint
+		}
+		out = append(out, lines[cursor:pos]...)
+		j := pos
+		for _, op := range hl {
+			switch op.Kind {
+			case Equal:
+				out = append(out, lines[j])
+				j++
+			case Delete:
+				j++
+			case Insert:
+				out = append(out, op.Line)
+			}
+		}
+		cursor = j
+		if cursor == len(lines) {
+			finalNL = !h.NoNewline
+		}
+	}
+	if !ok {
+		return "", results, false
+	}
+	out = append(out, lines[cursor:]...)
+	if len(out) == 0 {
+		return "", results, true
+	}
+	s := strings.Join(out, eol)
+	if finalNL {
+		s += eol
+	}
+	return s, results, true
+}
+
+// lineEq 三档比较：精确、忽略行尾空白、忽略首尾空白。
+var lineEq = []struct {
+	name string
+	eq   func(a, b string) bool
+}{
+	{"", func(a, b string) bool { return a == b }},
+	{"trailing whitespace", func(a, b string) bool {
+		return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+	}},
+	{"whitespace", func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) }},
+}
+
+// locate 在 lines[cursor:] 中找 hunk 的旧侧；返回起点、实际使用的 hunk 行（去掉 fuzz 的上下文后）与 fuzz 说明；
+// 找不到时 pos 为 -1，reason 描述最接近的候选位置。
+func locate(lines []string, cursor int, h Hunk, drift int) (pos int, hl []Op, fuzz, reason string) {
+	from := cursor
+	if h.Anchor != "" {
+		a := -1
+		for k := cursor; k < len(lines); k++ {
+			if strings.TrimSpace(lines[k]) == h.Anchor {
+				a = k
+				break
+			}
+		}
+		if a < 0 {
+			for k := cursor; k < len(lines); k++ {
+				if strings.Contains(lines[k], h.Anchor) {
+					a = k
+					break
+				}
+			}
+		}
+		if a < 0 {
+			return -1, nil, "", fmt.Sprintf("@@ anchor %q not found", h.Anchor)
+		}
+		from = a
+	}
+	want := -1
+	if h.Hint >= 0 {
+		want = h.Hint + drift
+	}
+
+	for trim := 0; trim <= maxFuzz; trim++ {
+		hl, ok := trimContext(h.Lines, trim)
+		if !ok {
+			break
+		}
+		old := oldSide(hl)
+		if len(old) == 0 {
+			// 纯插入：没有上下文可匹配，按提示位置（未知时文件末尾）
+			if trim > 0 {
+				break
+			}
+			p := len(lines)
+			if !h.EOF && want >= 0 && want < p {
+				p = max(want, from)
+			}
+			return p, hl, "", ""
+		}
+		for _, cmp := range lineEq {
+			best := -1
+			for p := from; p+len(old) <= len(lines); p++ {
+				if h.EOF && p+len(old) != len(lines) {
+					continue
+				}
+				if !matchAt(lines, p, old, cmp.eq) {
+					continue
+				}
+				if best < 0 || want >= 0 && abs(p-want) < abs(best-want) {
+					best = p
+				}
+				if want < 0 || p >= want {
+					break
+				}
+			}
+			if best >= 0 {
+				var notes []string
+				if cmp.name != "" {
+					notes = append(notes, "ignored "+cmp.name)
+				}
+				if trim > 0 {
+					notes = append(notes, fmt.Sprintf("dropped %d context line(s) at each end", trim))
+				}
+				return best, hl, strings.Join(notes, ", "), ""
+			}
+		}
+	}
+	return -1, nil, "", missReason(lines, from, h)
+}
+
+// trimContext 从两端各去掉至多 n 行上下文（只去上下文，不去增删行）；没有可去的时 ok 为 false。
+func trimContext(ops []Op, n int) ([]Op, bool) {
+	if n == 0 {
+		return ops, true
+	}
+	lo, hi := 0, len(ops)
+	for k := 0; k < n && lo < hi && ops[lo].Kind == Equal; k++ {
+		lo++
+	}
+	for k := 0; k < n && hi > lo && ops[hi-1].Kind == Equal; k++ {
+		hi--
+	}
+	if lo == 0 && hi == len(ops) {
+		return nil, false
+	}
+	return ops[lo:hi], true
+}
+
+func oldSide(ops []Op) []string {
+	var old []string
+	for _, op := range ops {
+		if op.Kind != Insert {
+			old = append(old, op.Line)
+		}
+	}
+	return old
+}
+
+func matchAt(lines []string, p int, old []string, eq func(a, b string) bool) bool {
+	for k, l := range old {
+		if !eq(lines[p+k], l) {
+			return false
+		}
+	}
+	return true
+}
+
+// missReason 找不到时报告最接近的位置（忽略首尾空白后相同的行最多）与第一处不同。
+func missReason(lines []string, from int, h Hunk) string {
+	old := oldSide(h.Lines)
+	if len(old) > len(lines)-from {
+		return fmt.Sprintf("hunk expects %d line(s) of context/removed text but only %d line(s) remain in the file", len(old), len(lines)-from)
+	}
+	best, bestN := -1, 0
+	for p := from; p+len(old) <= len(lines); p++ {
+		n := 0
+		for k, l := range old {
+			if strings.TrimSpace(lines[p+k]) == strings.TrimSpace(l) {
+				n++
+			}
+		}
+		if n > bestN {
+			best, bestN = p, n
+		}
+	}
+	if best < 0 {
+		return fmt.Sprintf("none of the %d context/removed line(s) were found; first expected line: %q", len(old), old[0])
+	}
+	for k, l := range old {
+		if strings.TrimSpace(lines[best+k]) != strings.TrimSpace(l) {
+			return fmt.Sprintf("context not found; closest match at line %d (%d/%d lines match), first difference at line %d: patch expects %q, file has %q",
+				best+1, bestN, len(old), best+k+1, l, lines[best+k])
+		}
+	}
+	return "context not found"
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func applyOne(t *testing.T, old, patch string) (string, []HunkResult, bool) {
+	t.Helper()
+	fps, err := ParsePatch(patch)
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	if len(fps) != 1 {
+		t.Fatalf("got %d file patches, want 1", len(fps))
+	}
+	return ApplyHunks(old, fps[0].Hunks)
+}
+
+func TestApplyUnifiedRoundTrip(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	cur := "1\n2\nX\n4\n5\n6\n7\n8\n9\n10\nY\n12\n13\n"
+	got, res, ok := applyOne(t, old, Unified("a/f", "b/f", old, cur))
+	if !ok || got != cur {
+		t.Fatalf("apply = %q, %v, %+v", got, ok, res)
+	}
+}
+
+func TestApplyFuzzy(t *testing.T) {
+	old := "package x\n\nfunc a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"
+	// 行号偏移、缩进写错、首行上下文不符
+	patch := `--- a/x.go
++++ b/x.go
+@@ -20,4 +20,4 @@
+ func WRONG() {
+ func b() {
+-    return 2
++	return 3
+ }
+`
+	got, res, ok := applyOne(t, old, patch)
+	want := strings.Replace(old, "return 2", "return 3", 1)
+	if !ok || got != want {
+		t.Fatalf("apply = %q, %v, %+v", got, ok, res)
+	}
+	if res[0].Line != 7 || res[0].Fuzz == "" {
+		t.Fatalf("result = %+v", res[0])
+	}
+}
+
+func TestApplyRejectReason(t *testing.T) {
+	old := "a\nb\nc\n"
+	_, res, ok := applyOne(t, old, "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-x\n+y\n")
+	if ok || !strings.Contains(res[0].Err, `patch expects "x", file has "b"`) {
+		t.Fatalf("want rejection, got ok=%v %+v", ok, res)
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	patch := `*** Begin Patch
+*** Add File: new.txt
++hello
+*** Update File: a.txt
+*** Move to: b.txt
+@@ func main
+-	old()
++	new()
+*** Delete File: gone.txt
+*** End Patch`
+	fps, err := ParsePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != 3 || fps[0].OldPath != "" || fps[0].NewPath != "new.txt" ||
+		fps[1].OldPath != "a.txt" || fps[1].NewPath != "b.txt" || fps[2].NewPath != "" {
+		t.Fatalf("parsed %+v", fps)
+	}
+	got, _, ok := ApplyHunks("", fps[0].Hunks)
+	if !ok || got != "hello\n" {
+		t.Fatalf("add = %q", got)
+	}
+	got, res, ok := ApplyHunks("func init\n\told()\nfunc main\r\n\told()\r\n", fps[1].Hunks)
+	if !ok || got != "func init\r\n\told()\r\nfunc main\r\n\tnew()\r\n" {
+		t.Fatalf("update = %q %+v", got, res)
+	}
+}
+
+func TestParseGitRenameAndDelete(t *testing.T) {
+	patch := `diff --git a/d.txt b/moved.txt
+similarity index 100%
+rename from d.txt
+rename to moved.txt
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++n
+--- a/e.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+	fps, err := ParsePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"d.txt", "moved.txt"}, {"", "new.txt"}, {"e.txt", ""}}
+	if len(fps) != len(want) {
+		t.Fatalf("parsed %+v", fps)
+	}
+	for i, w := range want {
+		if fps[i].OldPath != w[0] || fps[i].NewPath != w[1] {
+			t.Fatalf("file %d = %q → %q, want %q → %q", i, fps[i].OldPath, fps[i].NewPath, w[0], w[1])
+		}
+	}
+}
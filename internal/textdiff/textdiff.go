@@ -0,0 +1,264 @@
+// Package textdiff 行级 diff 与 unified diff 文本（文件工具的变更事件、工具结果摘要共用）。
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context unified diff 每个 hunk 前后保留的上下文行数。
+const Context = 3
+
+// maxEditDistance Myers 搜索的编辑距离上限；超出时退化为整段删除 + 插入（大文件重写时避免 O(D²) 内存）。
+const maxEditDistance = 2000
+
+// OpKind 行操作类型。
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Op 一行的操作；Line 含行尾换行（文件末行可能没有）。
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// SplitLines 按行切分并保留换行符；空串返回 nil。
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines 计算 a → b 的行级编辑序列（最短编辑；相同前后缀先裁掉）。
+func Lines(a, b []string) []Op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ops := make([]Op, 0, len(a)+len(b)-pre-suf)
+	for _, l := range a[:pre] {
+		ops = append(ops, Op{Equal, l})
+	}
+	ops = append(ops, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, Op{Equal, l})
+	}
+	return ops
+}
+
+// replaceAll a 全部删除、b 全部插入。
+func replaceAll(a, b []string) []Op {
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, l := range a {
+		ops = append(ops, Op{Delete, l})
+	}
+	for _, l := range b {
+		ops = append(ops, Op{Insert, l})
+	}
+	return ops
+}
+
+// myers Myers O(ND) 差分；trace 只保存每步用到的 k ∈ [-d-1, d+1] 窗口。
+func myers(a, b []string) []Op {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	found := -1
+	for d := 0; d <= max && found < 0; d++ {
+		if d > maxEditDistance {
+			return replaceAll(a, b)
+		}
+		snap := make([]int, 2*d+3)
+		copy(snap, v[off-d-1:off+d+2])
+		trace = append(trace, snap)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+	}
+
+	var rev []Op
+	x, y := n, m
+	for d := found; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, Op{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, Op{Insert, b[y-1]})
+			} else {
+				rev = append(rev, Op{Delete, a[x-1]})
+			}
+			x, y = prevX, prevY
+		}
+	}
+	for i, j := 0, len(rev)-1; i < j; i, j = i+1, j-1 {
+		rev[i], rev[j] = rev[j], rev[i]
+	}
+	return rev
+}
+
+// Unified old → new 的 unified diff（Context 行上下文）；内容相同返回空串。
+// from / to 为 ---/+++ 头部的文件名（新建或删除的一侧传 /dev/null）。
+func Unified(from, to, old, new string) string {
+	if old == new {
+		return ""
+	}
+	ops := Lines(SplitLines(old), SplitLines(new))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+
+	// 每个 op 对应的旧 / 新行号（0 起，指向该 op 之前已消耗的行数）
+	oldAt := make([]int, len(ops)+1)
+	newAt := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if op.Kind != Insert {
+			oldAt[i+1]++
+		}
+		if op.Kind != Delete {
+			newAt[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			i++
+			continue
+		}
+		// hunk：从本处变化向前取 Context 行，向后合并间隔 ≤ 2*Context 的变化
+		start := i - Context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*Context {
+				end += min(Context, run-end)
+				break
+			}
+			end = run
+		}
+		writeHunk(&sb, ops[start:end], oldAt[start], newAt[start])
+		i = end
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []Op, oldStart, newStart int) {
+	oldLen, newLen := 0, 0
+	for _, op := range ops {
+		if op.Kind != Insert {
+			oldLen++
+		}
+		if op.Kind != Delete {
+			newLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLen), hunkRange(newStart, newLen))
+	for _, op := range ops {
+		prefix := " "
+		switch op.Kind {
+		case Delete:
+			prefix = "-"
+		case Insert:
+			prefix = "+"
+		}
+		sb.WriteString(prefix)
+		sb.WriteString(op.Line)
+		if !strings.HasSuffix(op.Line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange @@ 行号：长度为 0 时起点为其前一行（GNU diff 约定）。
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// Count 统计 unified diff 的新增 / 删除行数（第一个 @@ 之前的 ---/+++ 头不计）。
+func Count(unified string) (added, removed int) {
+	inHunk := false
+	for _, l := range strings.Split(unified, "\n") {
+		switch {
+		case strings.HasPrefix(l, "@@"):
+			inHunk = true
+		case !inHunk:
+		case strings.HasPrefix(l, "+"):
+			added++
+		case strings.HasPrefix(l, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// Compact 截断为至多 maxLines 行（保留头部与前几个 hunk），供工具结果回给模型。
+func Compact(unified string, maxLines int) string {
+	lines := strings.Split(strings.TrimRight(unified, "\n"), "\n")
+	if len(lines) <= maxLines {
+		return strings.TrimRight(unified, "\n")
+	}
+	return strings.Join(lines[:maxLines], "\n") + fmt.Sprintf("\n… (%d more diff lines)", len(lines)-maxLines)
+}
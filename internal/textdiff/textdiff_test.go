@@ -0,0 +1,65 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func apply(ops []Op) (a, b string) {
+	var sa, sb strings.Builder
+	for _, op := range ops {
+		if op.Kind != Insert {
+			sa.WriteString(op.Line)
+		}
+		if op.Kind != Delete {
+			sb.WriteString(op.Line)
+		}
+	}
+	return sa.String(), sb.String()
+}
+
+func TestLinesRoundTrip(t *testing.T) {
+	cases := [][2]string{
+		{"", "a\n"},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "x\na\nb\ny\nc"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\n2\nX\n4\n5\n6\nY\n8\n9\n"},
+	}
+	for _, c := range cases {
+		ops := Lines(SplitLines(c[0]), SplitLines(c[1]))
+		a, b := apply(ops)
+		if a != c[0] || b != c[1] {
+			t.Fatalf("round trip %q -> %q: got %q -> %q", c[0], c[1], a, b)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	cur := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nM"
+	got := Unified("a/x.txt", "b/x.txt", old, cur)
+	want := "--- a/x.txt\n+++ b/x.txt\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -10,4 +10,4 @@\n j\n k\n l\n-m\n+M\n\\ No newline at end of file\n"
+	if got != want {
+		t.Fatalf("unified:\n%s\nwant:\n%s", got, want)
+	}
+	if add, del := Count(got); add != 2 || del != 2 {
+		t.Fatalf("count = +%d -%d", add, del)
+	}
+	if Unified("a", "b", old, old) != "" {
+		t.Fatal("identical content should give empty diff")
+	}
+	created := Unified("/dev/null", "b/y", "", "x\ny\n")
+	if !strings.Contains(created, "@@ -0,0 +1,2 @@\n+x\n+y\n") {
+		t.Fatalf("created:\n%s", created)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	d := Unified("a", "b", "", strings.Repeat("x\n", 50))
+	c := Compact(d, 10)
+	if n := strings.Count(c, "\n"); n != 10 || !strings.HasSuffix(c, "… (43 more diff lines)") {
+		t.Fatalf("compact:\n%s", c)
+	}
+}
@@ -0,0 +1,186 @@
+// Package usage 模型调用用量台账：每个脑子分区一个 usage.jsonl（每次 API 调用一行），
+// 按会话、LLM 角色与模型汇总 token，并按 llm.prices 价格表计费。
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cata/internal/brain"
+	"cata/internal/clock"
+	"cata/internal/config"
+	"cata/internal/protocol"
+)
+
+// Entry 台账的一行：一次模型调用。
+type Entry struct {
+	At               string  `json:"at"`
+	Session          string  `json:"session,omitempty"`
+	Role             string  `json:"role"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	TotalTokens      int     `json:"total_tokens"`
+	Estimated        bool    `json:"estimated,omitempty"`
+	Cost             float64 `json:"cost,omitempty"`
+	Priced           bool    `json:"priced,omitempty"`
+}
+
+type sessionCtxKey struct{}
+
+// WithSession 将 chat 会话 id 放入 ctx，此后的调用在台账里记到该会话名下。
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, id)
+}
+
+// SessionFrom 取 ctx 中的 chat 会话 id（无则为空）。
+func SessionFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(sessionCtxKey{}).(string)
+	return id
+}
+
+// Cost 按价格表计算一次调用的费用；模型无单价时 ok=false。
+func Cost(model string, prompt, cached, completion int) (cost float64, ok bool) {
+	cfg := config.Current()
+	if cfg == nil {
+		return 0, false
+	}
+	p, ok := cfg.LLM.PriceFor(model)
+	if !ok {
+		return 0, false
+	}
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	if cached > prompt {
+		cached = prompt
+	}
+	cost = (float64(prompt-cached)*p.Input + float64(cached)*cachedPrice + float64(completion)*p.Output) / 1e6
+	return cost, true
+}
+
+var ledgerMu sync.Mutex
+
+// Record 追加一条调用到 ws 的台账（补齐时间与费用）。
+func Record(ws *brain.Workspace, e Entry) error {
+	if ws == nil {
+		return nil
+	}
+	if e.At == "" {
+		e.At = clock.RFC3339()
+	}
+	e.Cost, e.Priced = Cost(e.Model, e.PromptTokens, e.CachedTokens, e.CompletionTokens)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	path := ws.UsageLedgerPath()
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Load 读取 ws 台账中 since 之后（含）的调用；since 为零值时读全部。坏行跳过。
+func Load(ws *brain.Workspace, since time.Time) ([]Entry, error) {
+	data, err := os.ReadFile(ws.UsageLedgerPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if !since.IsZero() {
+			at, err := time.Parse(time.RFC3339, e.At)
+			if err != nil || at.Before(since) {
+				continue
+			}
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// add 把一条调用计入合计。
+func add(t *protocol.UsageTotals, e Entry) {
+	t.Calls++
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+	t.ReasoningTokens += e.ReasoningTokens
+	t.CachedTokens += e.CachedTokens
+	t.TotalTokens += e.TotalTokens
+	t.Cost += e.Cost
+	if e.Estimated {
+		t.Estimated++
+	}
+	if !e.Priced {
+		t.Unpriced++
+	}
+}
+
+// Report 汇总 workspaces 台账中 since 之后的调用；session 非空时另算该会话的合计。
+func Report(workspaces []*brain.Workspace, since time.Time, session string) (protocol.UsageReport, error) {
+	r := protocol.UsageReport{
+		Workspaces: []string{},
+		ByRole:     map[string]protocol.UsageTotals{},
+		ByModel:    map[string]protocol.UsageTotals{},
+	}
+	if !since.IsZero() {
+		r.Since = clock.FormatTime(since, time.RFC3339)
+	}
+	for _, ws := range workspaces {
+		entries, err := Load(ws, since)
+		if err != nil {
+			return r, fmt.Errorf("usage ledger %s: %w", ws.ID, err)
+		}
+		r.Workspaces = append(r.Workspaces, ws.ID)
+		for _, e := range entries {
+			add(&r.Total, e)
+			role := r.ByRole[e.Role]
+			add(&role, e)
+			r.ByRole[e.Role] = role
+			model := r.ByModel[e.Model]
+			add(&model, e)
+			r.ByModel[e.Model] = model
+			if session != "" && e.Session == session {
+				if r.Session == nil {
+					r.Session = &protocol.UsageTotals{}
+				}
+				add(r.Session, e)
+			}
+		}
+	}
+	if session != "" && r.Session != nil {
+		r.SessionID = session
+	}
+	return r, nil
+}